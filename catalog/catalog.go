@@ -0,0 +1,135 @@
+package catalog
+
+import (
+	"arc/parser"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Catalog struct {
+	Root    string
+	ID      string
+	Volume  string
+	Algo    string
+	Time    time.Time
+	Entries []Entry
+}
+
+type Entry struct {
+	Path    string
+	Size    int
+	ModTime time.Time
+	Hash    string
+}
+
+// SameArchive reports whether two catalogs describe the same archive. They
+// are matched by archive ID, or by root when either has none.
+func SameArchive(a, b *Catalog) bool {
+	if a.ID != "" && b.ID != "" {
+		return a.ID == b.ID
+	}
+	return a.Root == b.Root
+}
+
+func Read(name string) (*Catalog, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	catalog, err := Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return catalog, nil
+}
+
+func Decode(reader io.Reader) (*Catalog, error) {
+	result := &Catalog{}
+	header := false
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		if scanner.Text() == "" {
+			continue
+		}
+		msg := parser.Parse(scanner.Text())
+		var err error
+		switch msg.Type {
+		case "catalog":
+			header = true
+			result.Root = msg.StringValue("root")
+			result.ID = msg.StringValue("id")
+			result.Volume = msg.StringValue("volume")
+			result.Algo = msg.StringValue("algo")
+			result.Time, err = msg.TimeValue("time")
+		case "file":
+			entry := Entry{
+				Path: msg.StringValue("path"),
+				Hash: msg.StringValue("hash"),
+			}
+			if entry.Size, err = msg.IntValue("size"); err == nil {
+				entry.ModTime, err = msg.TimeValue("mod-time")
+			}
+			result.Entries = append(result.Entries, entry)
+		default:
+			err = fmt.Errorf("invalid catalog record %q", msg.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !header {
+		return nil, errors.New("not a catalog")
+	}
+	if result.Algo == "" {
+		result.Algo = "sha256"
+	}
+	return result, nil
+}
+
+func Write(name string, catalog *Catalog) error {
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+	temp := name + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	err = Encode(file, catalog)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp, name)
+	}
+	if err != nil {
+		os.Remove(temp)
+	}
+	return err
+}
+
+func Encode(out io.Writer, catalog *Catalog) error {
+	writer := bufio.NewWriter(out)
+	writer.WriteString(parser.String("catalog", "root", catalog.Root, "id", catalog.ID, "volume", catalog.Volume, "algo", catalog.Algo, "time", catalog.Time))
+	for _, entry := range catalog.Entries {
+		writer.WriteString(parser.String("file",
+			"path", entry.Path,
+			"size", entry.Size,
+			"mod-time", entry.ModTime,
+			"hash", entry.Hash))
+	}
+	return writer.Flush()
+}
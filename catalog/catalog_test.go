@@ -0,0 +1,64 @@
+package catalog
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteRead(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "catalogs", "root.catalog")
+	written := &Catalog{
+		Root:    "/mnt/photos",
+		ID:      "abc",
+		Volume:  "USB",
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Entries: entries("a/b.jpg", "h1", "c.txt", ""),
+	}
+	if err := Write(name, written); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := Read(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Root != written.Root || read.ID != written.ID || read.Volume != written.Volume || !read.Time.Equal(written.Time) {
+		t.Errorf("header = %+v, want %+v", read, written)
+	}
+	if len(read.Entries) != len(written.Entries) {
+		t.Fatalf("entries = %v, want %v", read.Entries, written.Entries)
+	}
+	for i, entry := range read.Entries {
+		if want := written.Entries[i]; entry.Path != want.Path || entry.Hash != want.Hash || entry.Size != want.Size || !entry.ModTime.Equal(want.ModTime) {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want)
+		}
+	}
+}
+
+func TestDecodeRejectsOtherFiles(t *testing.T) {
+	if _, err := Decode(strings.NewReader("file\tpath=a\tsize=1\tmod-time=2024-01-02T03:04:05Z\n")); err == nil {
+		t.Error("decoded a catalog without a header")
+	}
+	if _, err := Decode(strings.NewReader("catalog\troot=/a\ttime=now\n")); err == nil {
+		t.Error("decoded a catalog with a bad time")
+	}
+}
+
+func TestSameArchive(t *testing.T) {
+	cases := []struct {
+		a, b Catalog
+		same bool
+	}{
+		{Catalog{Root: "/a", ID: "1"}, Catalog{Root: "/mnt/a", ID: "1"}, true},
+		{Catalog{Root: "/a", ID: "1"}, Catalog{Root: "/a", ID: "2"}, false},
+		{Catalog{Root: "/a"}, Catalog{Root: "/a", ID: "1"}, true},
+		{Catalog{Root: "/a"}, Catalog{Root: "/b"}, false},
+	}
+	for _, c := range cases {
+		if same := SameArchive(&c.a, &c.b); same != c.same {
+			t.Errorf("SameArchive(%+v, %+v) = %v", c.a, c.b, same)
+		}
+	}
+}
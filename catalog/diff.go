@@ -0,0 +1,169 @@
+package catalog
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+type Diff struct {
+	Changes []Change
+	Folders map[string]*Totals
+}
+
+type Change struct {
+	Kind    ChangeKind
+	Path    string
+	OldPath string
+	Entry
+}
+
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Modified
+	Moved
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	case Moved:
+		return "moved"
+	}
+	return "UNKNOWN CHANGE KIND"
+}
+
+type Totals struct {
+	Added    int
+	Removed  int
+	Modified int
+	Moved    int
+}
+
+func (t *Totals) String() string {
+	return fmt.Sprintf("+%d -%d ~%d >%d", t.Added, t.Removed, t.Modified, t.Moved)
+}
+
+func Compare(from, to *Catalog) *Diff {
+	if from.Algo != to.Algo {
+		// Hashes of different algorithms say nothing about each other.
+		from, to = withoutHashes(from), withoutHashes(to)
+	}
+	oldByPath := map[string]Entry{}
+	for _, entry := range from.Entries {
+		oldByPath[entry.Path] = entry
+	}
+	newByPath := map[string]Entry{}
+	for _, entry := range to.Entries {
+		newByPath[entry.Path] = entry
+	}
+
+	result := &Diff{Folders: map[string]*Totals{}}
+	removedByHash := map[string][]Entry{}
+	addedByHash := map[string][]Entry{}
+
+	for _, entry := range to.Entries {
+		oldEntry, ok := oldByPath[entry.Path]
+		if !ok {
+			addedByHash[entry.Hash] = append(addedByHash[entry.Hash], entry)
+		} else if oldEntry.Hash != "" && entry.Hash != "" && oldEntry.Hash != entry.Hash {
+			result.add(Change{Kind: Modified, Path: entry.Path, OldPath: entry.Path, Entry: entry})
+		}
+	}
+	for _, entry := range from.Entries {
+		if _, ok := newByPath[entry.Path]; !ok {
+			removedByHash[entry.Hash] = append(removedByHash[entry.Hash], entry)
+		}
+	}
+
+	for hash, added := range addedByHash {
+		removed := removedByHash[hash]
+		for i, entry := range added {
+			if hash != "" && i < len(removed) {
+				result.add(Change{Kind: Moved, Path: entry.Path, OldPath: removed[i].Path, Entry: entry})
+			} else {
+				result.add(Change{Kind: Added, Path: entry.Path, Entry: entry})
+			}
+		}
+		if hash == "" {
+			continue
+		}
+		if len(removed) > len(added) {
+			removedByHash[hash] = removed[len(added):]
+		} else {
+			delete(removedByHash, hash)
+		}
+	}
+	for _, removed := range removedByHash {
+		for _, entry := range removed {
+			result.add(Change{Kind: Removed, Path: entry.Path, OldPath: entry.Path, Entry: entry})
+		}
+	}
+
+	slices.SortFunc(result.Changes, func(a, b Change) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return result
+}
+
+func withoutHashes(cat *Catalog) *Catalog {
+	result := *cat
+	result.Entries = make([]Entry, len(cat.Entries))
+	for i, entry := range cat.Entries {
+		entry.Hash = ""
+		result.Entries[i] = entry
+	}
+	return &result
+}
+
+func (d *Diff) add(change Change) {
+	d.Changes = append(d.Changes, change)
+
+	// A move counts in the folders it left as well as in the ones it
+	// entered, but only once in the folders that hold both.
+	folders := map[string]bool{}
+	paths := []string{change.Path}
+	if change.Kind == Moved {
+		paths = append(paths, change.OldPath)
+	}
+	for _, path := range paths {
+		folder := filepath.Dir(path)
+		for {
+			if folder == "." || folder == "/" {
+				folder = ""
+			}
+			folders[folder] = true
+			if folder == "" {
+				break
+			}
+			folder = filepath.Dir(folder)
+		}
+	}
+
+	for folder := range folders {
+		totals := d.Folders[folder]
+		if totals == nil {
+			totals = &Totals{}
+			d.Folders[folder] = totals
+		}
+		switch change.Kind {
+		case Added:
+			totals.Added++
+		case Removed:
+			totals.Removed++
+		case Modified:
+			totals.Modified++
+		case Moved:
+			totals.Moved++
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+)
+
+func entries(files ...string) []Entry {
+	result := []Entry{}
+	for i := 0; i < len(files); i += 2 {
+		result = append(result, Entry{Path: files[i], Size: 1, ModTime: time.Unix(0, 0), Hash: files[i+1]})
+	}
+	return result
+}
+
+func changes(diff *Diff) map[string]string {
+	result := map[string]string{}
+	for _, change := range diff.Changes {
+		value := change.Kind.String()
+		if change.Kind == Moved {
+			value += " from " + change.OldPath
+		}
+		result[change.Path] = value
+	}
+	return result
+}
+
+func TestCompare(t *testing.T) {
+	from := &Catalog{Entries: entries(
+		"same", "h1",
+		"edited", "h2",
+		"gone", "h3",
+		"a/old", "h4",
+	)}
+	to := &Catalog{Entries: entries(
+		"same", "h1",
+		"edited", "h5",
+		"new", "h6",
+		"b/new", "h4",
+	)}
+
+	diff := Compare(from, to)
+	got := changes(diff)
+	want := map[string]string{
+		"edited": "modified",
+		"gone":   "removed",
+		"new":    "added",
+		"b/new":  "moved from a/old",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	for path, change := range want {
+		if got[path] != change {
+			t.Errorf("%s: %q, want %q", path, got[path], change)
+		}
+	}
+
+	if totals := diff.Folders[""].String(); totals != "+1 -1 ~1 >1" {
+		t.Errorf("root totals = %s", totals)
+	}
+	for _, folder := range []string{"a", "b"} {
+		if totals := diff.Folders[folder].String(); totals != "+0 -0 ~0 >1" {
+			t.Errorf("%s totals = %s", folder, totals)
+		}
+	}
+}
+
+func TestCompareNewlyHashedFilesAreNotModified(t *testing.T) {
+	from := &Catalog{Entries: entries("hashed", "", "unhashed", "h1")}
+	to := &Catalog{Entries: entries("hashed", "h2", "unhashed", "")}
+
+	if got := changes(Compare(from, to)); len(got) != 0 {
+		t.Errorf("changes = %v", got)
+	}
+}
+
+func TestCompareUnhashedFilesAreNotMoves(t *testing.T) {
+	from := &Catalog{Entries: entries("old", "", "dup-a", "h1", "dup-b", "h1")}
+	to := &Catalog{Entries: entries("new", "", "dup-c", "h1")}
+
+	got := changes(Compare(from, to))
+	want := map[string]string{
+		"old":   "removed",
+		"new":   "added",
+		"dup-b": "removed",
+		"dup-c": "moved from dup-a",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	for path, change := range want {
+		if got[path] != change {
+			t.Errorf("%s: %q, want %q", path, got[path], change)
+		}
+	}
+}
+
+func TestCompareDifferentAlgorithms(t *testing.T) {
+	from := &Catalog{Algo: "sha256", Entries: entries("same", "h1", "old", "h2")}
+	to := &Catalog{Algo: "sha512", Entries: entries("same", "h3", "new", "h4")}
+
+	got := changes(Compare(from, to))
+	if len(got) != 2 || got["old"] != "removed" || got["new"] != "added" {
+		t.Errorf("changes = %v, want old removed and new added", got)
+	}
+}
@@ -1,17 +1,47 @@
 package main
 
 import (
+	"arc/config"
+	"arc/engine"
+	"arc/exec"
+	"arc/fs"
 	"arc/log"
+	"arc/transport"
 	"arc/ui"
+	"fmt"
+	"os"
 	"runtime/debug"
 
 	"github.com/gdamore/tcell/v2"
 )
 
 func main() {
+	profile, err := useProfile()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "arc:", err)
+		os.Exit(1)
+	}
+	options := config.LoadOptions(profile)
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		daemon(os.Args[2:], options)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(ctl(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(verify(os.Args[2:]))
+	}
+
 	log.SetLogger("log-arc.log")
 	defer log.CloseLogger()
 
+	conn, err := connect(options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "arc:", err)
+		os.Exit(1)
+	}
+
 	screen, err := tcell.NewScreen()
 	if err != nil {
 		log.Debug("ERROR", err)
@@ -22,16 +52,91 @@ func main() {
 		return
 	}
 
-	defer func() {
-		screen.Fini()
+	err = func() error {
+		defer func() {
+			screen.Fini()
+		}()
+
+		defer func() {
+			if err := recover(); err != nil {
+				log.Debug("ERROR", "err", err)
+				log.Debug("STACK", "stack", debug.Stack())
+			}
+		}()
+
+		return ui.Run(screen, conn)
 	}()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "arc:", err)
+		log.CloseLogger()
+		os.Exit(1)
+	}
+}
 
-	defer func() {
-		if err := recover(); err != nil {
-			log.Debug("ERROR", "err", err)
-			log.Debug("STACK", "stack", debug.Stack())
+func useProfile() (*config.Profile, error) {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "daemon", "-d":
+			args = args[1:]
+		case "ctl", "verify", "attach", "diff":
+			return nil, nil
 		}
-	}()
+	}
+	if len(args) != 1 {
+		return nil, nil
+	}
+	return config.LoadProfile(args[0])
+}
+
+func connect(options config.Options) (transport.Conn, error) {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "attach":
+			return exec.Attach()
+		case "-d":
+			if err := exec.Daemon(os.Args[2:]); err != nil {
+				return nil, err
+			}
+			return exec.Attach()
+		}
+	}
+	return exec.Engine(options), nil
+}
+
+func verify(names []string) int {
+	status := 0
+	for _, name := range names {
+		problems := 0
+		err := fs.Verify(name, func(path, problem string) {
+			fmt.Printf("%s: %s: %s\n", name, path, problem)
+			problems++
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "arc:", err)
+			status = 1
+		} else if problems > 0 {
+			status = 1
+		} else {
+			fmt.Printf("%s: OK\n", name)
+		}
+	}
+	return status
+}
+
+func daemon(args []string, options config.Options) {
+	log.SetLogger("log-engine.log")
+	defer log.CloseLogger()
 
-	ui.Run(screen)
+	roots, err := config.Roots(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "arc:", err)
+		os.Exit(1)
+	}
+	listener, err := exec.Listen()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "arc:", err)
+		os.Exit(1)
+	}
+	engine.Serve(listener, exec.Backend, roots, options)
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"arc/exec"
+	"arc/transport"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const ctlUsage = `usage: arc ctl <command> [name=value ...]
+
+commands:
+  query-divergent                  list divergent files
+  query-locations hash=<hash>      list every copy of a file
+  query-totals                     per-archive totals
+  resolve root=<root> path=<folder> name=<name>
+  resolve-all
+  export root=<root> [path=<folder>] [name=<name>] target=<file.tar> [volume-size=<size>]
+  checksums root=<root> [path=<folder>] [name=<name>] [format=sha256|md5|sfv] [target=<file>]
+  cancel id=<id>
+  undo [batch=<batch>]
+  unlock root=<root>               break another session's lock on a root
+  pause | resume
+  stop`
+
+func ctl(args []string) int {
+	params, ok := ctlParams(args)
+	if !ok {
+		fmt.Fprintln(os.Stderr, ctlUsage)
+		return 2
+	}
+
+	conn, err := exec.Attach()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "arc: engine is not running:", err)
+		return 1
+	}
+	defer conn.Close()
+	return ctlRequest(conn, args[0], params, os.Stdout, os.Stderr)
+}
+
+func ctlParams(args []string) ([]any, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+	params := []any{"req", strconv.Itoa(os.Getpid())}
+	for _, arg := range args[1:] {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, false
+		}
+		params = append(params, name, value)
+	}
+	return params, true
+}
+
+func ctlRequest(conn transport.Conn, kind string, params []any, stdout, stderr io.Writer) int {
+	req := params[1].(string)
+	conn.Send(kind, params...)
+
+	status := 0
+	for {
+		msg, err := conn.Receive()
+		if err != nil {
+			fmt.Fprintln(stderr, "arc:", err)
+			return 1
+		}
+		if msg.StringValue("req") != req {
+			continue
+		}
+		switch msg.Type {
+		case "done":
+			return status
+		case "error":
+			fmt.Fprintln(stderr, "arc:", msg.StringValue("error"))
+			status = 1
+		default:
+			fields := []string{msg.Type}
+			for _, name := range replyFields[msg.Type] {
+				fields = append(fields, name+"="+msg.StringValue(name))
+			}
+			fmt.Fprintln(stdout, strings.Join(fields, "\t"))
+		}
+	}
+}
+
+var replyFields = map[string][]string{
+	"file":              {"root", "path", "name", "size", "mod-time", "hash", "state", "counts"},
+	"totals":            {"root", "state", "files", "size", "divergent", "pending", "last-synced", "label", "locked-by", "id", "volume"},
+	"export-started":    {"id"},
+	"checksums-started": {"id"},
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"arc/transport"
+	"bytes"
+	"testing"
+)
+
+func TestCtlParams(t *testing.T) {
+	params, ok := ctlParams([]string{"query-locations", "hash=abc", "name=a=b"})
+	if !ok || len(params) != 6 || params[0] != "req" || params[2] != "hash" || params[3] != "abc" || params[5] != "a=b" {
+		t.Errorf("params = %v, %v", params, ok)
+	}
+	for _, args := range [][]string{nil, {"resolve", "root"}} {
+		if _, ok := ctlParams(args); ok {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}
+
+func fakeEngine(t *testing.T, replies func(req string, engine transport.Conn)) transport.Conn {
+	ctl, engine := transport.Pipe()
+	t.Cleanup(func() { ctl.Close() })
+	go func() {
+		msg, err := engine.Receive()
+		if err != nil {
+			return
+		}
+		replies(msg.StringValue("req"), engine)
+	}()
+	return ctl
+}
+
+func TestCtlPrintsReplies(t *testing.T) {
+	conn := fakeEngine(t, func(req string, engine transport.Conn) {
+		engine.Send("file", "req", "other", "root", "/x")
+		engine.Send("status", "status", "broadcast to every client")
+		engine.Send("totals", "req", req, "root", "/a", "files", 3, "unlisted", "no")
+		engine.Send("export-started", "req", req, "id", "export-1")
+		engine.Send("done", "req", req)
+	})
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	params, _ := ctlParams([]string{"query-totals"})
+	if status := ctlRequest(conn, "query-totals", params, stdout, stderr); status != 0 {
+		t.Errorf("status = %d, stderr %q", status, stderr)
+	}
+	lines := bytes.Split(bytes.TrimSpace(stdout.Bytes()), []byte("\n"))
+	if len(lines) != 2 || !bytes.HasPrefix(lines[0], []byte("totals\troot=/a\tstate=\tfiles=3\t")) ||
+		string(lines[1]) != "export-started\tid=export-1" {
+		t.Errorf("stdout = %q", stdout)
+	}
+	if bytes.Contains(stdout.Bytes(), []byte("/x")) || bytes.Contains(stdout.Bytes(), []byte("unlisted")) {
+		t.Errorf("printed other replies: %q", stdout)
+	}
+}
+
+func TestCtlReportsErrors(t *testing.T) {
+	conn := fakeEngine(t, func(req string, engine transport.Conn) {
+		engine.Send("error", "req", req, "error", "Unknown archive /x")
+		engine.Send("done", "req", req)
+	})
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	params, _ := ctlParams([]string{"resolve", "root=/x"})
+	if status := ctlRequest(conn, "resolve", params, stdout, stderr); status != 1 {
+		t.Errorf("status = %d", status)
+	}
+	if stderr.String() != "arc: Unknown archive /x\n" || stdout.Len() != 0 {
+		t.Errorf("stdout %q, stderr %q", stdout, stderr)
+	}
+
+	conn = fakeEngine(t, func(req string, engine transport.Conn) {
+		engine.Close()
+	})
+	if status := ctlRequest(conn, "resolve", params, stdout, stderr); status != 1 {
+		t.Errorf("status = %d after the engine went away", status)
+	}
+}
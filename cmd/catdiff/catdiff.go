@@ -0,0 +1,64 @@
+package main
+
+import (
+	"arc/catalog"
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+)
+
+var totalsFlag = flag.Bool("t", false, "show totals by folder")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: catdiff [-t] <old catalog> <new catalog>")
+		os.Exit(2)
+	}
+
+	from, err := catalog.Read(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	to, err := catalog.Read(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if !catalog.SameArchive(from, to) {
+		fmt.Fprintf(os.Stderr, "catalogs of different archives: %s and %s\n", from.Root, to.Root)
+		os.Exit(1)
+	}
+
+	diff := catalog.Compare(from, to)
+	for _, change := range diff.Changes {
+		if change.Kind == catalog.Moved {
+			fmt.Printf("%-9s %s <- %s\n", change.Kind, change.Path, change.OldPath)
+		} else {
+			fmt.Printf("%-9s %s\n", change.Kind, change.Path)
+		}
+	}
+
+	if !*totalsFlag {
+		return
+	}
+
+	folders := make([]string, 0, len(diff.Folders))
+	for folder := range diff.Folders {
+		folders = append(folders, folder)
+	}
+	slices.SortFunc(folders, cmp.Compare[string])
+
+	fmt.Println()
+	for _, folder := range folders {
+		name := folder
+		if name == "" {
+			name = "."
+		}
+		fmt.Printf("%-24s %s\n", diff.Folders[folder], name)
+	}
+}
@@ -1,22 +1,16 @@
 package main
 
 import (
+	"arc/config"
 	"arc/engine"
 	"arc/exec"
 	"arc/log"
-	"os"
-	"path/filepath"
+	"arc/transport"
 )
 
 func main() {
 	log.SetLogger("log-engine.log")
 	defer log.CloseLogger()
 
-	fs := os.Getenv("ARC_FS")
-	if fs == "" {
-		executable, _ := os.Executable()
-		dir := filepath.Dir(executable)
-		fs = filepath.Join(dir, "fs")
-	}
-	engine.Run(exec.Start(fs))
+	engine.Run(transport.Stdio(), exec.Backend, config.LoadOptions(nil))
 }
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"arc/fs"
+	"arc/log"
+	"arc/transport"
+)
+
+func main() {
+	log.SetLogger("log-fs.log")
+	defer log.CloseLogger()
+
+	fs.Run(transport.Stdio())
+}
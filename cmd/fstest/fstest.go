@@ -59,12 +59,46 @@ mainLoop:
 		case "scan":
 			wg.Add(1)
 			go scanArchive(cmd.StringValue("root"))
+		case "hash":
+			wg.Add(1)
+			go hashFile(cmd)
+		case "cancel":
+		case "copy":
+			copyFile(cmd)
+		case "move":
+			moveFile(cmd)
+		case "delete":
+			deleteFile(cmd)
+		case "undo":
+			if cmd.StringValue("plan") == "true" {
+				send("undo-planned", "root", cmd.StringValue("root"), "batch", cmd.StringValue("batch"))
+			} else {
+				send("batch-undone", "root", cmd.StringValue("root"), "batch", cmd.StringValue("batch"))
+			}
+		case "list-batches":
+			send("batches-listed", "root", cmd.StringValue("root"))
+		case "compare":
+			send("files-compared",
+				"root", cmd.StringValue("root"),
+				"path", cmd.StringValue("path"),
+				"name", cmd.StringValue("name"),
+				"id", cmd.StringValue("id"))
+		case "list-attic":
+			send("attic-listed", "root", cmd.StringValue("root"))
+		case "read":
+			send("chunk-end", "id", cmd.StringValue("id"), "error", "fstest does not stream files")
+		case "export", "checksums", "restore-attic":
+			send("operation-failed", "operation", cmd.Type, "id", cmd.StringValue("id"),
+				"root", cmd.StringValue("root"), "error", "fstest does not support "+cmd.Type)
+		case "unlock":
+			send("archive-unlocked", "root", cmd.StringValue("root"))
+		case "record-history", "prune-attic", "export-file", "checksums-file", "chunk", "chunk-end", "chunk-ack":
 		case "stop":
 			quit = true
 			wg.Wait()
 			break mainLoop
 		default:
-			panic(fmt.Sprintf("unrecognized type: %q", cmd.Type))
+			log.Debug("unrecognized type", "type", cmd.Type, "cmd", cmd)
 		}
 	}
 
@@ -87,14 +121,18 @@ func scanArchive(root string) {
 	}
 
 	send("archive-scanned", "root", root)
+}
 
+func hashFile(cmd *parser.Message) {
+	defer wg.Done()
+
+	root := cmd.StringValue("root")
+	path := cmd.StringValue("path")
+	name := cmd.StringValue("name")
 	for _, file := range archives[root] {
-		if quit {
-			return
+		if file.name != filepath.Join(path, name) {
+			continue
 		}
-		path := filepath.Dir(file.name)
-		name := filepath.Base(file.name)
-
 		if *progress {
 			for progress := 0; progress < file.size; progress += 50000000 {
 				if quit {
@@ -112,10 +150,69 @@ func scanArchive(root string) {
 			"root", root,
 			"path", path,
 			"name", name,
-			"hash", file.hash)
+			"hash", file.hash,
+			"id", cmd.StringValue("id"))
+		return
 	}
+}
 
-	send("archive-hashed", "root", root)
+func copyFile(cmd *parser.Message) {
+	from := filepath.Join(cmd.StringValue("from-path"), cmd.StringValue("from-name"))
+	root := cmd.StringValue("root")
+	path := cmd.StringValue("path")
+	name := cmd.StringValue("name")
+	for _, file := range archives[cmd.StringValue("from-root")] {
+		if file.name == from {
+			file.name = filepath.Join(path, name)
+			archives[root] = append(archives[root], file)
+			send("file-copied",
+				"root", root,
+				"path", path,
+				"name", name,
+				"size", file.size,
+				"mod-time", file.modTime,
+				"hash", file.hash,
+				"batch", cmd.StringValue("batch"),
+				"step", cmd.StringValue("step"),
+				"id", cmd.StringValue("id"))
+			return
+		}
+	}
+}
+
+func moveFile(cmd *parser.Message) {
+	root := cmd.StringValue("root")
+	from := filepath.Join(cmd.StringValue("path"), cmd.StringValue("name"))
+	for i := range archives[root] {
+		if archives[root][i].name == from {
+			archives[root][i].name = filepath.Join(cmd.StringValue("to-path"), cmd.StringValue("to-name"))
+			send("file-moved",
+				"root", root,
+				"path", cmd.StringValue("path"),
+				"name", cmd.StringValue("name"),
+				"to-path", cmd.StringValue("to-path"),
+				"to-name", cmd.StringValue("to-name"),
+				"batch", cmd.StringValue("batch"),
+				"step", cmd.StringValue("step"),
+				"id", cmd.StringValue("id"))
+			return
+		}
+	}
+}
+
+func deleteFile(cmd *parser.Message) {
+	root := cmd.StringValue("root")
+	name := filepath.Join(cmd.StringValue("path"), cmd.StringValue("name"))
+	archives[root] = slices.DeleteFunc(archives[root], func(file fileMeta) bool {
+		return file.name == name
+	})
+	send("file-deleted",
+		"root", root,
+		"path", cmd.StringValue("path"),
+		"name", cmd.StringValue("name"),
+		"batch", cmd.StringValue("batch"),
+		"step", cmd.StringValue("step"),
+		"id", cmd.StringValue("id"))
 }
 
 func send(kind string, params ...any) {
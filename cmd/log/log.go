@@ -39,7 +39,11 @@ func main() {
 		}
 	}()
 
-	in, out := exec.Start(*execFlag)
+	in, out, err := exec.Start(*execFlag)
+	if err != nil {
+		log.Debug("failed to start", "error", err)
+		return
+	}
 
 	go func() {
 		reader := bufio.NewReader(in)
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"arc/s3test"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var (
+	addr      = flag.String("addr", "127.0.0.1:9000", "listen address")
+	region    = flag.String("region", "us-east-1", "region used in signatures")
+	accessKey = flag.String("access-key", "arc", "access key id")
+	secretKey = flag.String("secret-key", "arc-secret", "secret access key")
+)
+
+func main() {
+	flag.Parse()
+	fmt.Fprintf(os.Stderr, "fake S3 listening on http://%s\n", *addr)
+	if err := http.ListenAndServe(*addr, s3test.NewServer(*region, *accessKey, *secretKey)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
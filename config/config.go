@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func Dir(elem ...string) string {
+	dir := os.Getenv("ARC_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".arc")
+	}
+	return filepath.Join(append([]string{dir}, elem...)...)
+}
+
+func Socket() string {
+	if socket := os.Getenv("ARC_SOCKET"); socket != "" {
+		return socket
+	}
+	return Dir("engine.sock")
+}
+
+func RemoteFS(host string) string {
+	command := os.Getenv("ARC_REMOTE_FS")
+	if command == "" {
+		command = "ssh {host} arc-fs"
+	}
+	return strings.ReplaceAll(command, "{host}", host)
+}
+
+func S3Region() string {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+	return "us-east-1"
+}
+
+func S3Endpoint() string {
+	if endpoint := os.Getenv("ARC_S3_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return "https://s3." + S3Region() + ".amazonaws.com"
+}
+
+func S3Credentials() (accessKey, secretKey string) {
+	return os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+}
+
+func Passphrase() string {
+	return os.Getenv("ARC_PASSPHRASE")
+}
+
+var HashAlgos = []string{"sha256", "sha512"}
+
+var ConflictPolicies = []string{"origin", "keep"}
+
+// Options are the settings the engine runs with. Each is taken from its
+// ARC_* variable, then from the profile, then from the default.
+type Options struct {
+	Hash         string
+	Conflicts    string
+	Paranoid     bool
+	Xattrs       bool
+	MinCopies    int
+	AtticMaxAge  time.Duration
+	AtticMaxSize int
+	Catalogs     int
+	Ignore       []string
+}
+
+func LoadOptions(profile *Profile) Options {
+	value := func(key string) string {
+		if env := os.Getenv(profileOptions[key]); env != "" {
+			return env
+		}
+		if profile != nil {
+			return profile.Options[key]
+		}
+		return ""
+	}
+
+	options := Options{
+		Hash:      HashAlgos[0],
+		Conflicts: ConflictPolicies[0],
+		Paranoid:  flag(value("paranoid")),
+		Xattrs:    flag(value("xattrs")),
+		MinCopies: 1,
+		Catalogs:  30,
+	}
+	if algo := value("hash"); slices.Contains(HashAlgos, algo) {
+		options.Hash = algo
+	}
+	if policy := value("conflicts"); slices.Contains(ConflictPolicies, policy) {
+		options.Conflicts = policy
+	}
+	if copies, err := strconv.Atoi(value("min-copies")); err == nil && copies >= 0 {
+		options.MinCopies = copies
+	}
+	if catalogs, err := strconv.Atoi(value("catalogs")); err == nil && catalogs >= 0 {
+		options.Catalogs = catalogs
+	}
+	options.AtticMaxAge, _ = ParseAge(value("attic-max-age"))
+	options.AtticMaxSize, _ = ParseSize(value("attic-max-size"))
+	if patterns := os.Getenv("ARC_IGNORE"); patterns != "" {
+		options.Ignore = filepath.SplitList(patterns)
+	} else if profile != nil {
+		options.Ignore = profile.Ignore
+	}
+	return options
+}
+
+func flag(value string) bool {
+	return value != "" && value != "0" && value != "false"
+}
+
+func ParseSize(size string) (int, error) {
+	if size == "" {
+		return 0, nil
+	}
+	value, unit := size, 1
+	switch strings.ToUpper(size[len(size)-1:]) {
+	case "K":
+		unit = 1 << 10
+	case "M":
+		unit = 1 << 20
+	case "G":
+		unit = 1 << 30
+	case "T":
+		unit = 1 << 40
+	}
+	if unit > 1 {
+		value = size[:len(size)-1]
+	}
+	n, err := strconv.Atoi(value)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("negative size %s", size)
+	}
+	return n * unit, err
+}
+
+// ParseAge reads an age such as 30d or 12h.
+func ParseAge(age string) (time.Duration, error) {
+	if age == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(age, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n < 0 {
+			err = fmt.Errorf("negative age %s", age)
+		}
+		return time.Duration(n) * 24 * time.Hour, err
+	}
+	duration, err := time.ParseDuration(age)
+	if err == nil && duration < 0 {
+		err = fmt.Errorf("negative age %s", age)
+	}
+	return duration, err
+}
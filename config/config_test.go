@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeProfiles(t *testing.T, content string) {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "profiles")
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ARC_PROFILES", name)
+	for _, env := range profileOptions {
+		t.Setenv(env, "")
+	}
+	t.Setenv("ARC_IGNORE", "")
+}
+
+func TestLoadOptionsPrecedence(t *testing.T) {
+	writeProfiles(t, `[photos]
+root = /a
+ignore = *.tmp
+hash = sha512
+conflicts = keep
+min-copies = 2
+xattrs = 1
+attic-max-age = 30d
+catalogs = 5
+`)
+	profile, err := LoadProfile("photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := LoadOptions(nil)
+	if options.Hash != "sha256" || options.Conflicts != "origin" || options.MinCopies != 1 || options.Catalogs != 30 || options.Xattrs || options.Ignore != nil {
+		t.Errorf("defaults = %+v", options)
+	}
+
+	options = LoadOptions(profile)
+	if options.Hash != "sha512" || options.Conflicts != "keep" || options.MinCopies != 2 || options.Catalogs != 5 || !options.Xattrs ||
+		options.AtticMaxAge != 30*24*time.Hour || !slices.Equal(options.Ignore, []string{"*.tmp"}) {
+		t.Errorf("profile options = %+v", options)
+	}
+	for _, env := range profileOptions {
+		if value := os.Getenv(env); value != "" {
+			t.Errorf("loading the profile set %s=%s", env, value)
+		}
+	}
+
+	t.Setenv("ARC_HASH", "sha256")
+	t.Setenv("ARC_MIN_COPIES", "0")
+	t.Setenv("ARC_IGNORE", "*.bak")
+	options = LoadOptions(profile)
+	if options.Hash != "sha256" || options.MinCopies != 0 || options.Conflicts != "keep" || !slices.Equal(options.Ignore, []string{"*.bak"}) {
+		t.Errorf("environment over profile = %+v", options)
+	}
+}
+
+func TestLoadProfileRejectsInvalidValues(t *testing.T) {
+	for _, line := range []string{
+		"min-copies = two",
+		"min-copies = -1",
+		"catalogs = all",
+		"attic-max-age = soon",
+		"attic-max-age = -3d",
+		"attic-max-size = 10X",
+		"attic-max-size = -1G",
+		"role = owner",
+		"hash = md5",
+		"colour = blue",
+	} {
+		writeProfiles(t, "[p]\nroot = /a\n"+line+"\n")
+		if _, err := LoadProfile("p"); err == nil || !strings.Contains(err.Error(), ":3:") {
+			t.Errorf("%s: got %v", line, err)
+		}
+	}
+}
+
+func TestParseSizeAndAge(t *testing.T) {
+	sizes := map[string]int{"": 0, "512": 512, "2K": 2 << 10, "3m": 3 << 20, "1G": 1 << 30}
+	for text, want := range sizes {
+		if size, err := ParseSize(text); err != nil || size != want {
+			t.Errorf("ParseSize(%q) = %d, %v", text, size, err)
+		}
+	}
+	ages := map[string]time.Duration{"": 0, "2d": 48 * time.Hour, "90m": 90 * time.Minute}
+	for text, want := range ages {
+		if age, err := ParseAge(text); err != nil || age != want {
+			t.Errorf("ParseAge(%q) = %v, %v", text, age, err)
+		}
+	}
+	for _, text := range []string{"-1", "K", "lots"} {
+		if _, err := ParseSize(text); err == nil {
+			t.Errorf("ParseSize(%q) accepted", text)
+		}
+	}
+	for _, text := range []string{"-1d", "-1h", "d", "week"} {
+		if _, err := ParseAge(text); err == nil {
+			t.Errorf("ParseAge(%q) accepted", text)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Root struct {
+	Path  string
+	Role  string
+	Label string
+}
+
+// Members splits a spanning group such as /mnt/a+/mnt/b into its roots.
+// The group is named by the whole path; a single root has no group.
+func (r Root) Members() (roots []string, group string) {
+	roots = strings.Split(r.Path, "+")
+	if len(roots) > 1 {
+		group = r.Path
+	}
+	return roots, group
+}
+
+type Profile struct {
+	Name    string
+	Roots   []Root
+	Ignore  []string
+	Options map[string]string
+}
+
+var Roles = []string{"origin", "mirror", "archive-only", "read-only"}
+
+var profileOptions = map[string]string{
+	"hash":           "ARC_HASH",
+	"conflicts":      "ARC_CONFLICTS",
+	"paranoid":       "ARC_PARANOID",
+	"min-copies":     "ARC_MIN_COPIES",
+	"xattrs":         "ARC_XATTRS",
+	"attic-max-age":  "ARC_ATTIC_MAX_AGE",
+	"attic-max-size": "ARC_ATTIC_MAX_SIZE",
+	"catalogs":       "ARC_CATALOGS",
+}
+
+func ProfilesFile() string {
+	if name := os.Getenv("ARC_PROFILES"); name != "" {
+		return name
+	}
+	return Dir("profiles")
+}
+
+func LoadProfile(name string) (*Profile, error) {
+	file, err := os.Open(ProfilesFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var profile *Profile
+	lines := bufio.NewScanner(file)
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if section, ok := strings.CutPrefix(line, "["); ok {
+			if profile != nil {
+				break
+			}
+			if strings.TrimSuffix(section, "]") == name {
+				profile = &Profile{Name: name, Options: map[string]string{}}
+			}
+			continue
+		}
+		if profile == nil {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", ProfilesFile(), n)
+		}
+		if err := profile.set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", ProfilesFile(), n, err)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	if profile != nil && len(profile.Roots) == 0 {
+		return nil, fmt.Errorf("profile %s has no roots", name)
+	}
+	return profile, nil
+}
+
+func (p *Profile) set(key, value string) error {
+	last := len(p.Roots) - 1
+	switch key {
+	case "root":
+		p.Roots = append(p.Roots, Root{Path: value})
+	case "role":
+		if last < 0 {
+			return errors.New("role before root")
+		}
+		if !slices.Contains(Roles, value) {
+			return fmt.Errorf("unknown role %q", value)
+		}
+		p.Roots[last].Role = value
+	case "label":
+		if last < 0 {
+			return errors.New("label before root")
+		}
+		p.Roots[last].Label = value
+	case "ignore":
+		p.Ignore = append(p.Ignore, value)
+	case "hash":
+		if !slices.Contains(HashAlgos, value) {
+			return fmt.Errorf("unsupported hash %q", value)
+		}
+		p.Options[key] = value
+	case "conflicts":
+		if !slices.Contains(ConflictPolicies, value) {
+			return fmt.Errorf("unsupported conflict policy %q", value)
+		}
+		p.Options[key] = value
+	case "min-copies", "catalogs":
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+		p.Options[key] = value
+	case "attic-max-age":
+		if _, err := ParseAge(value); err != nil {
+			return fmt.Errorf("invalid attic-max-age %q", value)
+		}
+		p.Options[key] = value
+	case "attic-max-size":
+		if _, err := ParseSize(value); err != nil {
+			return fmt.Errorf("invalid attic-max-size %q", value)
+		}
+		p.Options[key] = value
+	default:
+		if _, ok := profileOptions[key]; !ok {
+			return fmt.Errorf("unknown option %q", key)
+		}
+		p.Options[key] = value
+	}
+	return nil
+}
+
+func Roots(args []string) ([]Root, error) {
+	if len(args) == 1 {
+		profile, err := LoadProfile(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if profile != nil {
+			return profile.Roots, nil
+		}
+	}
+	roots := []Root{}
+	for _, arg := range args {
+		root := Root{Path: arg}
+		if role, path, ok := strings.Cut(arg, ":"); ok && slices.Contains(Roles, role) {
+			root.Role, root.Path = role, path
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
@@ -0,0 +1,135 @@
+package crypt
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	chunkSize   = 64 * 1024
+	prefixSize  = 8
+	nonceSize   = 12
+	finalChunk  = 1
+	middleChunk = 0
+)
+
+type Writer struct {
+	out     io.Writer
+	gcm     cipher.AEAD
+	nonce   []byte
+	counter uint32
+	buf     []byte
+	err     error
+}
+
+func NewWriter(out io.Writer, key []byte) (*Writer, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce[:prefixSize]); err != nil {
+		return nil, err
+	}
+	if _, err := out.Write(nonce[:prefixSize]); err != nil {
+		return nil, err
+	}
+	return &Writer{out: out, gcm: gcm, nonce: nonce, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (w *Writer) Write(data []byte) (int, error) {
+	n := 0
+	for len(data) > 0 && w.err == nil {
+		if len(w.buf) == chunkSize {
+			w.seal(middleChunk)
+		}
+		part := min(len(data), chunkSize-len(w.buf))
+		w.buf = append(w.buf, data[:part]...)
+		data = data[part:]
+		n += part
+	}
+	return n, w.err
+}
+
+func (w *Writer) Close() error {
+	if w.err == nil {
+		w.seal(finalChunk)
+	}
+	return w.err
+}
+
+func (w *Writer) seal(kind byte) {
+	binary.BigEndian.PutUint32(w.nonce[prefixSize:], w.counter)
+	w.counter++
+	_, w.err = w.out.Write(w.gcm.Seal(nil, w.nonce, w.buf, []byte{kind}))
+	w.buf = w.buf[:0]
+}
+
+type Reader struct {
+	in      *bufio.Reader
+	gcm     cipher.AEAD
+	nonce   []byte
+	counter uint32
+	buf     []byte
+	done    bool
+}
+
+func NewReader(in io.Reader, key []byte) (*Reader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(in, nonce[:prefixSize]); err != nil {
+		return nil, unexpected(err)
+	}
+	return &Reader{in: bufio.NewReaderSize(in, chunkSize+gcm.Overhead()), gcm: gcm, nonce: nonce}, nil
+}
+
+func (r *Reader) Read(data []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(data, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *Reader) open() error {
+	sealed := make([]byte, chunkSize+r.gcm.Overhead())
+	n, err := io.ReadFull(r.in, sealed)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return unexpected(err)
+	}
+	kind := byte(middleChunk)
+	if err != nil {
+		kind = finalChunk
+	} else if _, err := r.in.Peek(1); err == io.EOF {
+		kind = finalChunk
+	}
+	binary.BigEndian.PutUint32(r.nonce[prefixSize:], r.counter)
+	r.counter++
+	plain, err := r.gcm.Open(sealed[:0], r.nonce, sealed[:n], []byte{kind})
+	if err != nil {
+		return ErrAuth
+	}
+	r.buf = plain
+	r.done = kind == finalChunk
+	return nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -1,43 +1,123 @@
 package engine
 
+import "slices"
+
 func (m *model) analyzeDiscrepancies() {
 	for hash, files := range m.filesByHash {
 		m.analyzeDiscrepancy(hash, files)
 	}
+	for _, archive := range m.archives {
+		m.updateMetas(archive.rootFolder)
+	}
+	for _, c := range m.clients {
+		if c.curRoot != "" {
+			m.sendCurFolder(c)
+		}
+	}
 }
 
-func (m *model) analyzeDiscrepancy(hash string, files []*meta) {
-	discrepancy := false
-	if len(files) != len(m.roots) {
-		discrepancy = true
+func (m *model) reanalyze(hash string) {
+	if !m.ready() {
+		return
 	}
-	if !discrepancy {
-		name := files[0].name
+	files := m.filesByHash[hash]
+	if len(files) == 0 {
+		delete(m.filesByHash, hash)
+		return
+	}
+	m.analyzeDiscrepancy(hash, files)
+	for _, file := range files {
+		file.parent.updateState()
+		m.updateUiEntry(file)
+	}
+}
+
+func (m *model) analyzeDiscrepancy(hash string, files []*meta) {
+	if m.inSync(files) {
 		for _, file := range files {
-			if file.name != name {
-				discrepancy = true
-				break
+			file.state = resolved
+			file.counts = nil
+		}
+		return
+	}
+
+	for _, file := range files {
+		file.state = divergent
+	}
+
+	counts := make([]int, len(m.roots))
+
+	for _, file := range files {
+		for i, root := range m.roots {
+			if root == file.root {
+				counts[i]++
 			}
 		}
 	}
 
-	if discrepancy {
-		for _, file := range files {
-			file.state = divergent
+	for _, file := range files {
+		file.counts = counts
+	}
+}
+
+func (m *model) inSync(files []*meta) bool {
+	units, archived := [][]string{}, [][]string{}
+	originUnit := m.originUnit()
+	for _, unit := range m.copyUnits() {
+		role := m.archives[unit[0]].role
+		if slices.Equal(unit, originUnit) {
+			role = roleOrigin
+		}
+		switch role {
+		case roleReadOnly:
+		case roleArchiveOnly:
+			archived = append(archived, unit)
+		default:
+			units = append(units, unit)
 		}
+	}
 
-		counts := make([]int, len(m.roots))
+	kept := []*meta{}
+	for _, file := range files {
+		for _, unit := range units {
+			if slices.Contains(unit, file.root) {
+				kept = append(kept, file)
+			}
+		}
+	}
+	if len(kept) == 0 {
+		return true
+	}
 
-		for _, file := range files {
-			for i, root := range m.roots {
-				if root == file.root {
-					counts[i]++
-				}
+	for _, unit := range units {
+		n := 0
+		for _, file := range kept {
+			if slices.Contains(unit, file.root) {
+				n++
 			}
 		}
+		if n != 1 {
+			return false
+		}
+	}
+	name := kept[0].name
+	path := kept[0].folderPath()
+	for _, file := range kept {
+		if file.name != name || file.folderPath() != path {
+			return false
+		}
+	}
 
+	for _, unit := range archived {
+		found := false
 		for _, file := range files {
-			file.counts = counts
+			if slices.Contains(unit, file.root) && file.name == name && file.folderPath() == path {
+				found = true
+			}
+		}
+		if !found {
+			return false
 		}
 	}
+	return true
 }
@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"arc/parser"
+	"fmt"
+)
+
+func (m *model) listAttic(root string) {
+	if m.archives[root] == nil {
+		m.reply("error", "error", "Unknown archive "+root)
+		return
+	}
+	m.atticClient = m.client
+	m.sendToFs(root, "list-attic", "root", root)
+}
+
+func (m *model) atticEntry(msg *parser.Message) {
+	if c := m.atticClient; c != nil {
+		c.send(msg.Type, params(msg)...)
+	}
+}
+
+func (m *model) atticListed(root string) {
+	if c := m.atticClient; c != nil {
+		c.send("show-attic", "root", root)
+	}
+	m.atticClient = nil
+}
+
+func (m *model) restoreAttic(root, trash, path, name string) {
+	if m.archives[root] == nil {
+		m.reply("error", "error", "Unknown archive "+root)
+		return
+	}
+	if !m.ready() {
+		m.reply("error", "error", "Archives are not hashed yet")
+		return
+	}
+	if err := m.allows(root, "copy"); err != nil {
+		m.reply("error", "error", err.Error())
+		return
+	}
+	if file := m.find(root, path, name); file != nil {
+		if err := m.allows(root, "overwrite"); err != nil {
+			m.reply("error", "error", err.Error())
+			return
+		}
+		if err := m.keepsCopies("overwrite", file, false); err != nil {
+			m.reply("error", "error", err.Error())
+			return
+		}
+	}
+	m.batch = newBatch()
+	m.sendToFs(root, "restore-attic", "root", root, "trash", trash, "batch", m.batch)
+}
+
+func (m *model) pruneAttic(root string) {
+	if m.atticMaxAge <= 0 && m.atticMaxSize <= 0 {
+		return
+	}
+	m.sendToFs(root, "prune-attic",
+		"root", root,
+		"max-age", int(m.atticMaxAge.Seconds()),
+		"max-size", m.atticMaxSize)
+}
+
+func (m *model) atticPruned(root string, files, size int) {
+	m.sendToUi("status", "status", fmt.Sprintf("Pruned %d files (%d bytes) from the attic of %s", files, size, root))
+}
@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"arc/transport"
+	"strings"
+	"testing"
+)
+
+func TestRestoreAtticFollowsRoles(t *testing.T) {
+	m, fs := newTestModel(t, "/a", "/b", "/c")
+	m.archives["/c"].role = roleArchiveOnly
+	addFile(m, "/a", "", "x", "h1")
+	addFile(m, "/c", "", "x", "h1")
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+
+	refused := func(root, name, want string) {
+		t.Helper()
+		m.restoreAttic(root, "t1", "", name)
+		msg, err := ui.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != "error" || !strings.Contains(msg.StringValue("error"), want) {
+			t.Errorf("restore to %s/%s: %v", root, name, msg)
+		}
+	}
+	refused("/a", "y", "refusing to copy on origin root /a")
+	refused("/c", "x", "refusing to overwrite on archive-only root /c")
+
+	for _, root := range []string{"/b", "/c"} {
+		m.restoreAttic(root, "t1", "", "y")
+		msg, err := fs.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != "restore-attic" || msg.StringValue("root") != root {
+			t.Errorf("restore to %s sent %v", root, msg)
+		}
+	}
+}
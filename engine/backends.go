@@ -0,0 +1,268 @@
+package engine
+
+import (
+	"arc/log"
+	"arc/parser"
+	"arc/transport"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Connector func(host string) transport.Conn
+
+const reconnectInterval = 5 * time.Second
+
+type backend struct {
+	host         string
+	conn         transport.Conn
+	rootsLock    sync.Mutex
+	roots        map[string]string
+	lost         bool
+	reconnecting bool
+	stopping     atomic.Bool
+}
+
+func parseRoot(root string) (host, path string) {
+	rest, ok := strings.CutPrefix(root, "ssh://")
+	if !ok {
+		return "", root
+	}
+	host, path, _ = strings.Cut(rest, "/")
+	return host, "/" + path
+}
+
+func (m *model) backend(root string) *backend {
+	host, path := parseRoot(root)
+	b := m.backends[host]
+	if b == nil {
+		log.Debug("starting backend", "host", host)
+		b = &backend{
+			host:  host,
+			conn:  m.connect(host),
+			roots: map[string]string{},
+		}
+		m.backends[host] = b
+		go m.readBackend(b)
+	}
+	b.rootsLock.Lock()
+	if _, ok := b.roots[path]; !ok {
+		b.roots[path] = root
+	}
+	b.rootsLock.Unlock()
+	return b
+}
+
+// root maps a path reported by the backend back to the engine's root name.
+func (b *backend) root(path string) (string, bool) {
+	b.rootsLock.Lock()
+	defer b.rootsLock.Unlock()
+	root, ok := b.roots[path]
+	return root, ok
+}
+
+func (m *model) readBackend(b *backend) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Debug("ERROR", "host", b.host, "err", err)
+			log.Debug("STACK", "stack", debug.Stack())
+			m.backendFailed(b)
+		}
+	}()
+
+	for !m.quitting() {
+		msg, err := b.conn.Receive()
+		if err != nil {
+			log.Debug("receive failed", "host", b.host, "error", err)
+			m.backendFailed(b)
+			return
+		}
+		for _, param := range []string{"root", "from-root"} {
+			if root, ok := b.root(msg.Params[param]); ok {
+				msg.Params[param] = root
+			}
+		}
+		if msg.Type == "stopped" && !b.stopping.Load() {
+			log.Debug("backend stopped unexpectedly", "host", b.host)
+			m.backendFailed(b)
+			return
+		}
+		m.post(event{msg: msg})
+		if msg.Type == "stopped" {
+			return
+		}
+	}
+}
+
+func (m *model) backendFailed(b *backend) {
+	select {
+	case m.lost <- b:
+	case <-m.quit:
+	}
+}
+
+func (m *model) backendLost(b *backend) {
+	log.Debug("backend lost", "host", b.host)
+	b.lost = true
+	roots := map[string]bool{}
+	for _, root := range b.roots {
+		roots[root] = true
+		m.archiveOffline(root)
+	}
+	for _, queue := range m.queues {
+		for _, t := range slices.Clone(queue) {
+			if !roots[t.lane] && !roots[t.cmd.StringValue("from-root")] {
+				continue
+			}
+			m.removeTask(t)
+			if t.running {
+				m.stopSource(t)
+			}
+			m.stepFinished(t.cmd.StringValue("batch"), t.cmd.StringValue("step"), "failed")
+			m.taskAborted(t)
+		}
+	}
+	if !b.reconnecting {
+		m.sendToUi("error", "error", "Lost connection to the "+backendName(b)+" backend, reconnecting")
+	}
+	if m.stopping > 0 {
+		m.backendStopped()
+	} else {
+		go func() {
+			time.Sleep(reconnectInterval)
+			m.post(event{msg: &parser.Message{Type: "reconnect", Params: map[string]string{"host": b.host}}})
+		}()
+	}
+	m.dispatch()
+}
+
+func (m *model) reconnect(host string) {
+	b := m.backends[host]
+	if b == nil || !b.lost || m.stopping > 0 {
+		return
+	}
+	log.Debug("reconnecting backend", "host", host)
+	b.conn = m.connect(host)
+	b.lost = false
+	b.reconnecting = true
+	go m.readBackend(b)
+	for _, root := range b.roots {
+		archive := m.archives[root]
+		if archive == nil {
+			continue
+		}
+		archive.state = archiveScanning
+		m.sendArchiveInfo(nil, archive)
+		m.rescan(archive)
+	}
+}
+
+func (m *model) backendAlive(root string) {
+	host, _ := parseRoot(root)
+	if b := m.backends[host]; b != nil && b.reconnecting {
+		b.reconnecting = false
+		m.sendToUi("status", "status", "Reconnected to the "+backendName(b)+" backend")
+	}
+}
+
+func backendName(b *backend) string {
+	if b.host == "" {
+		return "local"
+	}
+	return b.host
+}
+
+func (m *model) sendToFs(root string, kind string, params ...any) {
+	b := m.backend(root)
+	if b.lost {
+		log.Debug("backend lost, dropping", "host", b.host, "kind", kind)
+		return
+	}
+	params = append([]any{}, params...)
+	for i := 0; i < len(params)-1; i += 2 {
+		if name := params[i]; name != "root" && name != "from-root" {
+			continue
+		}
+		if value, ok := params[i+1].(string); ok {
+			if host, path := parseRoot(value); host == b.host {
+				params[i+1] = path
+			}
+		}
+	}
+	b.conn.Send(kind, params...)
+}
+
+func (m *model) sameBackend(root, other string) bool {
+	host, _ := parseRoot(root)
+	otherHost, _ := parseRoot(other)
+	return host == otherHost
+}
+
+func (m *model) start(t *task) {
+	cmd := t.cmd
+	root := cmd.StringValue("root")
+	fromRoot := cmd.StringValue("from-root")
+	if fromRoot == "" || m.sameBackend(root, fromRoot) {
+		m.sendToFs(root, cmd.Type, params(cmd)...)
+		return
+	}
+
+	m.sendToFs(root, cmd.Type, append(params(cmd),
+		"stream", "true",
+		"size", t.file.size,
+		"mod-time", t.file.modTime)...)
+	m.sendToFs(fromRoot, "read",
+		"id", t.id,
+		"root", fromRoot,
+		"path", cmd.StringValue("from-path"),
+		"name", cmd.StringValue("from-name"))
+}
+
+func (m *model) stopTask(t *task) {
+	m.sendToFs(t.lane, "cancel", "id", t.id)
+	m.stopSource(t)
+}
+
+func (m *model) stopSource(t *task) {
+	if fromRoot := t.cmd.StringValue("from-root"); fromRoot != "" && !m.sameBackend(t.lane, fromRoot) {
+		m.sendToFs(fromRoot, "cancel", "id", t.id)
+	}
+}
+
+func (m *model) forwardChunk(msg *parser.Message) {
+	if t := m.tasks[msg.StringValue("id")]; t != nil {
+		m.sendToFs(t.lane, msg.Type, params(msg)...)
+	}
+}
+
+func (m *model) forwardAck(msg *parser.Message) {
+	if t := m.tasks[msg.StringValue("id")]; t != nil {
+		m.sendToFs(t.cmd.StringValue("from-root"), msg.Type, params(msg)...)
+	}
+}
+
+func (m *model) stop() {
+	m.stopping = 0
+	for _, b := range m.backends {
+		if !b.lost {
+			b.stopping.Store(true)
+			b.conn.Send("stop")
+			m.stopping++
+		}
+	}
+	if m.stopping == 0 {
+		m.sendToUi("stopped")
+		m.shutDown()
+	}
+}
+
+func (m *model) backendStopped() {
+	m.stopped++
+	if m.stopped == m.stopping {
+		m.sendToUi("stopped")
+		m.shutDown()
+	}
+}
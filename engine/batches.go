@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"arc/parser"
+	"cmp"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+type batchInfo struct {
+	batch  string
+	time   time.Time
+	ops    int
+	roots  []string
+	undone bool
+	pruned bool
+}
+
+func (m *model) undo(batch string) {
+	if m.run != nil {
+		m.reply("error", "error", "Cannot undo while batch "+m.run.batch+" is running")
+		return
+	}
+	if batch == "" {
+		batch = m.batch
+	}
+	if batch == "" {
+		m.reply("error", "error", "Nothing to undo")
+		return
+	}
+	for _, root := range m.roots {
+		m.planUndo(root, batch)
+	}
+	if batch == m.batch {
+		m.batch = ""
+	}
+}
+
+func (m *model) planUndo(root, batch string) {
+	m.sendToFs(root, "undo", "root", root, "batch", batch, "plan", "true")
+}
+
+func (m *model) checkUndoStep(msg *parser.Message) {
+	root := msg.StringValue("root")
+	key := root + " " + msg.StringValue("batch")
+	if m.undoRefused[key] != nil {
+		return
+	}
+	if err := m.undoSafety(root, msg); err != nil {
+		m.undoRefused[key] = err
+	}
+}
+
+func (m *model) undoSafety(root string, step *parser.Message) error {
+	path := step.StringValue("path")
+	name := step.StringValue("name")
+	switch step.StringValue("op") {
+	case "copy", "restore":
+		if err := m.allows(root, "delete"); err != nil {
+			return err
+		}
+		return m.keepsCopies("delete", m.find(root, path, name), false)
+
+	case "move":
+		if err := m.allows(root, "write"); err != nil {
+			return err
+		}
+		file := m.find(root, step.StringValue("to-path"), step.StringValue("to-name"))
+		target := m.find(root, path, name)
+		if target != nil && target != file && (file == nil || target.hash != file.hash) {
+			if err := m.allows(root, "overwrite"); err != nil {
+				return err
+			}
+			return m.keepsCopies("overwrite", target, false)
+		}
+
+	case "delete":
+		if err := m.allows(root, "write"); err != nil {
+			return err
+		}
+		target := m.find(root, path, name)
+		if target != nil && target.hash != step.StringValue("hash") {
+			if err := m.allows(root, "overwrite"); err != nil {
+				return err
+			}
+			return m.keepsCopies("overwrite", target, false)
+		}
+	}
+	return nil
+}
+
+func (m *model) undoPlanned(msg *parser.Message) {
+	root := msg.StringValue("root")
+	batch := msg.StringValue("batch")
+	key := root + " " + batch
+	err := m.undoRefused[key]
+	delete(m.undoRefused, key)
+	if reason := msg.StringValue("error"); reason != "" {
+		err = errors.New(reason)
+	}
+	if err != nil {
+		m.sendToUi("error", "error", "Not undoing "+batch+" on "+root+": "+err.Error())
+		m.batchUndone(msg)
+		return
+	}
+	m.sendToFs(root, "undo", "root", root, "batch", batch)
+}
+
+func (m *model) listBatches() {
+	m.batches = map[string]*batchInfo{}
+	m.batchClient = m.client
+	m.batchLists = map[string]bool{}
+	for _, root := range m.roots {
+		if !m.offline(root) {
+			m.batchLists[root] = true
+			m.sendToFs(root, "list-batches", "root", root)
+		}
+	}
+	if len(m.batchLists) == 0 {
+		m.sendBatches()
+	}
+}
+
+func (m *model) addBatch(msg *parser.Message) {
+	id := msg.StringValue("batch")
+	info := m.batches[id]
+	if info == nil {
+		info = &batchInfo{
+			batch:  id,
+			time:   msg.Time("time"),
+			undone: true,
+		}
+		m.batches[id] = info
+	}
+	info.ops += msg.Int("ops")
+	info.roots = append(info.roots, msg.StringValue("root"))
+	info.undone = info.undone && msg.StringValue("undone") == "true"
+	info.pruned = info.pruned || msg.StringValue("pruned") == "true"
+}
+
+// batchesListed is also called for roots that failed to list their batches or
+// went offline, so the listing does not wait for them forever.
+func (m *model) batchesListed(root string) {
+	if !m.batchLists[root] {
+		return
+	}
+	delete(m.batchLists, root)
+	if len(m.batchLists) == 0 {
+		m.sendBatches()
+	}
+}
+
+func (m *model) sendBatches() {
+	c := m.batchClient
+	m.batchClient = nil
+	if c == nil {
+		return
+	}
+
+	batches := make([]*batchInfo, 0, len(m.batches))
+	for _, info := range m.batches {
+		batches = append(batches, info)
+	}
+	slices.SortFunc(batches, func(a, b *batchInfo) int {
+		return cmp.Compare(b.batch, a.batch)
+	})
+
+	for _, info := range batches {
+		undone, pruned := "false", "false"
+		if info.undone {
+			undone = "true"
+		}
+		if info.pruned {
+			pruned = "true"
+		}
+		c.send("batch",
+			"batch", info.batch,
+			"time", info.time,
+			"ops", info.ops,
+			"roots", strings.Join(info.roots, ", "),
+			"undone", undone,
+			"pruned", pruned)
+	}
+	c.send("show-batches")
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"arc/parser"
+	"arc/transport"
+	"strings"
+	"testing"
+)
+
+func TestBatchListingSkipsUnavailableRoots(t *testing.T) {
+	m, fs := newTestModel(t, "/a", "/b", "/c", "/d")
+	m.archives["/c"].state = archiveOffline
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+
+	m.handleEvent(&parser.Message{Type: "list-batches"})
+	listed := []string{}
+	for i := 0; i < 3; i++ {
+		msg, err := fs.Receive()
+		if err != nil || msg.Type != "list-batches" {
+			t.Fatalf("got %v, %v", msg, err)
+		}
+		listed = append(listed, msg.StringValue("root"))
+	}
+	if strings.Join(listed, " ") != "/a /b /d" {
+		t.Errorf("listed %v", listed)
+	}
+
+	m.handleEvent(&parser.Message{Type: "batch", Params: map[string]string{"root": "/a", "batch": "b1", "time": "2024-01-02T03:04:05Z", "ops": "2"}})
+	m.handleEvent(&parser.Message{Type: "batches-listed", Params: map[string]string{"root": "/a"}})
+	m.handleEvent(&parser.Message{Type: "operation-failed", Params: map[string]string{"operation": "list-batches", "root": "/b", "error": "broken"}})
+	if len(m.batchLists) != 1 {
+		t.Fatalf("still listing %v", m.batchLists)
+	}
+	m.handleEvent(&parser.Message{Type: "archive-offline", Params: map[string]string{"root": "/d"}})
+
+	for {
+		msg, err := ui.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "batch" && msg.StringValue("batch") != "b1" {
+			t.Errorf("got %v", msg)
+		}
+		if msg.Type == "show-batches" {
+			break
+		}
+	}
+}
+
+func TestUndoRefusedDuringRun(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+	if err := m.startRun("b1", testSteps(), true); err != nil {
+		t.Fatal(err)
+	}
+	m.batch = "b1"
+
+	m.handleEvent(&parser.Message{Type: "undo", Params: map[string]string{"batch": "b0"}})
+	msg, err := ui.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "error" || !strings.Contains(msg.StringValue("error"), "b1 is running") {
+		t.Errorf("got %v", msg)
+	}
+	if m.batch != "b1" || m.run.rollingBack {
+		t.Errorf("undo during a run changed batch %q, rolling back %v", m.batch, m.run.rollingBack)
+	}
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"arc/catalog"
+	"arc/config"
+	"arc/log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+func catalogName(archive *archive, at time.Time) string {
+	dir := archive.id
+	if dir == "" {
+		dir = url.PathEscape(archive.root)
+	}
+	return config.Dir("catalogs", dir, at.UTC().Format("2006-01-02T15-04-05Z")+".catalog")
+}
+
+func (m *model) saveCatalog(root string) {
+	cat := &catalog.Catalog{
+		Root:   root,
+		ID:     m.archives[root].id,
+		Volume: m.archives[root].volume,
+		Algo:   m.hashAlgo,
+		Time:   time.Now(),
+	}
+	m.archives[root].rootFolder.walk(func(file *meta) {
+		cat.Entries = append(cat.Entries, catalog.Entry{
+			Path:    file.fullPath(),
+			Size:    file.size,
+			ModTime: file.modTime,
+			Hash:    file.hash,
+		})
+	})
+
+	name := catalogName(m.archives[root], cat.Time)
+	if err := catalog.Write(name, cat); err != nil {
+		log.Debug("failed to save catalog", "root", root, "error", err)
+		return
+	}
+	log.Debug("saved catalog", "root", root, "name", name)
+	m.pruneCatalogs(filepath.Dir(name))
+}
+
+// pruneCatalogs keeps the newest m.catalogs catalogs in dir. Catalog names
+// are timestamps, so they sort by age.
+func (m *model) pruneCatalogs(dir string) {
+	if m.catalogs == 0 {
+		return
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.catalog"))
+	if err != nil || len(names) <= m.catalogs {
+		return
+	}
+	slices.Sort(names)
+	for _, name := range names[:len(names)-m.catalogs] {
+		if err := os.Remove(name); err != nil {
+			log.Debug("failed to remove catalog", "name", name, "error", err)
+		}
+	}
+}
+
+func (m *model) diff(from, to string) {
+	fromCatalog, err := catalog.Read(from)
+	if err != nil {
+		log.Debug("failed to read catalog", "name", from, "error", err)
+		m.reply("error", "error", err.Error())
+		return
+	}
+	toCatalog, err := catalog.Read(to)
+	if err != nil {
+		log.Debug("failed to read catalog", "name", to, "error", err)
+		m.reply("error", "error", err.Error())
+		return
+	}
+	if !catalog.SameArchive(fromCatalog, toCatalog) {
+		m.reply("error", "error", "Catalogs of different archives: "+fromCatalog.Root+" and "+toCatalog.Root)
+		return
+	}
+
+	root := "diff " + filepath.Base(from) + " → " + filepath.Base(to)
+	rootFolder := &meta{
+		kind:     kindFolder,
+		root:     root,
+		children: map[string]*meta{},
+	}
+	m.diffs[root] = rootFolder
+
+	diff := catalog.Compare(fromCatalog, toCatalog)
+	for _, change := range diff.Changes {
+		path := filepath.Dir(change.Path)
+		if path == "." {
+			path = ""
+		}
+		name := filepath.Base(change.Path)
+		if change.Kind == catalog.Moved {
+			name += " ← " + change.OldPath
+		}
+		folder := makeFolder(rootFolder, path)
+		folder.addChild(&meta{
+			kind:    kindRegular,
+			root:    root,
+			name:    name,
+			parent:  folder,
+			size:    change.Size,
+			modTime: change.ModTime,
+			hash:    change.Hash,
+			change:  change.Kind.String(),
+		})
+	}
+	m.updateMetas(rootFolder)
+	rootFolder.walkFolders(func(folder *meta) {
+		if totals := diff.Folders[folder.fullPath()]; totals != nil {
+			folder.change = totals.String()
+		}
+	})
+
+	if c := m.client; c != nil {
+		c.curRoot = root
+		c.curPath = ""
+		m.sendCurFolder(c)
+	}
+	m.dropDiffs()
+}
+
+// dropDiffs forgets the diffs no client is looking at.
+func (m *model) dropDiffs() {
+	for root := range m.diffs {
+		if !slices.ContainsFunc(m.clients, func(c *client) bool { return c.curRoot == root }) {
+			delete(m.diffs, root)
+		}
+	}
+}
+
+func (m *meta) walk(visit func(file *meta)) {
+	for _, child := range m.children {
+		if child.kind == kindFolder {
+			child.walk(visit)
+		} else {
+			visit(child)
+		}
+	}
+}
+
+func (m *meta) walkFolders(visit func(folder *meta)) {
+	visit(m)
+	for _, child := range m.children {
+		if child.kind == kindFolder {
+			child.walkFolders(visit)
+		}
+	}
+}
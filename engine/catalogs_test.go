@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"arc/catalog"
+	"arc/parser"
+	"arc/transport"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiffIsNotAnArchive(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	addFile(m, "/a", "", "x", "h1").state = divergent
+	dir := t.TempDir()
+	from, to := filepath.Join(dir, "from.catalog"), filepath.Join(dir, "to.catalog")
+	catalog.Write(from, &catalog.Catalog{Root: "/a", Time: time.Now()})
+	catalog.Write(to, &catalog.Catalog{Root: "/a", Time: time.Now(), Entries: []catalog.Entry{{Path: "x", Size: 1, Hash: "h1"}}})
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+
+	m.diff(from, to)
+	root, names := "", []string{}
+	for {
+		msg, err := ui.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "current-folder" {
+			root = msg.StringValue("root")
+		} else if msg.Type == "update-entry" {
+			names = append(names, msg.StringValue("name"))
+		} else if msg.Type == "show-folder" {
+			break
+		}
+	}
+	if m.diffs[root] == nil || m.archives[root] != nil || len(names) != 1 || names[0] != "x" {
+		t.Fatalf("diff %q shown with %v", root, names)
+	}
+
+	m.resolveEntry(root, "", "x")
+	if msg, _ := ui.Receive(); msg.Type != "error" || m.run != nil {
+		t.Errorf("resolving a diff entry: got %v, run %v", msg, m.run)
+	}
+	m.handleEvent(&parser.Message{Type: "set-current-folder", Params: map[string]string{"root": "/a", "path": ""}})
+	m.handleEvent(&parser.Message{Type: "set-current-folder", Params: map[string]string{"root": root, "path": ""}})
+	for _, want := range []string{"/a", root} {
+		for {
+			msg, err := ui.Receive()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type == "current-folder" {
+				if msg.StringValue("root") != want {
+					t.Errorf("browsed %v, want %s", msg, want)
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestSaveCatalogKeepsNewest(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	m.catalogs = 2
+	addFile(m, "/a", "", "x", "h1")
+	dir := filepath.Dir(catalogName(m.archives["/a"], time.Now()))
+	old := []string{}
+	for i := 1; i <= 3; i++ {
+		name := catalogName(m.archives["/a"], time.Date(2024, 1, i, 0, 0, 0, 0, time.UTC))
+		catalog.Write(name, &catalog.Catalog{Root: "/a", ID: "id-/a"})
+		old = append(old, name)
+	}
+
+	m.saveCatalog("/a")
+	names, _ := filepath.Glob(filepath.Join(dir, "*.catalog"))
+	if len(names) != 2 || names[0] != old[2] {
+		t.Errorf("kept %v, want the newest two", names)
+	}
+
+	m.catalogs = 0
+	catalog.Write(old[0], &catalog.Catalog{Root: "/a", ID: "id-/a"})
+	m.pruneCatalogs(dir)
+	if names, _ := filepath.Glob(filepath.Join(dir, "*.catalog")); len(names) != 3 {
+		t.Errorf("kept %v with no limit", names)
+	}
+}
+
+func TestDiffRefusesOtherArchives(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+	dir := t.TempDir()
+	write := func(name, root, id string) string {
+		name = filepath.Join(dir, name)
+		catalog.Write(name, &catalog.Catalog{Root: root, ID: id, Time: time.Now()})
+		return name
+	}
+
+	for _, names := range [][2]string{
+		{write("a1", "/a", "id-a"), write("b1", "/b", "id-b")},
+		{write("a2", "/a", "id-a"), write("a3", "/a", "id-other")},
+		{write("c1", "/c", ""), write("d1", "/d", "")},
+	} {
+		m.diff(names[0], names[1])
+		if msg, err := ui.Receive(); err != nil || msg.Type != "error" {
+			t.Errorf("diff of %v: got %v, %v", names, msg, err)
+		}
+	}
+	if len(m.diffs) != 0 {
+		t.Errorf("diffs %v", m.diffs)
+	}
+
+	// A moved archive keeps its ID.
+	m.diff(write("a4", "/a", "id-a"), write("a5", "/mnt/a", "id-a"))
+	if len(m.diffs) != 1 {
+		t.Errorf("diff of a moved archive refused")
+	}
+}
+
+func TestDiffsAreDroppedWhenNotShown(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	dir := t.TempDir()
+	names := []string{}
+	for _, name := range []string{"one", "two", "three"} {
+		name = filepath.Join(dir, name)
+		catalog.Write(name, &catalog.Catalog{Root: "/a", Time: time.Now()})
+		names = append(names, name)
+	}
+	_, first := transport.Pipe()
+	_, second := transport.Pipe()
+	c1, c2 := m.addClient(first), m.addClient(second)
+
+	m.client = c1
+	m.diff(names[0], names[1])
+	m.client = c2
+	m.diff(names[0], names[2])
+	if len(m.diffs) != 2 {
+		t.Fatalf("diffs shown to two clients: %d", len(m.diffs))
+	}
+	m.client = c1
+	m.diff(names[1], names[2])
+	if len(m.diffs) != 2 || m.diffs[c1.curRoot] == nil || m.diffs[c2.curRoot] == nil {
+		t.Errorf("diffs after a new one: %v", m.diffs)
+	}
+	m.removeClient(c2)
+	if len(m.diffs) != 1 || m.diffs[c1.curRoot] == nil {
+		t.Errorf("diffs after a client left: %v", m.diffs)
+	}
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+func (m *model) writeChecksums(root, path, name, format, target string) {
+	if format == "" {
+		format = "sha256"
+	}
+	if format != "sha256" && format != "md5" && format != "sfv" {
+		m.reply("error", "error", "Unknown checksum format "+format)
+		return
+	}
+	entry, files := m.selectFiles(root, path, name)
+	if files == nil {
+		return
+	}
+	if target == "" {
+		if m.archives[root].readOnly {
+			m.reply("error", "error", "refusing to write checksums on read-only root "+root)
+			return
+		}
+		if err := m.allows(root, "write checksums"); err != nil {
+			m.reply("error", "error", err.Error())
+			return
+		}
+	}
+	base := entry.fullPath()
+	if entry.kind == kindRegular {
+		base = entry.folderPath()
+	}
+
+	m.lastTaskId++
+	id := "checksums-" + strconv.Itoa(m.lastTaskId)
+	m.exports[id] = root
+	for _, file := range files {
+		m.sendToFs(root, "checksums-file",
+			"id", id,
+			"path", file.folderPath(),
+			"name", file.name,
+			"size", file.size,
+			"mod-time", file.modTime,
+			"hash", file.hash)
+	}
+	m.sendToFs(root, "checksums",
+		"id", id,
+		"root", root,
+		"path", base,
+		"format", format,
+		"target", target,
+		"batch", newBatch(),
+		"keep-existing", strconv.FormatBool(m.allows(root, "overwrite") != nil))
+	m.reply("checksums-started", "id", id)
+}
+
+func (m *model) checksumsProgress(target string, progress, size int) {
+	percent := 100
+	if size > 0 {
+		percent = progress * 100 / size
+	}
+	m.sendToUi("status", "status", fmt.Sprintf("Writing checksums %s: %d%%", target, percent))
+}
+
+func (m *model) checksumsWritten(id, target string, files int) {
+	delete(m.exports, id)
+	m.sendToUi("status", "status", fmt.Sprintf("Wrote checksums of %d files to %s", files, target))
+}
+
+func (m *model) checksumMismatch(root, path, name, manifest, kind string) {
+	m.sendToUi("error", "error", fmt.Sprintf("%s does not match its %s checksum in %s",
+		root+"/"+filepath.Join(path, name), kind, root+"/"+manifest))
+}
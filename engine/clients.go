@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"arc/log"
+	"arc/parser"
+	"arc/transport"
+	"slices"
+	"time"
+)
+
+type client struct {
+	conn         transport.Conn
+	out          chan outgoing
+	done         chan struct{}
+	closed       bool
+	curRoot      string
+	curPath      string
+	queueWatched bool
+	queueSent    time.Time
+}
+
+type outgoing struct {
+	kind   string
+	params []any
+}
+
+const clientQueueSize = 1 << 16
+
+type event struct {
+	from *client
+	msg  *parser.Message
+}
+
+func (m *model) addClient(conn transport.Conn) *client {
+	c := &client{
+		conn: conn,
+		out:  make(chan outgoing, clientQueueSize),
+		done: make(chan struct{}),
+	}
+	go c.write()
+	m.clients = append(m.clients, c)
+	log.Debug("ui attached", "clients", len(m.clients))
+	return c
+}
+
+func (m *model) removeClient(c *client) {
+	m.clients = slices.DeleteFunc(m.clients, func(other *client) bool { return other == c })
+	if m.batchClient == c {
+		m.batchClient = nil
+	}
+	if m.atticClient == c {
+		m.atticClient = nil
+	}
+	c.close()
+	c.conn.Close()
+	m.dropDiffs()
+	log.Debug("ui detached", "clients", len(m.clients))
+}
+
+func (m *model) flushClients() {
+	for _, c := range m.clients {
+		c.close()
+		select {
+		case <-c.done:
+		case <-time.After(time.Second):
+			log.Debug("client did not drain its queue")
+		}
+	}
+}
+
+func (m *model) attach(c *client) {
+	for _, root := range m.roots {
+		c.send("archive", "root", root)
+		m.sendArchiveInfo(c, m.archives[root])
+	}
+	if c.curRoot == "" && len(m.roots) > 0 {
+		c.curRoot = m.origin()
+	}
+	if c.curRoot != "" {
+		m.sendCurFolder(c)
+	}
+	m.sendQueueStatus()
+}
+
+func (c *client) send(kind string, params ...any) {
+	if c.closed {
+		return
+	}
+	select {
+	case c.out <- outgoing{kind: kind, params: params}:
+	default:
+		log.Debug("client is not reading, dropping it")
+		c.close()
+		c.conn.Close()
+	}
+}
+
+func (c *client) write() {
+	defer close(c.done)
+	for msg := range c.out {
+		c.conn.Send(msg.kind, msg.params...)
+	}
+}
+
+func (c *client) close() {
+	if !c.closed {
+		c.closed = true
+		close(c.out)
+	}
+}
+
+func (m *model) sendToUi(kind string, params ...any) {
+	for _, c := range m.clients {
+		c.send(kind, params...)
+	}
+}
+
+func (m *model) reply(kind string, params ...any) {
+	if m.req != "" {
+		params = append([]any{"req", m.req}, params...)
+	}
+	if m.client == nil {
+		m.sendToUi(kind, params...)
+		return
+	}
+	m.client.send(kind, params...)
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"arc/parser"
+	"arc/transport"
+	"strings"
+	"testing"
+)
+
+func TestParanoidDeleteWithoutOriginCopy(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b", "/c")
+	m.archives["/c"].role = roleArchiveOnly
+	m.paranoid = true
+	m.kept = map[*meta]bool{}
+	addFile(m, "/b", "", "x", "h1")
+	kept := addFile(m, "/c", "", "x", "h1")
+
+	ops := m.plan(m.filesByHash["h1"])
+	if len(ops) != 1 || ops[0].kind != opDelete || ops[0].file.root != "/b" {
+		t.Fatalf("planned %v", ops)
+	}
+	if ops[0].from != kept {
+		t.Errorf("delete witnessed by %v, want the archive-only copy", ops[0].from)
+	}
+	cmd := ops[0].command("b1")
+	if cmd.StringValue("from-root") != "/c" || cmd.StringValue("from-name") != "x" {
+		t.Errorf("delete command = %v", cmd)
+	}
+
+	m.paranoid = false
+	if ops := m.plan(m.filesByHash["h1"]); ops[0].from != nil {
+		t.Errorf("delete witnessed by %v without paranoid", ops[0].from)
+	}
+}
+
+func startCompare(t *testing.T) (*model, transport.Conn, transport.Conn, string) {
+	t.Helper()
+	m, fs := newTestModel(t, "/a", "/b")
+	m.paranoid = true
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+	for _, file := range []*meta{addFile(m, "/a", "", "x", "h1"), addFile(m, "/b", "", "x", "h1"), addFile(m, "/a", "", "y", "h2")} {
+		file.state = divergent
+	}
+
+	m.resolve([]string{"h1", "h2"}, false)
+	msg, err := fs.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "compare" || msg.StringValue("root") != "/b" || msg.StringValue("from-root") != "/a" || msg.StringValue("step") != "0" {
+		t.Fatalf("got %v", msg)
+	}
+	return m, fs, ui, msg.StringValue("id")
+}
+
+func TestCompareMatches(t *testing.T) {
+	m, _, _, id := startCompare(t)
+	m.handleEvent(&parser.Message{Type: "files-compared", Params: map[string]string{"root": "/b", "path": "", "name": "x", "id": id}})
+	if m.run == nil || m.run.status["0"] != "done" {
+		t.Errorf("compare step = %v", m.run)
+	}
+	if m.tasks[id] != nil {
+		t.Error("compare task still queued")
+	}
+}
+
+func TestCompareMismatchFailsTheStep(t *testing.T) {
+	m, _, ui, id := startCompare(t)
+	params := map[string]string{"root": "/b", "path": "", "name": "x", "from-root": "/a", "from-path": "", "from-name": "x", "hash": "h1", "id": id}
+	m.handleEvent(&parser.Message{Type: "hash-mismatch", Params: params})
+	failed := map[string]string{"operation": "compare", "error": "files with the same hash differ"}
+	for name, value := range params {
+		failed[name] = value
+	}
+	m.handleEvent(&parser.Message{Type: "operation-failed", Params: failed})
+	if m.run == nil || m.run.status["0"] != "failed" {
+		t.Errorf("compare step = %v", m.run)
+	}
+
+	for {
+		msg, err := ui.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "error" && strings.Contains(msg.StringValue("error"), "HASH MISMATCH") {
+			break
+		}
+	}
+}
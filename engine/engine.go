@@ -1,71 +1,166 @@
 package engine
 
 import (
+	"arc/config"
 	"arc/log"
 	"arc/parser"
-	"bufio"
-	"io"
-	"os"
+	"arc/transport"
+	"net"
 	"runtime/debug"
 	"slices"
 )
 
-func Run(fsEvents io.ReadCloser, fsCommands io.WriteCloser) {
+func Run(ui transport.Conn, connect Connector, options config.Options) {
+	m := newModel(connect, options)
+	m.addClient(ui)
+
 	defer func() {
 		if err := recover(); err != nil {
 			log.Debug("ERROR", "err", err)
 			log.Debug("STACK", "stack", debug.Stack())
-			os.Stdout.WriteString("stopped\n")
+			m.sendToUi("stopped")
 		}
+		m.flushClients()
 	}()
 
-	m := &model{
-		archives:    map[string]*archive{},
-		filesByHash: map[string][]*meta{},
-		fsEvents:    fsEvents,
-		fsCommands:  fsCommands,
-		uiEvents:    os.Stdin,
-		uiCommands:  os.Stdout,
-	}
+	m.loop(nil)
+}
 
-	msgs := make(chan *parser.Message)
+func Serve(listener net.Listener, connect Connector, roots []config.Root, options config.Options) {
+	m := newModel(connect, options)
 
-	go m.readEvents(fsEvents, msgs)
-	go m.readEvents(os.Stdin, msgs)
+	defer func() {
+		if err := recover(); err != nil {
+			log.Debug("ERROR", "err", err)
+			log.Debug("STACK", "stack", debug.Stack())
+			m.sendToUi("stopped")
+		}
+		m.flushClients()
+		listener.Close()
+	}()
 
-	for {
-		m.handleEvent(<-msgs)
-	msgLoop:
+	attached := make(chan transport.Conn)
+	go func() {
 		for {
-			select {
-			case msg := <-msgs:
-				m.handleEvent(msg)
-			default:
-				break msgLoop
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Debug("accept failed", "error", err)
+				return
 			}
+			attached <- transport.Stream(conn, conn)
 		}
-		if m.quit {
-			break
+	}()
+
+	for _, arg := range roots {
+		members, group := arg.Members()
+		for _, root := range members {
+			m.handleEvent(&parser.Message{Type: "scan", Params: map[string]string{"root": root, "group": group, "role": arg.Role, "label": arg.Label}})
 		}
 	}
 
-	for msg := range msgs {
-		if msg.Type == "stopped" {
-			break
-		}
+	m.loop(attached)
+}
+
+func newModel(connect Connector, options config.Options) *model {
+	return &model{
+		archives:     map[string]*archive{},
+		diffs:        map[string]*meta{},
+		filesByHash:  map[string][]*meta{},
+		tasks:        map[string]*task{},
+		queues:       map[string][]*task{},
+		exports:      map[string]string{},
+		undoRefused:  map[string]error{},
+		connect:      connect,
+		backends:     map[string]*backend{},
+		events:       make(chan event),
+		lost:         make(chan *backend),
+		quit:         make(chan struct{}),
+		paranoid:     options.Paranoid,
+		hashAlgo:     options.Hash,
+		conflicts:    options.Conflicts,
+		xattrs:       options.Xattrs,
+		ignore:       options.Ignore,
+		session:      newSession(),
+		minCopies:    options.MinCopies,
+		catalogs:     options.Catalogs,
+		atticMaxAge:  options.AtticMaxAge,
+		atticMaxSize: options.AtticMaxSize,
 	}
-	m.sendToUi("stopped")
 }
 
-func (m *model) readEvents(input io.Reader, messages chan *parser.Message) {
-	reader := bufio.NewReader(input)
+func (m *model) loop(attached chan transport.Conn) {
+	detached := make(chan *client)
+
+	for _, c := range m.clients {
+		go m.readEvents(c, detached)
+	}
+
+	for !m.quitting() {
+		select {
+		case ev := <-m.events:
+			m.client = ev.from
+			if ev.from != nil {
+				m.req = ev.msg.StringValue("req")
+			}
+			m.handleEvent(ev.msg)
+			if m.req != "" {
+				m.reply("done")
+			}
+			m.client, m.req = nil, ""
 
-	for !m.quit {
-		text, err := reader.ReadString('\n')
+		case b := <-m.lost:
+			m.backendLost(b)
+
+		case conn := <-attached:
+			c := m.addClient(conn)
+			go m.readEvents(c, detached)
+
+		case c := <-detached:
+			m.removeClient(c)
+			if attached == nil {
+				m.handleEvent(&parser.Message{Type: "stop"})
+			}
+		}
+	}
+	for _, b := range m.backends {
+		b.conn.Close()
+	}
+}
+
+func (m *model) readEvents(from *client, detached chan *client) {
+	for !m.quitting() {
+		msg, err := from.conn.Receive()
 		if err != nil {
-			panic(err)
+			log.Debug("receive failed", "error", err)
+			select {
+			case detached <- from:
+			case <-m.quit:
+			}
+			return
 		}
-		messages <- parser.Parse(text)
+		m.post(event{from: from, msg: msg})
+	}
+}
+
+func (m *model) post(ev event) {
+	select {
+	case m.events <- ev:
+	case <-m.quit:
+	}
+}
+
+func (m *model) quitting() bool {
+	select {
+	case <-m.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *model) shutDown() {
+	if !m.quitting() {
+		close(m.quit)
 	}
 }
 
@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"arc/config"
+	"arc/transport"
+	"testing"
+)
+
+func newTestModel(t *testing.T, roots ...string) (*model, transport.Conn) {
+	t.Helper()
+	t.Setenv("ARC_HOME", t.TempDir())
+	fsSide := make(chan transport.Conn, 1)
+	m := newModel(func(host string) transport.Conn {
+		engineSide, conn := transport.Pipe()
+		fsSide <- conn
+		return engineSide
+	}, config.LoadOptions(nil))
+	for i, root := range roots {
+		m.archives[root] = &archive{root: root, idx: i, rootFolder: &meta{root: root}, id: "id-" + root, state: archiveReady}
+		m.roots = append(m.roots, root)
+	}
+	m.archives[roots[0]].role = roleOrigin
+	m.backend(roots[0])
+	return m, <-fsSide
+}
+
+func TestScanPassesOptionsToBackend(t *testing.T) {
+	t.Setenv("ARC_XATTRS", "1")
+	t.Setenv("ARC_HASH", "sha512")
+	m, fs := newTestModel(t, "/a")
+	if !m.xattrs || m.hashAlgo != "sha512" {
+		t.Fatalf("model xattrs %v, hash %s", m.xattrs, m.hashAlgo)
+	}
+	m.scanRoot("/a")
+	msg, err := fs.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "scan" || msg.StringValue("xattrs") != "true" || msg.StringValue("hash") != "sha512" {
+		t.Errorf("got %v", msg)
+	}
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"arc/config"
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+func (m *model) export(root, path, name, target, volumeSize string) {
+	if target == "" {
+		m.reply("error", "error", "Export needs a target")
+		return
+	}
+	if !filepath.IsAbs(target) {
+		m.reply("error", "error", "Export target must be an absolute path: "+target)
+		return
+	}
+	size, err := config.ParseSize(volumeSize)
+	if err != nil {
+		m.reply("error", "error", "Invalid volume size "+volumeSize)
+		return
+	}
+	_, files := m.selectFiles(root, path, name)
+	if files == nil {
+		return
+	}
+
+	m.lastTaskId++
+	id := "export-" + strconv.Itoa(m.lastTaskId)
+	m.exports[id] = root
+	for _, file := range files {
+		m.sendToFs(root, "export-file",
+			"id", id,
+			"path", file.folderPath(),
+			"name", file.name,
+			"size", file.size,
+			"mod-time", file.modTime,
+			"hash", file.hash)
+	}
+	m.sendToFs(root, "export",
+		"id", id,
+		"root", root,
+		"target", target,
+		"volume-size", size)
+	m.reply("export-started", "id", id)
+}
+
+func (m *model) selectFiles(root, path, name string) (*meta, []*meta) {
+	if m.archives[root] == nil {
+		m.reply("error", "error", "Unknown archive "+root)
+		return nil, nil
+	}
+	if !m.ready() {
+		m.reply("error", "error", "Archives are not hashed yet")
+		return nil, nil
+	}
+	entry := m.findFolder(root, path)
+	if name != "" {
+		entry = entry.child(name)
+	}
+	if entry == nil {
+		m.reply("error", "error", "No such entry "+name)
+		return nil, nil
+	}
+	files := []*meta{}
+	if entry.kind == kindRegular && entry.parent != nil {
+		files = append(files, entry)
+	} else {
+		entry.walk(func(file *meta) {
+			files = append(files, file)
+		})
+	}
+	return entry, files
+}
+
+func (m *model) exportProgress(target string, progress, size int) {
+	percent := 100
+	if size > 0 {
+		percent = progress * 100 / size
+	}
+	m.sendToUi("status", "status", fmt.Sprintf("Exporting %s: %d%%", target, percent))
+}
+
+func (m *model) exported(id, target string, files, volumes int) {
+	delete(m.exports, id)
+	m.sendToUi("status", "status", fmt.Sprintf("Exported %d files to %s in %d volume(s)", files, target, volumes))
+}
@@ -0,0 +1,77 @@
+package engine
+
+import "path/filepath"
+
+func (m *model) copyUnits() [][]string {
+	units := [][]string{}
+	groups := map[string]int{}
+	for _, root := range m.roots {
+		group := m.archives[root].group
+		if group == "" {
+			units = append(units, []string{root})
+			continue
+		}
+		if idx, ok := groups[group]; ok {
+			units[idx] = append(units[idx], root)
+			continue
+		}
+		groups[group] = len(units)
+		units = append(units, []string{root})
+	}
+	return units
+}
+
+func (m *model) place(roots []string, path string, size int) string {
+	for dir := path; dir != ""; dir = parentDir(dir) {
+		for _, root := range roots {
+			if (m.placed[dir] == root || m.hasFolder(root, dir)) && m.fits(root, size) {
+				return m.reserve(root, path, size)
+			}
+		}
+	}
+	best := ""
+	for _, root := range roots {
+		if m.fits(root, size) && (best == "" || m.archives[root].free > m.archives[best].free) {
+			best = root
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return m.reserve(best, path, size)
+}
+
+func (m *model) reserve(root, path string, size int) string {
+	if archive := m.archives[root]; archive.free >= 0 {
+		archive.free = max(archive.free-size, 0)
+	}
+	for dir := path; dir != ""; dir = parentDir(dir) {
+		if _, ok := m.placed[dir]; !ok {
+			m.placed[dir] = root
+		}
+	}
+	return root
+}
+
+func (m *model) fits(root string, size int) bool {
+	free := m.archives[root].free
+	return free < 0 || free >= size
+}
+
+func (m *model) hasFolder(root, path string) bool {
+	folder := m.archives[root].rootFolder
+	for _, name := range parsePath(path) {
+		folder = folder.children[name]
+		if folder == nil || folder.kind != kindFolder {
+			return false
+		}
+	}
+	return len(folder.children) > 0
+}
+
+func parentDir(path string) string {
+	if dir := filepath.Dir(path); dir != "." {
+		return dir
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSpanningGroupPlacement(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b", "/c")
+	for root, free := range map[string]int{"/b": 10, "/c": 5} {
+		m.archives[root].group = "/b+/c"
+		m.archives[root].free = free
+	}
+	m.placed = map[string]string{}
+	m.unplaced = map[string]int{}
+	m.kept = map[*meta]bool{}
+	for _, file := range []struct{ path, name, hash string }{
+		{"photos", "p1", "h1"}, {"photos", "p2", "h2"}, {"docs", "d1", "h3"}, {"", "huge", "h4"},
+	} {
+		addFile(m, "/a", file.path, file.name, file.hash).size = 4
+	}
+	m.find("/a", "", "huge").size = 20
+	addFile(m, "/c", "docs", "old", "h5")
+
+	got := planned(m, "h1", "h2", "h3", "h4")
+	want := []string{"copy /b/photos/p1", "copy /b/photos/p2", "copy /c/docs/d1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("planned %v, want %v", got, want)
+	}
+	if m.unplaced["/b+/c"] != 1 {
+		t.Errorf("unplaced = %v, want the huge file", m.unplaced)
+	}
+	if m.archives["/b"].free != 2 || m.archives["/c"].free != 1 {
+		t.Errorf("free after placing: /b %d, /c %d", m.archives["/b"].free, m.archives["/c"].free)
+	}
+}
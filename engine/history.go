@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"arc/parser"
+	"time"
+)
+
+func (m *model) readHistory(root string, msg *parser.Message) {
+	archive := m.archives[root]
+	if value := msg.StringValue("last-synced"); value != "" {
+		archive.lastSynced = msg.Time("last-synced")
+		archive.syncedFrom = msg.StringValue("synced-from")
+	}
+	m.sendArchiveInfo(nil, archive)
+}
+
+func (m *model) recordHistory(root, event string, params ...any) {
+	if archive := m.archives[root]; archive == nil || archive.readOnly {
+		return
+	}
+	m.sendToFs(root, "record-history", append([]any{"root", root, "event", event}, params...)...)
+}
+
+func (m *model) recordTotals(root, event string) {
+	files := 0
+	m.archives[root].rootFolder.walk(func(file *meta) {
+		files++
+	})
+	m.recordHistory(root, event, "files", files, "size", m.archives[root].rootFolder.size)
+}
+
+func (m *model) recordSync(r *run) {
+	origin := m.origin()
+	changes := map[string]map[string]int{}
+	for _, step := range r.steps {
+		root := step.StringValue("root")
+		if changes[root] == nil {
+			changes[root] = map[string]int{}
+		}
+		if r.status[step.StringValue("step")] != "done" {
+			changes[root]["failed"]++
+			continue
+		}
+		changes[root][step.Type]++
+	}
+
+	now := time.Now()
+	for _, root := range r.roots {
+		archive := m.archives[root]
+		if archive == nil || archive.readOnly {
+			continue
+		}
+		synced := r.full && changes[root]["failed"] == 0 && m.role(root) != roleOrigin
+		if !synced && changes[root] == nil {
+			continue
+		}
+		event := "updated"
+		if synced {
+			event = "synced"
+		}
+		m.recordHistory(root, event,
+			"origin", origin,
+			"batch", r.batch,
+			"copied", changes[root]["copy"],
+			"moved", changes[root]["move"],
+			"deleted", changes[root]["delete"],
+			"failed", changes[root]["failed"])
+		if synced {
+			archive.lastSynced = now
+			archive.syncedFrom = origin
+			m.sendArchiveInfo(nil, archive)
+		}
+	}
+}
+
+func (m *model) sendArchiveInfo(c *client, archive *archive) {
+	params := []any{
+		"root", archive.root,
+		"state", archive.state.String(),
+		"label", archive.label,
+		"role", m.role(archive.root).String(),
+		"locked-by", archive.lockedBy,
+		"synced-from", archive.syncedFrom,
+		"last-synced", formatTime(archive.lastSynced),
+	}
+	if c != nil {
+		c.send("archive-info", params...)
+	} else {
+		m.sendToUi("archive-info", params...)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
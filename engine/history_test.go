@@ -0,0 +1,32 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestFinishedRunRemovesLogAndRecordsSync(t *testing.T) {
+	m, fs := newTestModel(t, "/a", "/b")
+	m.startRun("b1", testSteps(), true)
+	m.stepFinished("b1", "0", "done")
+	m.stepFinished("b1", "1", "done")
+
+	if m.run != nil {
+		t.Error("run still open after its last step")
+	}
+	if _, err := os.Stat(walName("b1")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("run log left behind: %v", err)
+	}
+	msg, err := fs.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "record-history" || msg.StringValue("root") != "/b" || msg.StringValue("event") != "synced" ||
+		msg.StringValue("copied") != "1" || msg.StringValue("deleted") != "1" || msg.StringValue("origin") != "/a" {
+		t.Errorf("got %v, want /b synced from /a", msg)
+	}
+	if !m.archives["/a"].lastSynced.IsZero() || m.archives["/b"].lastSynced.IsZero() {
+		t.Errorf("last synced: origin %v, mirror %v", m.archives["/a"].lastSynced, m.archives["/b"].lastSynced)
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"arc/log"
+	"fmt"
+)
+
+func (m *model) identify(root, id, volume string) {
+	archive := m.archives[root]
+	archive.id = id
+	archive.volume = volume
+	if id == "" {
+		return
+	}
+	for _, other := range m.archives {
+		if other != archive && other.id == id {
+			log.Debug("same archive id", "root", root, "other", other.root, "id", id)
+			m.sendToUi("error", "error", fmt.Sprintf("%s and %s are the same archive (id %s)", other.root, root, id))
+		}
+	}
+}
+
+func (m *model) archiveByID(id string) *archive {
+	if id == "" {
+		return nil
+	}
+	for _, archive := range m.archives {
+		if archive.id == id {
+			return archive
+		}
+	}
+	return nil
+}
+
+func (m *model) relocateRun(r *run) {
+	moved := map[string]string{}
+	for i, root := range r.roots {
+		if m.archives[root] != nil {
+			continue
+		}
+		if archive := m.archiveByID(r.ids[root]); archive != nil {
+			log.Debug("archive moved", "batch", r.batch, "from", root, "to", archive.root)
+			moved[root] = archive.root
+			r.roots[i] = archive.root
+		}
+	}
+	if len(moved) == 0 {
+		return
+	}
+	for _, step := range r.steps {
+		for _, param := range []string{"root", "from-root"} {
+			if to, ok := moved[step.StringValue(param)]; ok {
+				step.Params[param] = to
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"arc/parser"
+	"arc/transport"
+	"strings"
+	"testing"
+)
+
+func TestRelocateRunFollowsArchiveIDs(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	r := &run{
+		batch: "b1",
+		roots: []string{"/old", "/b", "/gone"},
+		ids:   map[string]string{"/old": "id-/a", "/b": "id-/b", "/gone": "id-unknown"},
+		steps: []*parser.Message{
+			{Type: "copy", Params: map[string]string{"root": "/b", "from-root": "/old", "name": "x"}},
+			{Type: "delete", Params: map[string]string{"root": "/old", "name": "y"}},
+			{Type: "delete", Params: map[string]string{"root": "/gone", "name": "z"}},
+		},
+	}
+
+	m.relocateRun(r)
+	if strings.Join(r.roots, " ") != "/a /b /gone" {
+		t.Errorf("roots = %v", r.roots)
+	}
+	for i, want := range [][2]string{{"/b", "/a"}, {"/a", ""}, {"/gone", ""}} {
+		step := r.steps[i]
+		if step.StringValue("root") != want[0] || step.StringValue("from-root") != want[1] {
+			t.Errorf("step %d = %v", i, step)
+		}
+	}
+}
+
+func TestIdentifyReportsDuplicateArchives(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+
+	m.identify("/b", "id-/a", "")
+	m.flushClients()
+	msg, err := ui.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "error" || !strings.Contains(msg.StringValue("error"), "same archive") {
+		t.Errorf("got %v", msg)
+	}
+	if m.archiveByID("id-/a") == nil || m.archiveByID("") != nil {
+		t.Error("archiveByID")
+	}
+}
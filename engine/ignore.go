@@ -0,0 +1,28 @@
+package engine
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func (m *model) ignored(dir, name string) bool {
+	parts := strings.Split(filepath.ToSlash(filepath.Join(dir, name)), "/")
+	for _, pattern := range m.ignore {
+		if strings.Contains(pattern, "/") {
+			pattern = strings.Trim(pattern, "/")
+			for i := range parts {
+				if ok, _ := path.Match(pattern, path.Join(parts[:i+1]...)); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for _, part := range parts {
+			if ok, _ := path.Match(pattern, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
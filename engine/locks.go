@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"arc/log"
+	"arc/parser"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+func newSession() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (m *model) archiveLocked(msg *parser.Message) {
+	root := msg.StringValue("root")
+	archive := m.archives[root]
+	archive.readOnly = true
+	if reason := msg.StringValue("error"); reason != "" {
+		archive.lockedBy = "unknown"
+		log.Debug("archive lock failed", "root", root, "error", reason)
+		m.sendToUi("error", "error", fmt.Sprintf("%s could not be locked (%s); opened read-only", root, reason))
+		m.sendArchiveInfo(nil, archive)
+		return
+	}
+	archive.lockedBy = fmt.Sprintf("pid %s on %s", msg.StringValue("pid"), msg.StringValue("host"))
+	if msg.StringValue("pid") == "" {
+		archive.lockedBy = "unknown process on " + msg.StringValue("host")
+	}
+	log.Debug("archive locked", "root", root, "by", archive.lockedBy, "session", msg.StringValue("session"))
+	m.sendToUi("error", "error", fmt.Sprintf("%s is in use by arc (%s, session %s, since %s); opened read-only",
+		root, archive.lockedBy, msg.StringValue("session"), msg.StringValue("time")))
+	m.sendArchiveInfo(nil, archive)
+}
+
+func (m *model) unlock(root string) {
+	archive := m.archives[root]
+	if archive == nil {
+		m.reply("error", "error", "Unknown archive "+root)
+		return
+	}
+	if archive.role == roleReadOnly || archive.lockedBy == "" {
+		m.reply("error", "error", root+" is not locked by another session")
+		return
+	}
+	m.sendToFs(root, "unlock", "root", root, "session", m.session)
+}
+
+func (m *model) archiveUnlocked(root string) {
+	archive := m.archives[root]
+	if archive == nil {
+		return
+	}
+	archive.readOnly = false
+	archive.lockedBy = ""
+	m.sendToUi("status", "status", root+" is unlocked and writable")
+	m.sendArchiveInfo(nil, archive)
+}
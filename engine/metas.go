@@ -6,6 +6,7 @@ import (
 
 func (m *model) updateMetas(folder *meta) {
 	folder.size = 0
+	folder.progress = 0
 	folder.modTime = time.Time{}
 	folder.state = resolved
 
@@ -4,7 +4,7 @@ import (
 	"arc/log"
 	"arc/parser"
 	"fmt"
-	"io"
+	"path/filepath"
 	"slices"
 	"strings"
 )
@@ -12,12 +12,26 @@ import (
 func (m *model) handleEvent(msg *parser.Message) {
 	switch msg.Type {
 	case "set-current-folder":
+		c := m.client
 		root := msg.StringValue("root")
 		path := msg.StringValue("path")
-		if root != m.curRoot || path != m.curPath {
-			m.curRoot = root
-			m.curPath = path
-			m.sendCurFolder()
+		if m.archives[root] == nil && m.diffs[root] == nil {
+			m.reply("error", "error", "Unknown archive "+root)
+			return
+		}
+		if folder := m.browseFolder(root, path); folder == nil || (folder.parent != nil && folder.kind != kindFolder) {
+			m.reply("error", "error", "Unknown folder "+path+" in "+root)
+			return
+		}
+		if c != nil && (root != c.curRoot || path != c.curPath) {
+			c.curRoot = root
+			c.curPath = path
+			m.sendCurFolder(c)
+		}
+
+	case "attach":
+		if m.client != nil {
+			m.attach(m.client)
 		}
 
 	case "scan":
@@ -27,15 +41,47 @@ func (m *model) handleEvent(msg *parser.Message) {
 			name: "",
 		}
 
+		role, ok := parseRole(msg.StringValue("role"))
+		if !ok && msg.StringValue("role") != "" {
+			m.reply("error", "error", "Unknown role "+msg.StringValue("role")+" for "+root)
+			return
+		}
+		if role == roleOrigin && m.origin() != "" && m.archives[m.origin()].role == roleOrigin {
+			m.reply("error", "error", "More than one origin: "+m.origin()+" and "+root)
+			role = roleMirror
+		}
 		m.archives[root] = &archive{
 			root:       root,
 			idx:        len(m.roots),
 			rootFolder: folder,
+			free:       -1,
+			role:       role,
+			readOnly:   role == roleReadOnly,
+			label:      msg.StringValue("label"),
+			group:      msg.StringValue("group"),
 		}
 
 		m.roots = append(m.roots, root)
+		m.scanRoot(root)
+
+	case "archive-locked":
+		m.archiveLocked(msg)
+
+	case "unlock":
+		m.unlock(msg.StringValue("root"))
 
-		m.sendToFs("scan", "root", root)
+	case "lock-failed":
+		m.archiveLocked(msg)
+
+	case "archive-unlocked":
+		m.archiveUnlocked(msg.StringValue("root"))
+
+	case "archive-offline":
+		m.backendAlive(msg.StringValue("root"))
+		m.archiveOffline(msg.StringValue("root"))
+
+	case "archive-online":
+		m.archiveOnline(msg.StringValue("root"))
 
 	case "file-scanned":
 		root := msg.StringValue("root")
@@ -43,6 +89,9 @@ func (m *model) handleEvent(msg *parser.Message) {
 		name := msg.StringValue("name")
 		size := msg.Int("size")
 		modTime := msg.Time("mod-time")
+		if m.ignored(path, name) {
+			return
+		}
 
 		curFolder := m.folder(root, path)
 		file := &meta{
@@ -57,84 +106,353 @@ func (m *model) handleEvent(msg *parser.Message) {
 		curFolder.addChild(file)
 		curFolder.updateState()
 		m.updateUiEntry(file)
+		m.enqueue(&parser.Message{
+			Type:   "hash",
+			Params: map[string]string{"root": root, "path": path, "name": name},
+		}, file)
+
+	case "scan-failed":
+		root := msg.StringValue("root")
+		log.Debug("scan failed", "root", root, "error", msg.StringValue("error"))
+		m.sendToUi("error", "error", "Scanning "+root+" failed: "+msg.StringValue("error")+"; it stays unresolved until it is scanned again")
 
 	case "archive-scanned":
 		root := msg.StringValue("root")
+		m.backendAlive(root)
 		m.archives[root].state = archiveHashing
+		m.archives[root].readOnly = msg.StringValue("read-only") == "true" || m.archives[root].role == roleReadOnly
+		if free := msg.StringValue("free"); free != "" {
+			m.archives[root].free = msg.Int("free")
+		}
+		m.identify(root, msg.StringValue("id"), msg.StringValue("volume"))
+		m.readHistory(root, msg)
+		m.recordTotals(root, "scanned")
+		if m.archives[root].hashing == 0 {
+			m.archiveHashed(root)
+		}
+		m.pruneAttic(root)
+		m.dispatch()
 
-	case "hashing-progress", "copying-progress":
+	case "hashing-progress":
+		root := msg.StringValue("root")
+		path := msg.StringValue("path")
+		name := msg.StringValue("name")
+		file := m.find(root, path, name)
+		if file == nil {
+			return
+		}
+		file.state = inProgress
+		file.progress = msg.Int("progress")
+		file.parent.updateState()
+		m.updateUiEntry(file)
+
+	case "file-hashed":
+		root := msg.StringValue("root")
+		path := msg.StringValue("path")
+		name := msg.StringValue("name")
+		hash := msg.StringValue("hash")
+		if file := m.find(root, path, name); file != nil {
+			file.hash = hash
+			file.state = resolved
+			file.progress = file.size
+			m.filesByHash[hash] = append(m.filesByHash[hash], file)
+			file.parent.updateState()
+			m.updateUiEntry(file)
+		}
+		m.taskDone(msg, "done")
+
+	case "diff":
+		m.diff(msg.StringValue("from"), msg.StringValue("to"))
+
+	case "copying-progress":
 		root := msg.StringValue("root")
 		path := msg.StringValue("path")
 		name := msg.StringValue("name")
 		curFolder := m.folder(root, path)
 		file := curFolder.children[name]
+		if file == nil {
+			file = &meta{
+				kind:   kindRegular,
+				root:   root,
+				name:   name,
+				parent: curFolder,
+				size:   msg.Int("size"),
+			}
+			curFolder.addChild(file)
+		}
 		file.state = inProgress
 		file.progress = msg.Int("progress")
 		file.parent.updateState()
 		m.updateUiEntry(file)
 
-	case "file-hashed":
+	case "file-copied", "file-restored":
 		root := msg.StringValue("root")
 		path := msg.StringValue("path")
 		name := msg.StringValue("name")
 		hash := msg.StringValue("hash")
 		curFolder := m.folder(root, path)
 		file := curFolder.children[name]
+		if file == nil {
+			file = &meta{
+				kind:   kindRegular,
+				root:   root,
+				name:   name,
+				parent: curFolder,
+			}
+			curFolder.addChild(file)
+		}
+		oldHash := file.hash
+		file.size = msg.Int("size")
+		file.modTime = msg.Time("mod-time")
 		file.hash = hash
 		file.state = resolved
 		file.progress = file.size
-		m.filesByHash[hash] = append(m.filesByHash[hash], file)
+		if oldHash != hash {
+			m.filesByHash[oldHash] = slices.DeleteFunc(m.filesByHash[oldHash], func(other *meta) bool {
+				return other == file
+			})
+			m.filesByHash[hash] = append(m.filesByHash[hash], file)
+		}
+		file.parent.updateState()
+		m.updateUiEntry(file)
+		if oldHash != "" && oldHash != hash {
+			m.reanalyze(oldHash)
+		}
+		m.reanalyze(hash)
+		m.taskDone(msg, "done")
+
+	case "file-moved":
+		root := msg.StringValue("root")
+		path := msg.StringValue("path")
+		name := msg.StringValue("name")
+		file := m.findFolder(root, path).child(name)
+		if file == nil {
+			m.taskDone(msg, "failed")
+			return
+		}
+		m.detach(file)
+		curFolder := m.folder(root, msg.StringValue("to-path"))
+		file.name = msg.StringValue("to-name")
+		file.parent = curFolder
+		curFolder.addChild(file)
 		file.parent.updateState()
 		m.updateUiEntry(file)
+		m.reanalyze(file.hash)
+		m.taskDone(msg, "done")
 
-	case "archive-hashed":
+	case "file-deleted":
 		root := msg.StringValue("root")
-		m.archives[root].state = archiveReady
+		path := msg.StringValue("path")
+		name := msg.StringValue("name")
+		file := m.findFolder(root, path).child(name)
+		if file == nil {
+			m.taskDone(msg, "failed")
+			return
+		}
+		m.detach(file)
+		m.filesByHash[file.hash] = slices.DeleteFunc(m.filesByHash[file.hash], func(other *meta) bool {
+			return other == file
+		})
+		m.reanalyze(file.hash)
+		m.taskDone(msg, "done")
+
+	case "files-compared":
+		if t := m.taskDone(msg, "done"); t != nil {
+			m.reanalyze(t.file.hash)
+		}
 
-		for _, archive := range m.archives {
-			if archive.state != archiveReady {
-				return
+	case "hash-mismatch":
+		log.Debug("HASH MISMATCH", "msg", msg)
+		m.sendToUi("error", "error", fmt.Sprintf("HASH MISMATCH: %s and %s share hash %s but differ: a hash collision or a corrupt hash cache",
+			msg.StringValue("root")+"/"+filepath.Join(msg.StringValue("path"), msg.StringValue("name")),
+			msg.StringValue("from-root")+"/"+filepath.Join(msg.StringValue("from-path"), msg.StringValue("from-name")),
+			msg.StringValue("hash")))
+
+	case "operation-failed":
+		log.Debug("operation failed", "msg", msg)
+		if t := m.tasks[msg.StringValue("id")]; t != nil && !t.running {
+			return
+		} else if t != nil && msg.StringValue("offline") == "true" {
+			m.taskOffline(t)
+			return
+		}
+		m.sendToUi("error", "error", msg.StringValue("operation")+" failed: "+msg.StringValue("error"))
+		delete(m.exports, msg.StringValue("id"))
+		if msg.StringValue("operation") == "list-batches" {
+			m.batchesListed(msg.StringValue("root"))
+		}
+		if t := m.taskDone(msg, "failed"); t != nil {
+			m.taskAborted(t)
+		}
+
+	case "operation-canceled":
+		if id := msg.StringValue("id"); m.exports[id] != "" {
+			delete(m.exports, id)
+			if strings.HasPrefix(id, "checksums-") {
+				m.sendToUi("status", "status", "Writing checksums canceled")
+			} else {
+				m.sendToUi("status", "status", "Export canceled")
 			}
 		}
-		m.analyzeDiscrepancies()
+		m.taskCanceled(msg)
+
+	case "cancel":
+		if id := msg.StringValue("id"); m.exports[id] != "" {
+			m.sendToFs(m.exports[id], "cancel", "id", id)
+		} else if id != "" {
+			m.cancelTask(id)
+			m.dispatch()
+		} else {
+			m.cancelEntry(msg.StringValue("root"), msg.StringValue("path"), msg.StringValue("name"))
+		}
 
-	case "file-copied":
-		panic("IMPLEMENT file-copied")
+	case "move-up":
+		m.moveTaskUp(msg.StringValue("id"))
 
-	case "file-moved":
-		panic("IMPLEMENT file-moved")
+	case "pause":
+		m.pause()
 
-	case "file-deleted":
-		panic("IMPLEMENT file-deleted")
+	case "resume":
+		m.resume()
+
+	case "watch-queue":
+		if c := m.client; c != nil {
+			c.queueWatched = msg.StringValue("watch") == "true"
+			if c.queueWatched {
+				m.sendQueue(c)
+			}
+		}
+
+	case "query-divergent":
+		m.queryDivergent()
+
+	case "query-locations":
+		m.queryLocations(msg.StringValue("hash"))
+
+	case "query-totals":
+		m.queryTotals()
+
+	case "resolve":
+		m.resolveEntry(msg.StringValue("root"), msg.StringValue("path"), msg.StringValue("name"))
+
+	case "resolve-all":
+		m.resolveAll()
+
+	case "undo":
+		m.undo(msg.StringValue("batch"))
+
+	case "undo-step":
+		m.checkUndoStep(msg)
+
+	case "undo-planned":
+		m.undoPlanned(msg)
+
+	case "batch-undone":
+		if failed := msg.StringValue("failed"); failed != "" {
+			m.sendToUi("error", "error", "Undoing "+msg.StringValue("batch")+" on "+msg.StringValue("root")+": "+failed+" steps could not be reversed")
+		} else {
+			m.sendToUi("status", "status", "Undone "+msg.StringValue("batch")+" on "+msg.StringValue("root"))
+		}
+		m.batchUndone(msg)
+
+	case "resume-run":
+		m.resumeRun(msg.StringValue("batch"))
+
+	case "rollback-run":
+		m.rollbackRun(msg.StringValue("batch"))
+
+	case "list-batches":
+		m.listBatches()
+
+	case "batch":
+		m.addBatch(msg)
+
+	case "batches-listed":
+		m.batchesListed(msg.StringValue("root"))
+
+	case "list-attic":
+		m.listAttic(msg.StringValue("root"))
+
+	case "attic-entry":
+		m.atticEntry(msg)
+
+	case "attic-listed":
+		m.atticListed(msg.StringValue("root"))
+
+	case "restore-attic":
+		m.restoreAttic(msg.StringValue("root"), msg.StringValue("trash"), msg.StringValue("path"), msg.StringValue("name"))
+
+	case "attic-pruned":
+		m.atticPruned(msg.StringValue("root"), msg.Int("files"), msg.Int("size"))
+
+	case "export":
+		m.export(msg.StringValue("root"), msg.StringValue("path"), msg.StringValue("name"),
+			msg.StringValue("target"), msg.StringValue("volume-size"))
+
+	case "export-progress":
+		m.exportProgress(msg.StringValue("target"), msg.Int("progress"), msg.Int("size"))
+
+	case "exported":
+		m.exported(msg.StringValue("id"), msg.StringValue("target"), msg.Int("files"), msg.Int("volumes"))
+
+	case "checksums":
+		m.writeChecksums(msg.StringValue("root"), msg.StringValue("path"), msg.StringValue("name"),
+			msg.StringValue("format"), msg.StringValue("target"))
+
+	case "checksums-progress":
+		m.checksumsProgress(msg.StringValue("target"), msg.Int("progress"), msg.Int("size"))
+
+	case "checksums-written":
+		m.checksumsWritten(msg.StringValue("id"), msg.StringValue("target"), msg.Int("files"))
+
+	case "checksum-mismatch":
+		m.checksumMismatch(msg.StringValue("root"), msg.StringValue("path"), msg.StringValue("name"),
+			msg.StringValue("manifest"), msg.StringValue("kind"))
+
+	case "chunk", "chunk-end":
+		m.forwardChunk(msg)
+
+	case "chunk-ack":
+		m.forwardAck(msg)
+
+	case "reconnect":
+		m.reconnect(msg.StringValue("host"))
 
 	case "stop":
-		m.sendToFs("stop")
+		m.stop()
 
 	case "stopped":
-		m.sendToUi("stopped")
-		m.quit = true
+		m.backendStopped()
 
 	default:
 		log.Debug("UNKNOWN event type", "msg", msg)
-		panic(fmt.Sprintf("UNKNOWN event type %q", msg.Type))
+		m.reply("error", "error", "Unknown command "+msg.Type)
 	}
 }
 
-func (m *model) sendCurFolder() {
-	m.sendToUi("current-folder", "root", m.curRoot, "path", m.curPath)
+func (m *model) sendCurFolder(c *client) {
+	c.send("current-folder", "root", c.curRoot, "path", c.curPath)
 
-	for _, file := range m.curFolder().children {
-		m.sendEntryToUi(file)
+	if folder := m.curFolder(c); folder != nil {
+		for _, file := range folder.children {
+			sendEntry(c, file)
+		}
 	}
 
-	m.sendToUi("show-folder")
+	c.send("show-folder")
 }
 
 func (m *model) updateUiEntry(file *meta) {
-	if file.root != m.curRoot {
+	for _, c := range m.clients {
+		updateEntry(c, file)
+	}
+}
+
+func updateEntry(c *client, file *meta) {
+	if file.root != c.curRoot {
 		return
 	}
-	curPath := parsePath(m.curPath)
+	curPath := parsePath(c.curPath)
 
 	path := file.path()
 	n := len(path) - len(curPath)
@@ -150,18 +468,47 @@ func (m *model) updateUiEntry(file *meta) {
 		file = file.parent
 	}
 
-	m.sendEntryToUi(file)
+	sendEntry(c, file)
+}
+
+func (m *model) detach(file *meta) {
+	folder := file.parent
+	delete(folder.children, file.name)
+	folder.updateState()
+	for _, c := range m.clients {
+		if folder.root == c.curRoot && folder.fullPath() == c.curPath {
+			c.send("remove-entry", "name", file.name)
+		} else {
+			updateEntry(c, folder)
+		}
+	}
+}
+
+func (m *model) archiveHashed(root string) {
+	m.archives[root].state = archiveReady
+	m.saveCatalog(root)
+	m.recordTotals(root, "verified")
+
+	if !m.ready() {
+		return
+	}
+	m.analyzeDiscrepancies()
+	if !m.runsFound {
+		m.runsFound = true
+		m.checkInterruptedRuns()
+	}
 }
 
-func (m *model) sendEntryToUi(file *meta) {
-	m.sendToUi("update-entry",
+func sendEntry(c *client, file *meta) {
+	c.send("update-entry",
 		"kind", file.kind.String(),
 		"name", file.name,
 		"size", file.size,
 		"mod-time", file.modTime,
 		"state", file.state.String(),
 		"progress", file.progress,
-		"counts", counts(file.counts))
+		"counts", counts(file.counts),
+		"change", file.change)
 }
 
 func parsePath(strPath string) []string {
@@ -172,19 +519,34 @@ func parsePath(strPath string) []string {
 	return nil
 }
 
-func (m *model) curFolder() *meta {
-	return m.folder(m.curRoot, m.curPath)
+func (m *model) curFolder(c *client) *meta {
+	return m.browseFolder(c.curRoot, c.curPath)
+}
+
+// browseFolder finds a folder to show in the UI, which can also be one of
+// the catalog diffs. Diffs are not archives, so actions never see them.
+func (m *model) browseFolder(root string, path string) *meta {
+	folder := m.diffs[root]
+	if folder == nil {
+		return m.findFolder(root, path)
+	}
+	for _, name := range parsePath(path) {
+		folder = folder.child(name)
+	}
+	return folder
 }
 
 func (m *model) folder(root string, path string) *meta {
-	segments := parsePath(path)
-	folder := m.archives[root].rootFolder
-	for _, name := range segments {
+	return makeFolder(m.archives[root].rootFolder, path)
+}
+
+func makeFolder(folder *meta, path string) *meta {
+	for _, name := range parsePath(path) {
 		child := folder.children[name]
 		if child == nil {
 			child = &meta{
 				kind:     kindFolder,
-				root:     root,
+				root:     folder.root,
 				name:     name,
 				parent:   folder,
 				children: map[string]*meta{},
@@ -196,14 +558,14 @@ func (m *model) folder(root string, path string) *meta {
 	return folder
 }
 
-func (m *model) sendToFs(kind string, params ...any) {
-	m.send(m.fsCommands, kind, params...)
-}
-
-func (m *model) sendToUi(kind string, params ...any) {
-	m.send(m.uiCommands, kind, params...)
-}
-
-func (m *model) send(out io.Writer, kind string, params ...any) {
-	out.Write([]byte(parser.String(kind, params...)))
+func (m *model) findFolder(root string, path string) *meta {
+	archive := m.archives[root]
+	if archive == nil {
+		return nil
+	}
+	folder := archive.rootFolder
+	for _, name := range parsePath(path) {
+		folder = folder.child(name)
+	}
+	return folder
 }
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"arc/parser"
+	"arc/transport"
+	"testing"
+)
+
+func TestSetUnknownFolder(t *testing.T) {
+	m, _ := newTestModel(t, "/a")
+	addFile(m, "/a", "docs", "x", "h1")
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+
+	for _, path := range []string{"missing/deeper", "docs/x"} {
+		m.handleEvent(&parser.Message{Type: "set-current-folder", Params: map[string]string{"root": "/a", "path": path}})
+		msg, err := ui.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != "error" {
+			t.Errorf("set-current-folder %s: got %v", path, msg)
+		}
+	}
+	if m.find("/a", "", "missing") != nil {
+		t.Error("an unknown path created a folder")
+	}
+
+	for _, path := range []string{"docs", ""} {
+		m.handleEvent(&parser.Message{Type: "set-current-folder", Params: map[string]string{"root": "/a", "path": path}})
+		msg, err := ui.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != "current-folder" || msg.StringValue("path") != path {
+			t.Errorf("got %v, want folder %q", msg, path)
+		}
+		for msg.Type != "show-folder" {
+			if msg, err = ui.Receive(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
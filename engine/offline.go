@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"arc/log"
+	"slices"
+)
+
+func (m *model) scanRoot(root string) {
+	params := []any{"root", root, "session", m.session, "hash", m.hashAlgo}
+	if m.archives[root].role == roleReadOnly {
+		params = append(params, "read-only", "true")
+	}
+	if m.xattrs {
+		params = append(params, "xattrs", "true")
+	}
+	m.sendToFs(root, "scan", params...)
+}
+
+func (m *model) archiveOffline(root string) {
+	archive := m.archives[root]
+	if archive == nil || archive.state == archiveOffline {
+		return
+	}
+	log.Debug("archive offline", "root", root, "state", archive.state)
+	archive.resumeTo = archive.state
+	archive.state = archiveOffline
+	m.sendToUi("status", "status", root+" is offline, waiting for it to come back")
+	m.sendArchiveInfo(nil, archive)
+	m.undoUnavailable(root)
+	m.batchesListed(root)
+}
+
+func (m *model) archiveOnline(root string) {
+	archive := m.archives[root]
+	if archive == nil || archive.state != archiveOffline {
+		return
+	}
+	log.Debug("archive online", "root", root, "state", archive.resumeTo)
+	archive.state = archive.resumeTo
+	if archive.state == archiveScanning {
+		m.rescan(archive)
+	}
+	m.sendToUi("status", "status", root+" is back online")
+	m.sendArchiveInfo(nil, archive)
+	m.dispatch()
+}
+
+func (m *model) rescan(archive *archive) {
+	for _, t := range append([]*task{}, m.queues[archive.root]...) {
+		m.removeTask(t)
+	}
+	for hash, files := range m.filesByHash {
+		files = slices.DeleteFunc(files, func(file *meta) bool { return file.root == archive.root })
+		if len(files) == 0 {
+			delete(m.filesByHash, hash)
+		} else {
+			m.filesByHash[hash] = files
+		}
+	}
+	archive.rootFolder = &meta{root: archive.root}
+	for _, c := range m.clients {
+		if c.curRoot == archive.root {
+			c.curPath = ""
+			m.sendCurFolder(c)
+		}
+	}
+	m.scanRoot(archive.root)
+}
+
+func (m *model) taskOffline(t *task) {
+	t.running = false
+	m.stopSource(t)
+	m.taskAborted(t)
+	m.dispatch()
+}
+
+func (m *model) offline(root string) bool {
+	archive := m.archives[root]
+	return archive != nil && archive.state == archiveOffline
+}
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"arc/parser"
+	"testing"
+)
+
+func TestOfflineRootResumesItsTasks(t *testing.T) {
+	m, fs := newTestModel(t, "/a", "/b")
+	source := addFile(m, "/a", "", "x", "h1")
+	cmd := &parser.Message{Type: "copy", Params: map[string]string{
+		"from-root": "/a", "from-path": "", "from-name": "x", "root": "/b", "path": "", "name": "x", "hash": "h1", "batch": "b1"}}
+	m.enqueue(cmd, source)
+	id := cmd.StringValue("id")
+	m.dispatch()
+	expectFs(t, fs, "copy", id)
+
+	event := func(kind string, params ...string) {
+		msg := &parser.Message{Type: kind, Params: map[string]string{"root": "/b"}}
+		for i := 0; i < len(params); i += 2 {
+			msg.Params[params[i]] = params[i+1]
+		}
+		m.handleEvent(msg)
+	}
+	event("archive-offline")
+	event("operation-failed", "id", id, "offline", "true", "error", "gone")
+	if !m.offline("/b") || m.tasks[id] == nil || m.tasks[id].running {
+		t.Fatalf("offline: state %v, task %v", m.archives["/b"].state, m.tasks[id])
+	}
+	m.dispatch()
+	if m.tasks[id].running {
+		t.Error("started a task on an offline root")
+	}
+
+	event("archive-online")
+	if m.archives["/b"].state != archiveReady {
+		t.Errorf("state after coming back = %v", m.archives["/b"].state)
+	}
+	expectFs(t, fs, "copy", id)
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"cmp"
+	"slices"
+)
+
+func (m *model) queryDivergent() {
+	files := []*meta{}
+	for _, root := range m.roots {
+		m.archives[root].rootFolder.walk(func(file *meta) {
+			if file.state == divergent {
+				files = append(files, file)
+			}
+		})
+	}
+	m.replyFiles(files)
+}
+
+func (m *model) queryLocations(hash string) {
+	files := slices.Clone(m.filesByHash[hash])
+	m.replyFiles(files)
+}
+
+func (m *model) replyFiles(files []*meta) {
+	slices.SortFunc(files, func(a, b *meta) int {
+		if c := cmp.Compare(m.archives[a.root].idx, m.archives[b.root].idx); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.fullPath(), b.fullPath())
+	})
+	for _, file := range files {
+		m.reply("file",
+			"root", file.root,
+			"path", file.folderPath(),
+			"name", file.name,
+			"size", file.size,
+			"mod-time", file.modTime,
+			"hash", file.hash,
+			"state", file.state.String(),
+			"counts", counts(file.counts))
+	}
+}
+
+func (m *model) queryTotals() {
+	for _, root := range m.roots {
+		archive := m.archives[root]
+		files, divergentFiles, pendingFiles := 0, 0, 0
+		archive.rootFolder.walk(func(file *meta) {
+			files++
+			switch file.state {
+			case divergent:
+				divergentFiles++
+			case pending, inProgress:
+				pendingFiles++
+			}
+		})
+		m.reply("totals",
+			"root", root,
+			"state", archive.state.String(),
+			"files", files,
+			"size", archive.rootFolder.size,
+			"divergent", divergentFiles,
+			"pending", pendingFiles,
+			"last-synced", formatTime(archive.lastSynced),
+			"label", archive.label,
+			"locked-by", archive.lockedBy,
+			"id", archive.id,
+			"volume", archive.volume)
+	}
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"arc/parser"
+	"arc/transport"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func replies(t *testing.T, m *model, ui transport.Conn, query func()) []*parser.Message {
+	t.Helper()
+	query()
+	m.reply("done")
+	result := []*parser.Message{}
+	for {
+		msg, err := ui.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "done" {
+			return result
+		}
+		result = append(result, msg)
+	}
+}
+
+func TestQueryFilesInRootOrder(t *testing.T) {
+	m, _ := newTestModel(t, "/b", "/a")
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+	addFile(m, "/a", "", "x", "h1").state = divergent
+	addFile(m, "/b", "sub", "y", "h1").state = divergent
+	addFile(m, "/b", "", "z", "h1").state = divergent
+	addFile(m, "/b", "", "same", "h2")
+
+	want := []string{"/b sub/y", "/b z", "/a x"}
+	for _, query := range []func(){m.queryDivergent, func() { m.queryLocations("h1") }} {
+		files := replies(t, m, ui, query)
+		if len(files) != len(want) {
+			t.Fatalf("got %d files, want %v", len(files), want)
+		}
+		for i, msg := range files {
+			got := msg.StringValue("root") + " " + filepath.Join(msg.StringValue("path"), msg.StringValue("name"))
+			if msg.Type != "file" || got != want[i] || msg.StringValue("state") != "divergent" || msg.StringValue("hash") != "h1" {
+				t.Errorf("file %d = %v, want %s", i, msg, want[i])
+			}
+		}
+	}
+	if files := replies(t, m, ui, func() { m.queryLocations("unknown") }); len(files) != 0 {
+		t.Errorf("unknown hash located %v", files)
+	}
+}
+
+func TestQueryTotals(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+	addFile(m, "/a", "", "x", "h1").state = divergent
+	addFile(m, "/a", "", "y", "h2").state = pending
+	addFile(m, "/a", "", "z", "h3")
+	m.archives["/b"].lastSynced = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	m.archives["/b"].label = "backup"
+
+	totals := replies(t, m, ui, m.queryTotals)
+	if len(totals) != 2 {
+		t.Fatalf("got %v", totals)
+	}
+	a, b := totals[0], totals[1]
+	if a.StringValue("root") != "/a" || a.StringValue("files") != "3" || a.StringValue("divergent") != "1" ||
+		a.StringValue("pending") != "1" || a.StringValue("last-synced") != "" || a.StringValue("id") != "id-/a" {
+		t.Errorf("totals of /a = %v", a)
+	}
+	if b.StringValue("root") != "/b" || b.StringValue("files") != "0" || b.StringValue("state") != "archiveReady" ||
+		b.StringValue("last-synced") != "2024-01-02T03:04:05Z" || b.StringValue("label") != "backup" {
+		t.Errorf("totals of /b = %v", b)
+	}
+}
+
+func TestUnexpectedBackendStop(t *testing.T) {
+	m, fs := newTestModel(t, "/a")
+	b := m.backends[""]
+
+	fs.Send("stopped")
+	select {
+	case lost := <-m.lost:
+		if lost != b {
+			t.Errorf("lost %v", lost)
+		}
+	case ev := <-m.events:
+		t.Errorf("unexpected stop posted %v", ev.msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("unexpected stop not reported")
+	}
+}
+
+func TestRequestedBackendStop(t *testing.T) {
+	m, fs := newTestModel(t, "/a")
+	m.stop()
+	if msg, err := fs.Receive(); err != nil || msg.Type != "stop" {
+		t.Fatalf("got %v, %v", msg, err)
+	}
+
+	fs.Send("stopped")
+	select {
+	case <-m.lost:
+		t.Error("requested stop reported as a failure")
+	case ev := <-m.events:
+		if ev.msg.Type != "stopped" {
+			t.Errorf("posted %v", ev.msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop not posted")
+	}
+}
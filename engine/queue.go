@@ -0,0 +1,273 @@
+package engine
+
+import (
+	"arc/parser"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type task struct {
+	id       string
+	cmd      *parser.Message
+	file     *meta
+	lane     string
+	running  bool
+	requeue  bool
+	deferred bool
+}
+
+func (m *model) enqueue(cmd *parser.Message, file *meta) {
+	m.lastTaskId++
+	id := strconv.Itoa(m.lastTaskId)
+	cmd.Params["id"] = id
+
+	t := &task{
+		id:   id,
+		cmd:  cmd,
+		file: file,
+		lane: cmd.StringValue("root"),
+	}
+	m.tasks[id] = t
+	m.queues[t.lane] = append(m.queues[t.lane], t)
+	if cmd.Type == "hash" {
+		m.archives[t.lane].hashing++
+	}
+}
+
+func (m *model) dispatch() {
+	if !m.paused {
+		for _, root := range m.roots {
+			for {
+				queue := m.queues[root]
+				if len(queue) == 0 || queue[0].running || m.archives[root].state == archiveScanning ||
+					m.offline(root) || m.offline(queue[0].cmd.StringValue("from-root")) {
+					break
+				}
+				t := queue[0]
+				if err := m.checkSafety(t); err != nil {
+					m.reject(t, err)
+					continue
+				}
+				if m.run != nil && t.cmd.StringValue("batch") == m.run.batch {
+					if err := m.run.started(t.cmd.StringValue("step")); err != nil {
+						m.abortRun(err)
+						continue
+					}
+				}
+				t.running = true
+				m.start(t)
+				break
+			}
+		}
+	}
+	m.sendQueueStatus()
+}
+
+func (m *model) taskDone(msg *parser.Message, status string) *task {
+	t := m.tasks[msg.StringValue("id")]
+	if t == nil {
+		return nil
+	}
+	m.removeTask(t)
+	if status != "done" {
+		m.stopSource(t)
+	}
+	m.stepFinished(t.cmd.StringValue("batch"), t.cmd.StringValue("step"), status)
+	m.dispatch()
+	return t
+}
+
+func (m *model) removeTask(t *task) {
+	delete(m.tasks, t.id)
+	if queue := m.queues[t.lane]; len(queue) > 0 && queue[0] == t {
+		m.queues[t.lane] = queue[1:]
+	} else {
+		m.queues[t.lane] = slices.DeleteFunc(queue, func(other *task) bool {
+			return other == t
+		})
+	}
+	if t.cmd.Type == "hash" {
+		archive := m.archives[t.lane]
+		archive.hashing--
+		if archive.hashing == 0 && archive.state == archiveHashing {
+			m.archiveHashed(t.lane)
+		}
+	}
+}
+
+func (m *model) taskCanceled(msg *parser.Message) {
+	t := m.tasks[msg.StringValue("id")]
+	if t == nil {
+		return
+	}
+	if t.requeue {
+		t.running = false
+		t.requeue = false
+		if t.deferred {
+			t.deferred = false
+			m.deferTask(t)
+		}
+		m.taskAborted(t)
+		m.dispatch()
+		return
+	}
+	m.taskDone(msg, "canceled")
+	m.taskAborted(t)
+}
+
+func (m *model) cancelTask(id string) {
+	t := m.tasks[id]
+	if t == nil {
+		return
+	}
+	if t.cmd.Type == "hash" {
+		if t.running {
+			t.requeue = true
+			t.deferred = true
+			m.stopTask(t)
+		} else {
+			m.deferTask(t)
+		}
+		return
+	}
+	if t.running {
+		m.stopTask(t)
+		return
+	}
+	m.removeTask(t)
+	m.stepFinished(t.cmd.StringValue("batch"), t.cmd.StringValue("step"), "canceled")
+	m.taskAborted(t)
+}
+
+func (m *model) deferTask(t *task) {
+	queue := slices.DeleteFunc(m.queues[t.lane], func(other *task) bool {
+		return other == t
+	})
+	m.queues[t.lane] = append(queue, t)
+}
+
+func (m *model) cancelEntry(root, path, name string) {
+	prefix := name
+	if path != "" {
+		prefix = path + "/" + name
+	}
+	under := func(path, name string) bool {
+		full := name
+		if path != "" {
+			full = path + "/" + name
+		}
+		return full == prefix || strings.HasPrefix(full, prefix+"/")
+	}
+
+	for _, queue := range m.queues {
+		for _, t := range slices.Clone(queue) {
+			cmd := t.cmd
+			if (cmd.StringValue("root") == root && under(cmd.StringValue("path"), cmd.StringValue("name"))) ||
+				(cmd.StringValue("from-root") == root && under(cmd.StringValue("from-path"), cmd.StringValue("from-name"))) {
+				m.cancelTask(t.id)
+			}
+		}
+	}
+	m.dispatch()
+}
+
+func (m *model) taskAborted(t *task) {
+	file := t.file
+	switch t.cmd.Type {
+	case "hash":
+		file.progress = 0
+		file.state = scanned
+		file.parent.updateState()
+		m.updateUiEntry(file)
+
+	case "copy":
+		target := m.find(t.cmd.StringValue("root"), t.cmd.StringValue("path"), t.cmd.StringValue("name"))
+		if target != nil && target.hash == "" {
+			m.detach(target)
+		}
+		m.reanalyze(file.hash)
+
+	default:
+		m.reanalyze(file.hash)
+	}
+}
+
+func (m *model) moveTaskUp(id string) {
+	t := m.tasks[id]
+	if t == nil {
+		return
+	}
+	queue := m.queues[t.lane]
+	idx := slices.Index(queue, t)
+	if idx < 1 || queue[idx-1].running {
+		return
+	}
+	queue[idx-1], queue[idx] = queue[idx], queue[idx-1]
+	m.sendQueueStatus()
+}
+
+func (m *model) pause() {
+	m.paused = true
+	for _, queue := range m.queues {
+		if len(queue) > 0 && queue[0].running && queue[0].cmd.Type == "hash" {
+			queue[0].requeue = true
+			m.stopTask(queue[0])
+		}
+	}
+	m.sendQueueStatus()
+}
+
+func (m *model) resume() {
+	m.paused = false
+	m.dispatch()
+}
+
+func (m *model) sendQueueStatus() {
+	running := 0
+	for _, queue := range m.queues {
+		if len(queue) > 0 && queue[0].running {
+			running++
+		}
+	}
+	queued := len(m.tasks) - running
+	paused := "false"
+	if m.paused {
+		paused = "true"
+	}
+	m.sendToUi("queue-status", "queued", queued, "running", running, "paused", paused)
+
+	for _, c := range m.clients {
+		if c.queueWatched && (queued+running == 0 || time.Since(c.queueSent) > 300*time.Millisecond) {
+			m.sendQueue(c)
+		}
+	}
+}
+
+const maxQueueItems = 500
+
+func (m *model) sendQueue(c *client) {
+	c.queueSent = time.Now()
+	count := 0
+	for _, root := range m.roots {
+		for _, t := range m.queues[root] {
+			if count == maxQueueItems {
+				break
+			}
+			count++
+			running := "false"
+			if t.running {
+				running = "true"
+			}
+			c.send("queue-item",
+				"id", t.id,
+				"kind", t.cmd.Type,
+				"root", t.cmd.StringValue("root"),
+				"path", t.cmd.StringValue("path"),
+				"name", t.cmd.StringValue("name"),
+				"running", running)
+		}
+	}
+	c.send("queue-listed")
+}
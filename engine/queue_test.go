@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"arc/parser"
+	"arc/transport"
+	"testing"
+)
+
+func hashTask(m *model, file *meta) *task {
+	cmd := &parser.Message{Type: "hash", Params: map[string]string{
+		"root": file.root, "path": file.folderPath(), "name": file.name}}
+	m.enqueue(cmd, file)
+	return m.tasks[cmd.StringValue("id")]
+}
+
+func TestHashedFileGone(t *testing.T) {
+	m, _ := newTestModel(t, "/a")
+	file := addFile(m, "/a", "docs", "x", "")
+	task := hashTask(m, file)
+	m.detach(file)
+
+	for _, kind := range []string{"hashing-progress", "file-hashed"} {
+		m.handleEvent(&parser.Message{Type: kind, Params: map[string]string{
+			"root": "/a", "path": "docs", "name": "x", "hash": "h1", "progress": "1", "id": task.id}})
+	}
+	if m.tasks[task.id] != nil || len(m.queues["/a"]) != 0 {
+		t.Error("hash task of a removed file stays queued")
+	}
+	if m.archives["/a"].hashing != 0 {
+		t.Errorf("hashing = %d", m.archives["/a"].hashing)
+	}
+	if m.find("/a", "docs", "x") != nil {
+		t.Error("a hashed file came back after it was removed")
+	}
+}
+
+func expectFs(t *testing.T, fs transport.Conn, kind, id string) {
+	t.Helper()
+	msg, err := fs.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != kind || msg.StringValue("id") != id {
+		t.Errorf("got %v, want %s of task %s", msg, kind, id)
+	}
+}
+
+func TestPauseRequeuesRunningHash(t *testing.T) {
+	m, fs := newTestModel(t, "/a")
+	first := hashTask(m, addFile(m, "/a", "", "x", ""))
+	hashTask(m, addFile(m, "/a", "", "y", ""))
+	m.dispatch()
+	expectFs(t, fs, "hash", first.id)
+
+	m.pause()
+	expectFs(t, fs, "cancel", first.id)
+	m.taskCanceled(&parser.Message{Type: "operation-canceled", Params: map[string]string{"id": first.id}})
+	if first.running || m.tasks[first.id] == nil || m.queues["/a"][0] != first {
+		t.Errorf("paused hash was not requeued: running %v, queue %v", first.running, m.queues["/a"])
+	}
+	m.dispatch()
+	if first.running {
+		t.Error("dispatched a task while paused")
+	}
+
+	m.resume()
+	expectFs(t, fs, "hash", first.id)
+}
+
+func TestCancelAndReorderTasks(t *testing.T) {
+	m, fs := newTestModel(t, "/a")
+	first := hashTask(m, addFile(m, "/a", "", "x", ""))
+	second := hashTask(m, addFile(m, "/a", "", "y", ""))
+	third := deleteTask(m, addFile(m, "/a", "", "z", "h1"))
+	m.dispatch()
+	expectFs(t, fs, "hash", first.id)
+
+	m.moveTaskUp(second.id)
+	if queue := m.queues["/a"]; queue[0] != first || queue[1] != second {
+		t.Error("moved a task above the running one")
+	}
+	m.moveTaskUp(third.id)
+	if queue := m.queues["/a"]; queue[1] != third || queue[2] != second {
+		t.Errorf("queue after moving the delete up: %v", queue)
+	}
+
+	m.cancelTask(third.id)
+	if m.tasks[third.id] != nil || len(m.queues["/a"]) != 2 {
+		t.Error("canceled delete stays queued")
+	}
+
+	m.cancelTask(first.id)
+	expectFs(t, fs, "cancel", first.id)
+	m.taskCanceled(&parser.Message{Type: "operation-canceled", Params: map[string]string{"id": first.id}})
+	if queue := m.queues["/a"]; len(queue) != 2 || queue[0] != second || queue[1] != first {
+		t.Errorf("canceled hash was not deferred: %v", queue)
+	}
+	expectFs(t, fs, "hash", second.id)
+}
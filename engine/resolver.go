@@ -0,0 +1,339 @@
+package engine
+
+import (
+	"arc/log"
+	"arc/parser"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+type operation struct {
+	kind operationKind
+	file *meta
+	from *meta
+	root string
+	path string
+	name string
+}
+
+type operationKind int
+
+const (
+	opCompare operationKind = iota
+	opDelete
+	opMove
+	opCopy
+)
+
+func (k operationKind) String() string {
+	switch k {
+	case opCompare:
+		return "compare"
+	case opDelete:
+		return "delete"
+	case opMove:
+		return "move"
+	case opCopy:
+		return "copy"
+	}
+	return "UNKNOWN OPERATION"
+}
+
+func (m *model) resolveAll() {
+	hashes := []string{}
+	for hash := range m.filesByHash {
+		hashes = append(hashes, hash)
+	}
+	m.resolve(hashes, true)
+}
+
+func (m *model) resolveEntry(root, path, name string) {
+	if m.archives[root] == nil {
+		m.reply("error", "error", "Unknown archive "+root)
+		return
+	}
+	entry := m.findFolder(root, path).child(name)
+	if entry == nil {
+		m.reply("error", "error", "No such entry "+filepath.Join(root, path, name))
+		return
+	}
+	hashes := []string{}
+	if entry.kind == kindRegular {
+		hashes = append(hashes, entry.hash)
+	} else {
+		entry.walk(func(file *meta) {
+			hashes = append(hashes, file.hash)
+		})
+	}
+	m.resolve(hashes, false)
+}
+
+func (m *model) resolve(hashes []string, full bool) {
+	if !m.ready() {
+		m.reply("error", "error", "Archives are not hashed yet")
+		return
+	}
+	if m.run != nil {
+		m.reply("error", "error", "Another run is in progress")
+		return
+	}
+
+	m.placed = map[string]string{}
+	m.unplaced = map[string]int{}
+	m.kept = map[*meta]bool{}
+	ops := []operation{}
+	for _, hash := range hashes {
+		if files := m.filesByHash[hash]; hash != "" && len(files) > 0 && files[0].state == divergent {
+			ops = append(ops, m.plan(files)...)
+		}
+	}
+	for group, files := range m.unplaced {
+		m.reply("error", "error", fmt.Sprintf("Spanning group %s is full: %d files do not fit on any member", group, files))
+	}
+	if len(m.kept) > 0 {
+		m.sendToUi("status", "status", fmt.Sprintf("Kept %d files that differ from the origin's file at the same path", len(m.kept)))
+	}
+	if len(ops) == 0 {
+		return
+	}
+
+	ordered := []operation{}
+	for _, kind := range []operationKind{opCompare, opDelete, opMove, opCopy} {
+		for _, op := range ops {
+			if op.kind == kind {
+				ordered = append(ordered, op)
+			}
+		}
+	}
+
+	m.batch = newBatch()
+	commands := make([]*parser.Message, len(ordered))
+	for i, op := range ordered {
+		commands[i] = op.command(m.batch)
+	}
+	if err := m.startRun(m.batch, commands, full && len(m.unplaced) == 0 && len(m.kept) == 0); err != nil {
+		log.Debug("failed to create run log", "batch", m.batch, "error", err)
+		m.reply("error", "error", "Not resolving: cannot create the run log: "+err.Error())
+		m.batch = ""
+		return
+	}
+	for i, op := range ordered {
+		m.execute(op, commands[i])
+	}
+	m.dispatch()
+}
+
+func (m *model) plan(files []*meta) []operation {
+	originUnit := m.originUnit()
+	originFiles := []*meta{}
+	for _, file := range files {
+		if slices.Contains(originUnit, file.root) {
+			originFiles = append(originFiles, file)
+		}
+	}
+
+	ops := []operation{}
+	for _, unit := range m.copyUnits() {
+		if slices.Equal(unit, originUnit) {
+			continue
+		}
+		writable := []string{}
+		for _, root := range unit {
+			if !m.archives[root].readOnly {
+				writable = append(writable, root)
+			}
+		}
+		if len(writable) == 0 {
+			continue
+		}
+		existing := []*meta{}
+		for _, file := range files {
+			if slices.Contains(unit, file.root) {
+				existing = append(existing, file)
+			}
+		}
+
+		missing := []*meta{}
+		conflicted := false
+		for _, originFile := range originFiles {
+			idx := -1
+			for i, file := range existing {
+				if file.name == originFile.name && file.folderPath() == originFile.folderPath() {
+					idx = i
+					break
+				}
+			}
+			if conflict := m.conflicting(unit, originFile); idx < 0 && conflict != nil {
+				m.kept[conflict] = true
+				conflicted = true
+			} else if idx >= 0 {
+				if m.paranoid {
+					ops = append(ops, operation{kind: opCompare, file: existing[idx], from: originFile, root: existing[idx].root})
+				}
+				existing = append(existing[:idx], existing[idx+1:]...)
+			} else {
+				missing = append(missing, originFile)
+			}
+		}
+
+		existing = slices.DeleteFunc(existing, func(file *meta) bool {
+			return m.archives[file.root].readOnly
+		})
+		for _, originFile := range missing {
+			if len(existing) > 0 {
+				ops = append(ops, operation{kind: opMove, file: existing[0], from: m.witness(originFile), root: existing[0].root, path: originFile.folderPath(), name: originFile.name})
+				existing = existing[1:]
+			} else {
+				root := writable[0]
+				if len(writable) > 1 {
+					root = m.place(writable, originFile.folderPath(), originFile.size)
+				}
+				if root == "" {
+					m.unplaced[m.archives[unit[0]].group]++
+					continue
+				}
+				ops = append(ops, operation{kind: opCopy, file: originFile, root: root, path: originFile.folderPath(), name: originFile.name})
+			}
+		}
+		if m.archives[unit[0]].role == roleArchiveOnly || conflicted {
+			continue
+		}
+		for _, file := range existing {
+			if m.conflicting(originUnit, file) != nil {
+				m.kept[file] = true
+				continue
+			}
+			op := operation{kind: opDelete, file: file, root: file.root}
+			if len(originFiles) > 0 {
+				op.from = m.witness(originFiles[0])
+			}
+			ops = append(ops, op)
+		}
+	}
+	if m.paranoid {
+		m.witnessDeletes(files, ops)
+	}
+	return ops
+}
+
+// witnessDeletes gives deletes without an origin copy to compare against
+// another copy of the file that is kept.
+func (m *model) witnessDeletes(files []*meta, ops []operation) {
+	deleted := map[*meta]bool{}
+	for _, op := range ops {
+		if op.kind == opDelete {
+			deleted[op.file] = true
+		}
+	}
+	for i, op := range ops {
+		if op.kind != opDelete || op.from != nil {
+			continue
+		}
+		for _, file := range files {
+			if !deleted[file] && !m.offline(file.root) {
+				ops[i].from = file
+				break
+			}
+		}
+	}
+}
+
+// With the keep policy a file on a copy that differs from the origin's file
+// at the same path is left alone. conflicting returns the copy's side of such
+// a conflict between file and the files of unit.
+func (m *model) conflicting(unit []string, file *meta) *meta {
+	if m.conflicts != "keep" {
+		return nil
+	}
+	for _, root := range unit {
+		if other := m.find(root, file.folderPath(), file.name); other != nil && other.hash != file.hash {
+			if slices.Contains(m.originUnit(), root) {
+				return file
+			}
+			return other
+		}
+	}
+	return nil
+}
+
+func (m *model) witness(file *meta) *meta {
+	if m.paranoid {
+		return file
+	}
+	return nil
+}
+
+func (op operation) command(batch string) *parser.Message {
+	file := op.file
+	cmd := &parser.Message{
+		Type:   op.kind.String(),
+		Params: map[string]string{"batch": batch},
+	}
+	switch op.kind {
+	case opCopy:
+		cmd.Params["from-root"] = file.root
+		cmd.Params["from-path"] = file.folderPath()
+		cmd.Params["from-name"] = file.name
+		cmd.Params["root"] = op.root
+		cmd.Params["path"] = op.path
+		cmd.Params["name"] = op.name
+		cmd.Params["hash"] = file.hash
+
+	case opMove:
+		cmd.Params["root"] = file.root
+		cmd.Params["path"] = file.folderPath()
+		cmd.Params["name"] = file.name
+		cmd.Params["to-path"] = op.path
+		cmd.Params["to-name"] = op.name
+		cmd.Params["hash"] = file.hash
+
+	case opDelete, opCompare:
+		cmd.Params["root"] = file.root
+		cmd.Params["path"] = file.folderPath()
+		cmd.Params["name"] = file.name
+		cmd.Params["hash"] = file.hash
+	}
+	if from := op.from; from != nil && op.kind != opCopy {
+		cmd.Params["from-root"] = from.root
+		cmd.Params["from-path"] = from.folderPath()
+		cmd.Params["from-name"] = from.name
+	}
+	return cmd
+}
+
+func (m *model) execute(op operation, cmd *parser.Message) {
+	m.enqueue(cmd, op.file)
+
+	file := op.file
+	if op.kind != opCopy {
+		file.state = pending
+	}
+	file.parent.updateState()
+	m.updateUiEntry(file)
+}
+
+func (m *model) ready() bool {
+	for _, archive := range m.archives {
+		if archive.state != archiveReady {
+			return false
+		}
+	}
+	return true
+}
+
+func newBatch() string {
+	return time.Now().UTC().Format("2006-01-02T15-04-05.000Z")
+}
+
+func (m *meta) folderPath() string {
+	return filepath.Join(m.path()...)
+}
+
+func (m *meta) fullPath() string {
+	if m.parent == nil {
+		return ""
+	}
+	return filepath.Join(m.folderPath(), m.name)
+}
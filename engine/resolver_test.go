@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func planned(m *model, hashes ...string) []string {
+	result := []string{}
+	for _, hash := range hashes {
+		for _, op := range m.plan(m.filesByHash[hash]) {
+			cmd := op.command("b1")
+			result = append(result, cmd.Type+" "+cmd.StringValue("root")+"/"+filepath.Join(cmd.StringValue("path"), cmd.StringValue("name")))
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+func TestConflictPolicies(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	addFile(m, "/a", "", "x", "h1")
+	addFile(m, "/b", "", "x", "h2")
+	m.kept = map[*meta]bool{}
+
+	got := planned(m, "h1", "h2")
+	want := []string{"copy /b/x", "delete /b/x"}
+	if !slices.Equal(got, want) {
+		t.Errorf("origin policy planned %v, want %v", got, want)
+	}
+
+	m.conflicts = "keep"
+	if got := planned(m, "h1", "h2"); len(got) != 0 {
+		t.Errorf("keep policy planned %v", got)
+	}
+	if len(m.kept) != 1 || !m.kept[m.find("/b", "", "x")] {
+		t.Errorf("kept %v, want /b/x", m.kept)
+	}
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+)
+
+type role int
+
+const (
+	roleMirror role = iota
+	roleOrigin
+	roleArchiveOnly
+	roleReadOnly
+)
+
+var roles = []role{roleOrigin, roleMirror, roleArchiveOnly, roleReadOnly}
+
+func (r role) String() string {
+	switch r {
+	case roleMirror:
+		return "mirror"
+	case roleOrigin:
+		return "origin"
+	case roleArchiveOnly:
+		return "archive-only"
+	case roleReadOnly:
+		return "read-only"
+	}
+	return "UNKNOWN ROLE"
+}
+
+func parseRole(name string) (role, bool) {
+	for _, r := range roles {
+		if r.String() == name {
+			return r, true
+		}
+	}
+	return roleMirror, false
+}
+
+func (m *model) origin() string {
+	for _, root := range m.roots {
+		if m.archives[root].role == roleOrigin {
+			return root
+		}
+	}
+	if len(m.roots) == 0 {
+		return ""
+	}
+	return m.roots[0]
+}
+
+func (m *model) role(root string) role {
+	if slices.Contains(m.originUnit(), root) {
+		return roleOrigin
+	}
+	return m.archives[root].role
+}
+
+func (m *model) originUnit() []string {
+	origin := m.origin()
+	for _, unit := range m.copyUnits() {
+		for _, root := range unit {
+			if root == origin {
+				return unit
+			}
+		}
+	}
+	return nil
+}
+
+func (m *model) allows(root, action string) error {
+	switch r := m.role(root); r {
+	case roleOrigin, roleReadOnly:
+		return fmt.Errorf("refusing to %s on %s root %s", action, r, root)
+	case roleArchiveOnly:
+		if action == "delete" || action == "overwrite" {
+			return fmt.Errorf("refusing to %s on %s root %s", action, r, root)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"arc/parser"
+	"arc/transport"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPlanFollowsRoles(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b", "/c", "/d")
+	m.archives["/c"].role = roleArchiveOnly
+	m.archives["/d"].role = roleReadOnly
+	m.archives["/d"].readOnly = true
+	m.kept = map[*meta]bool{}
+	addFile(m, "/a", "", "x", "h1")
+	for _, root := range []string{"/b", "/c", "/d"} {
+		addFile(m, root, "", "x", "h2")
+		addFile(m, root, "", "extra", "h3")
+	}
+
+	got := planned(m, "h1", "h2", "h3")
+	want := []string{"copy /b/x", "copy /c/x", "delete /b/extra", "delete /b/x"}
+	if !slices.Equal(got, want) {
+		t.Errorf("planned %v, want %v", got, want)
+	}
+}
+
+func TestSafetyFollowsRoles(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b", "/c", "/d")
+	m.archives["/c"].role = roleArchiveOnly
+	m.archives["/d"].role = roleReadOnly
+	m.minCopies = 0
+	source := addFile(m, "/a", "", "x", "h1")
+	copyTask := func(root, name string) *task {
+		cmd := &parser.Message{Type: "copy", Params: map[string]string{
+			"from-root": "/a", "from-path": "", "from-name": "x",
+			"root": root, "path": "", "name": name, "hash": "h1", "batch": "b1"}}
+		m.enqueue(cmd, source)
+		return m.tasks[cmd.StringValue("id")]
+	}
+
+	allowed := []*task{copyTask("/b", "new"), copyTask("/c", "new")}
+	refused := []*task{copyTask("/a", "new"), copyTask("/d", "new")}
+	for _, root := range []string{"/b", "/c"} {
+		file := addFile(m, root, "", "old", "h2")
+		if root == "/b" {
+			allowed = append(allowed, copyTask(root, "old"), deleteTask(m, file))
+		} else {
+			refused = append(refused, copyTask(root, "old"), deleteTask(m, file))
+		}
+	}
+
+	for _, task := range allowed {
+		if err := m.checkSafety(task); err != nil {
+			t.Errorf("%s on %s: %v", task.cmd.Type, task.lane, err)
+		}
+	}
+	for _, task := range refused {
+		if err := m.checkSafety(task); err == nil {
+			t.Errorf("%s %s/%s was allowed", task.cmd.Type, task.lane, task.cmd.StringValue("name"))
+		}
+	}
+}
+
+func TestScanRejectsUnknownRole(t *testing.T) {
+	m, fs := newTestModel(t, "/a")
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+
+	m.handleEvent(&parser.Message{Type: "scan", Params: map[string]string{"root": "/b", "role": "owner"}})
+	msg, err := ui.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "error" || !strings.Contains(msg.StringValue("error"), "Unknown role owner") {
+		t.Errorf("got %v", msg)
+	}
+	if m.archives["/b"] != nil || len(m.roots) != 1 {
+		t.Errorf("root with an unknown role added: %v", m.roots)
+	}
+
+	m.handleEvent(&parser.Message{Type: "scan", Params: map[string]string{"root": "/c"}})
+	if m.archives["/c"] == nil || m.archives["/c"].role != roleMirror {
+		t.Errorf("root without a role added as %v", m.archives["/c"])
+	}
+	if msg, err := fs.Receive(); err != nil || msg.Type != "scan" || msg.StringValue("root") != "/c" {
+		t.Errorf("got %v, %v", msg, err)
+	}
+}
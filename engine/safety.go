@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+func (m *model) checkSafety(t *task) error {
+	cmd := t.cmd
+	root := cmd.StringValue("root")
+	switch cmd.Type {
+	case "delete":
+		if err := m.allows(root, "delete"); err != nil {
+			return err
+		}
+		file := m.find(root, cmd.StringValue("path"), cmd.StringValue("name"))
+		return m.keepsCopies("delete", file, m.keptInAttic(file))
+
+	case "copy":
+		if err := m.allows(root, "write"); err != nil {
+			return err
+		}
+		target := m.find(root, cmd.StringValue("path"), cmd.StringValue("name"))
+		if target != nil && target.hash != cmd.StringValue("hash") {
+			if err := m.allows(root, "overwrite"); err != nil {
+				return err
+			}
+			return m.keepsCopies("overwrite", target, false)
+		}
+
+	case "move":
+		if err := m.allows(root, "write"); err != nil {
+			return err
+		}
+		target := m.find(root, cmd.StringValue("to-path"), cmd.StringValue("to-name"))
+		if target != nil && target != t.file && target.hash != t.file.hash {
+			if err := m.allows(root, "overwrite"); err != nil {
+				return err
+			}
+			return m.keepsCopies("overwrite", target, false)
+		}
+	}
+	return nil
+}
+
+func (m *model) keepsCopies(action string, file *meta, attic bool) error {
+	if m.minCopies <= 0 || file == nil || file.hash == "" {
+		return nil
+	}
+	copies := 0
+	if attic {
+		copies++
+	}
+	for _, other := range m.filesByHash[file.hash] {
+		if other == file || m.targeted(other) {
+			continue
+		}
+		if other.state == resolved || other.state == divergent {
+			copies++
+		}
+	}
+	if copies < m.minCopies {
+		return fmt.Errorf("refusing to %s %s: %d other verified copies of its content, %d required",
+			action, file.root+"/"+filepath.Join(file.folderPath(), file.name), copies, m.minCopies)
+	}
+	return nil
+}
+
+// A mirror drops files the origin no longer has. The delete moves the file
+// into the attic of its root, and as long as nothing prunes the attic that
+// copy counts towards the minimum.
+func (m *model) keptInAttic(file *meta) bool {
+	if file == nil || m.role(file.root) != roleMirror || m.atticMaxAge > 0 || m.atticMaxSize > 0 {
+		return false
+	}
+	originUnit := m.originUnit()
+	for _, other := range m.filesByHash[file.hash] {
+		if slices.Contains(originUnit, other.root) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *model) targeted(file *meta) bool {
+	for _, t := range m.queues[file.root] {
+		if t.file == file {
+			return true
+		}
+		cmd := t.cmd
+		switch cmd.Type {
+		case "copy":
+			if m.find(file.root, cmd.StringValue("path"), cmd.StringValue("name")) == file {
+				return true
+			}
+		case "move":
+			if m.find(file.root, cmd.StringValue("to-path"), cmd.StringValue("to-name")) == file {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *model) reject(t *task, err error) {
+	m.sendToUi("error", "error", err.Error())
+	t.running = false
+	m.removeTask(t)
+	m.stepFinished(t.cmd.StringValue("batch"), t.cmd.StringValue("step"), "failed")
+	m.taskAborted(t)
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"arc/parser"
+	"strings"
+	"testing"
+)
+
+func addFile(m *model, root, path, name, hash string) *meta {
+	folder := m.folder(root, path)
+	file := &meta{kind: kindRegular, root: root, name: name, parent: folder, size: 1, hash: hash, state: resolved}
+	folder.addChild(file)
+	m.filesByHash[hash] = append(m.filesByHash[hash], file)
+	return file
+}
+
+func deleteTask(m *model, file *meta) *task {
+	cmd := &parser.Message{Type: "delete", Params: map[string]string{
+		"root": file.root, "path": file.folderPath(), "name": file.name, "hash": file.hash, "batch": "b1"}}
+	m.enqueue(cmd, file)
+	return m.tasks[cmd.StringValue("id")]
+}
+
+func TestDeleteNeedsAnotherCopy(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b", "/c")
+	m.minCopies = 1
+	addFile(m, "/a", "", "kept", "h1")
+	file := addFile(m, "/b", "", "extra", "h1")
+	if err := m.checkSafety(deleteTask(m, file)); err != nil {
+		t.Errorf("delete with a copy on the origin: %v", err)
+	}
+
+	m.atticMaxAge = 1
+	file = addFile(m, "/b", "", "gone", "h2")
+	if err := m.checkSafety(deleteTask(m, file)); err == nil {
+		t.Error("deleted the last copy while the attic is pruned")
+	}
+	m.atticMaxAge = 0
+	if err := m.checkSafety(deleteTask(m, file)); err != nil {
+		t.Errorf("mirror delete kept in the attic: %v", err)
+	}
+}
+
+func TestPendingCopyDoesNotCount(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b", "/c")
+	m.minCopies = 1
+	m.atticMaxSize = 1
+	file := addFile(m, "/b", "", "x", "h1")
+	other := addFile(m, "/c", "", "x", "h1")
+
+	other.state = pending
+	err := m.checkSafety(deleteTask(m, file))
+	if err == nil || !strings.Contains(err.Error(), "0 other verified copies") {
+		t.Errorf("delete with only a pending copy: %v", err)
+	}
+
+	other.state = divergent
+	if err := m.checkSafety(deleteTask(m, file)); err != nil {
+		t.Errorf("delete with a verified copy: %v", err)
+	}
+
+	deleteTask(m, other)
+	if err := m.checkSafety(deleteTask(m, file)); err == nil {
+		t.Error("counted a copy that the same plan deletes")
+	}
+}
@@ -2,7 +2,6 @@ package engine
 
 import (
 	"fmt"
-	"io"
 	"path/filepath"
 	"strings"
 	"time"
@@ -12,16 +11,48 @@ type (
 	model struct {
 		roots       []string
 		archives    map[string]*archive
+		diffs       map[string]*meta
 		filesByHash map[string][]*meta
-		fsEvents    io.ReadCloser
-		fsCommands  io.WriteCloser
-		uiEvents    io.ReadCloser
-		uiCommands  io.WriteCloser
-
-		curRoot string
-		curPath string
-
-		quit bool
+		connect     Connector
+		backends    map[string]*backend
+		stopped     int
+		stopping    int
+		events      chan event
+		lost        chan *backend
+		clients     []*client
+		client      *client
+		req         string
+
+		batch       string
+		batches     map[string]*batchInfo
+		batchLists  map[string]bool
+		batchClient *client
+		undoRefused map[string]error
+		run         *run
+		runsFound   bool
+
+		tasks      map[string]*task
+		queues     map[string][]*task
+		lastTaskId int
+		paused     bool
+		exports    map[string]string
+		placed     map[string]string
+		unplaced   map[string]int
+		paranoid   bool
+		hashAlgo   string
+		conflicts  string
+		xattrs     bool
+		kept       map[*meta]bool
+		minCopies  int
+		catalogs   int
+		ignore     []string
+		session    string
+
+		atticClient  *client
+		atticMaxAge  time.Duration
+		atticMaxSize int
+
+		quit chan struct{}
 	}
 
 	archive struct {
@@ -29,6 +60,18 @@ type (
 		idx        int
 		rootFolder *meta
 		state      archiveState
+		hashing    int
+		readOnly   bool
+		group      string
+		free       int
+		lastSynced time.Time
+		syncedFrom string
+		id         string
+		volume     string
+		role       role
+		label      string
+		lockedBy   string
+		resumeTo   archiveState
 	}
 
 	archiveState int
@@ -48,14 +91,11 @@ type (
 		progress int
 		hash     string
 		counts   []int
+		change   string
 		children map[string]*meta
 	}
 )
 
-func (m *model) curArchive() *archive {
-	return m.archives[m.curRoot]
-}
-
 func (m *meta) addChild(file *meta) {
 	if m.children == nil {
 		m.children = map[string]*meta{}
@@ -63,6 +103,13 @@ func (m *meta) addChild(file *meta) {
 	m.children[file.name] = file
 }
 
+func (m *meta) child(name string) *meta {
+	if m == nil {
+		return nil
+	}
+	return m.children[name]
+}
+
 func (m *meta) updateState() {
 	if m == nil {
 		return
@@ -119,6 +166,7 @@ const (
 	archiveHashing
 	archiveReady
 	archiveCopying
+	archiveOffline
 )
 
 func (s archiveState) String() string {
@@ -131,6 +179,8 @@ func (s archiveState) String() string {
 		return "archiveReady"
 	case archiveCopying:
 		return "archiveCopying"
+	case archiveOffline:
+		return "archiveOffline"
 	}
 	panic("Invalid archiveState")
 }
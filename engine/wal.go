@@ -0,0 +1,411 @@
+package engine
+
+import (
+	"arc/config"
+	"arc/log"
+	"arc/parser"
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type run struct {
+	batch       string
+	time        time.Time
+	roots       []string
+	ids         map[string]string
+	steps       []*parser.Message
+	status      map[string]string
+	file        *os.File
+	pending     int
+	full        bool
+	rollingBack bool
+	undoing     map[string]bool
+	err         error
+}
+
+func walName(batch string) string {
+	return config.Dir("runs", batch+".wal")
+}
+
+func (m *model) startRun(batch string, commands []*parser.Message, full bool) error {
+	name := walName(batch)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	r := &run{
+		batch:  batch,
+		time:   time.Now(),
+		roots:  slices.Clone(m.roots),
+		status: map[string]string{},
+		file:   file,
+		full:   full,
+	}
+
+	if full {
+		r.write("run", "batch", batch, "time", r.time, "full", "true")
+	} else {
+		r.write("run", "batch", batch, "time", r.time)
+	}
+	for _, root := range r.roots {
+		r.write("root", "root", root, "id", m.archives[root].id)
+	}
+	for i, command := range commands {
+		step := strconv.Itoa(i)
+		command.Params["step"] = step
+		r.steps = append(r.steps, command)
+		r.write(command.Type, params(command)...)
+	}
+	r.pending = len(commands)
+	if err := r.sync(); err != nil {
+		file.Close()
+		os.Remove(name)
+		return err
+	}
+	m.run = r
+	return nil
+}
+
+func readRun(name string) (*run, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := &run{ids: map[string]string{}, status: map[string]string{}}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		msg := parser.Parse(scanner.Text())
+		switch msg.Type {
+		case "run":
+			r.batch = msg.StringValue("batch")
+			r.full = msg.StringValue("full") == "true"
+			if r.time, err = msg.TimeValue("time"); err != nil {
+				return nil, fmt.Errorf("corrupt run log %q: %w", name, err)
+			}
+		case "root":
+			r.roots = append(r.roots, msg.StringValue("root"))
+			r.ids[msg.StringValue("root")] = msg.StringValue("id")
+		case "started", "done", "failed", "canceled":
+			r.status[msg.StringValue("step")] = msg.Type
+		case "rolling-back":
+			r.rollingBack = true
+		default:
+			r.steps = append(r.steps, msg)
+		}
+	}
+	if r.batch == "" {
+		return nil, fmt.Errorf("invalid run log %q", name)
+	}
+	return r, scanner.Err()
+}
+
+// write appends an entry to the run log. The first error sticks and is
+// returned by sync.
+func (r *run) write(kind string, params ...any) {
+	if r.file == nil || r.err != nil {
+		return
+	}
+	if _, err := r.file.WriteString(parser.String(kind, params...)); err != nil {
+		log.Debug("failed to write run log", "batch", r.batch, "error", err)
+		r.err = err
+	}
+}
+
+func (r *run) sync() error {
+	if r.file == nil || r.err != nil {
+		return r.err
+	}
+	if err := r.file.Sync(); err != nil {
+		log.Debug("failed to sync run log", "batch", r.batch, "error", err)
+		r.err = err
+	}
+	return r.err
+}
+
+func (r *run) started(step string) error {
+	r.status[step] = "started"
+	r.write("started", "step", step)
+	return r.sync()
+}
+
+// abortRun stops a run whose log cannot be written. Its steps are not
+// executed without a record of them; the log is kept so that the run can be
+// resumed or rolled back later.
+func (m *model) abortRun(err error) {
+	r := m.run
+	m.run = nil
+	if r.file != nil {
+		r.file.Close()
+	}
+	m.sendToUi("error", "error", "Stopping batch "+r.batch+": cannot write the run log: "+err.Error())
+	for _, root := range m.roots {
+		for _, t := range slices.Clone(m.queues[root]) {
+			if t.cmd.StringValue("batch") != r.batch {
+				continue
+			}
+			if t.running {
+				m.stopTask(t)
+				continue
+			}
+			m.removeTask(t)
+			m.taskAborted(t)
+		}
+	}
+}
+
+func (r *run) done() int {
+	count := 0
+	for _, status := range r.status {
+		if status == "done" {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *model) stepFinished(batch, step, status string) {
+	r := m.run
+	if r == nil || r.rollingBack || step == "" || batch != r.batch {
+		return
+	}
+	switch r.status[step] {
+	case "done", "failed", "canceled":
+		return
+	}
+	r.status[step] = status
+	r.write(status, "step", step)
+	if err := r.sync(); err != nil {
+		m.abortRun(err)
+		return
+	}
+	r.pending--
+	if r.pending == 0 {
+		m.finishRun()
+	}
+}
+
+func (m *model) finishRun() {
+	r := m.run
+	m.run = nil
+	if r.file != nil {
+		r.file.Close()
+	}
+	if err := os.Remove(walName(r.batch)); err != nil {
+		log.Debug("failed to remove run log", "batch", r.batch, "error", err)
+	}
+	if !r.rollingBack {
+		m.recordSync(r)
+	}
+	for _, root := range r.roots {
+		m.pruneAttic(root)
+	}
+}
+
+func (m *model) checkInterruptedRuns() {
+	names, _ := filepath.Glob(config.Dir("runs", "*.wal"))
+	for _, name := range names {
+		r, err := readRun(name)
+		if err != nil {
+			log.Debug("failed to read run log", "name", name, "error", err)
+			continue
+		}
+		if m.run != nil && m.run.batch == r.batch {
+			continue
+		}
+		m.relocateRun(r)
+		known := true
+		for _, root := range r.roots {
+			if !slices.Contains(m.roots, root) {
+				known = false
+			}
+		}
+		if !known {
+			continue
+		}
+		m.sendToUi("interrupted-run",
+			"batch", r.batch,
+			"time", r.time,
+			"steps", len(r.steps),
+			"done", r.done())
+	}
+}
+
+func (m *model) openRun(batch string) *run {
+	if m.run != nil {
+		m.reply("error", "error", "Another run is in progress")
+		return nil
+	}
+	r, err := readRun(walName(batch))
+	if err != nil {
+		log.Debug("failed to read run log", "batch", batch, "error", err)
+		m.reply("error", "error", err.Error())
+		return nil
+	}
+	m.relocateRun(r)
+	r.file, err = os.OpenFile(walName(batch), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Debug("failed to open run log", "batch", batch, "error", err)
+		m.reply("error", "error", err.Error())
+		return nil
+	}
+	m.run = r
+	return r
+}
+
+func (m *model) resumeRun(batch string) {
+	r := m.openRun(batch)
+	if r == nil {
+		return
+	}
+	m.batch = batch
+	for _, step := range r.steps {
+		switch r.status[step.StringValue("step")] {
+		case "done", "failed", "canceled":
+			continue
+		}
+		r.pending++
+	}
+	if r.pending == 0 {
+		m.finishRun()
+		return
+	}
+	for _, step := range r.steps {
+		id := step.StringValue("step")
+		switch r.status[id] {
+		case "done", "failed", "canceled":
+			continue
+		}
+		if m.stepApplied(step) {
+			m.stepFinished(batch, id, "done")
+			if m.run != r {
+				break
+			}
+			continue
+		}
+		file := m.find(step.StringValue("root"), step.StringValue("path"), step.StringValue("name"))
+		if step.Type == "copy" {
+			file = m.find(step.StringValue("from-root"), step.StringValue("from-path"), step.StringValue("from-name"))
+		}
+		if file == nil {
+			m.stepFinished(batch, id, "failed")
+			if m.run != r {
+				break
+			}
+			continue
+		}
+		m.enqueue(step, file)
+	}
+	m.dispatch()
+}
+
+func (m *model) stepApplied(step *parser.Message) bool {
+	root := step.StringValue("root")
+	path := step.StringValue("path")
+	name := step.StringValue("name")
+	switch step.Type {
+	case "copy":
+		file := m.find(root, path, name)
+		return file != nil && file.hash == step.StringValue("hash")
+	case "move":
+		return m.find(root, path, name) == nil && m.find(root, step.StringValue("to-path"), step.StringValue("to-name")) != nil
+	case "delete":
+		return m.find(root, path, name) == nil
+	}
+	return false
+}
+
+func (m *model) rollbackRun(batch string) {
+	r := m.openRun(batch)
+	if r == nil {
+		return
+	}
+	r.rollingBack = true
+	r.write("rolling-back")
+	if err := r.sync(); err != nil {
+		m.abortRun(err)
+		return
+	}
+	r.undoing = map[string]bool{}
+	for _, root := range r.roots {
+		if m.archives[root] == nil || m.offline(root) {
+			m.sendToUi("error", "error", "Not undoing "+batch+" on "+root+": the root is not available")
+			continue
+		}
+		r.undoing[root] = true
+	}
+	if len(r.undoing) == 0 {
+		m.finishRun()
+		return
+	}
+	for _, root := range r.roots {
+		if r.undoing[root] {
+			m.planUndo(root, batch)
+		}
+	}
+}
+
+func (m *model) batchUndone(msg *parser.Message) {
+	r := m.run
+	if r == nil || !r.rollingBack || msg.StringValue("batch") != r.batch {
+		return
+	}
+	m.rootUndone(msg.StringValue("root"))
+}
+
+// undoUnavailable counts a root that went offline during a rollback as
+// failed, so the rollback does not wait for it forever.
+func (m *model) undoUnavailable(root string) {
+	r := m.run
+	if r == nil || !r.rollingBack || !r.undoing[root] {
+		return
+	}
+	m.sendToUi("error", "error", "Undoing "+r.batch+" on "+root+" failed: the root is not available")
+	m.rootUndone(root)
+}
+
+func (m *model) rootUndone(root string) {
+	r := m.run
+	if !r.undoing[root] {
+		return
+	}
+	delete(r.undoing, root)
+	if len(r.undoing) == 0 {
+		m.finishRun()
+	}
+}
+
+func (m *model) find(root, path, name string) *meta {
+	archive := m.archives[root]
+	if archive == nil {
+		return nil
+	}
+	folder := archive.rootFolder
+	for _, segment := range parsePath(path) {
+		folder = folder.children[segment]
+		if folder == nil {
+			return nil
+		}
+	}
+	return folder.children[name]
+}
+
+func params(msg *parser.Message) []any {
+	result := make([]any, 0, 2*len(msg.Params))
+	for name, value := range msg.Params {
+		result = append(result, name, value)
+	}
+	return result
+}
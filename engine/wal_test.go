@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"arc/config"
+	"arc/parser"
+	"arc/transport"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testSteps() []*parser.Message {
+	return []*parser.Message{
+		{Type: "copy", Params: map[string]string{"root": "/b", "path": "", "name": "new", "from-root": "/a", "from-path": "", "from-name": "new", "hash": "h1", "batch": "b1"}},
+		{Type: "delete", Params: map[string]string{"root": "/b", "path": "", "name": "old", "hash": "h2", "batch": "b1"}},
+	}
+}
+
+func TestRunLogRecordsProgress(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	m.startRun("b1", testSteps(), true)
+	m.run.started("0")
+	m.stepFinished("b1", "0", "done")
+
+	r, err := readRun(walName("b1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.batch != "b1" || !r.full || len(r.roots) != 2 || r.ids["/b"] != "id-/b" {
+		t.Errorf("run header = %+v", r)
+	}
+	if len(r.steps) != 2 || r.steps[0].Type != "copy" || r.steps[1].Type != "delete" {
+		t.Fatalf("steps = %v", r.steps)
+	}
+	if r.steps[1].StringValue("name") != "old" || r.steps[1].StringValue("step") != "1" {
+		t.Errorf("second step = %v", r.steps[1])
+	}
+	if r.status["0"] != "done" || r.status["1"] != "" || r.done() != 1 {
+		t.Errorf("status = %v", r.status)
+	}
+}
+
+func TestInterruptedRunIsOffered(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	m.startRun("b1", testSteps(), true)
+	m.stepFinished("b1", "1", "failed")
+	m.run.file.Close()
+	m.run = nil
+
+	ui, engineSide := transport.Pipe()
+	m.addClient(engineSide)
+	m.checkInterruptedRuns()
+	m.flushClients()
+
+	msg, err := ui.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "interrupted-run" || msg.StringValue("batch") != "b1" ||
+		msg.StringValue("steps") != "2" || msg.StringValue("done") != "0" {
+		t.Errorf("got %v", msg)
+	}
+}
+
+func TestRunNeedsItsLog(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	if err := os.WriteFile(config.Dir("runs"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+	addFile(m, "/a", "", "x", "h1").state = divergent
+
+	m.resolve([]string{"h1"}, false)
+	if m.run != nil || len(m.tasks) != 0 {
+		t.Errorf("resolved without a run log: run %v, %d tasks", m.run, len(m.tasks))
+	}
+	msg, err := ui.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "error" || !strings.Contains(msg.StringValue("error"), "run log") {
+		t.Errorf("got %v", msg)
+	}
+}
+
+func TestRunKeepsItsRoots(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	if err := m.startRun("b1", testSteps(), true); err != nil {
+		t.Fatal(err)
+	}
+	m.roots[1] = "/c"
+	if m.run.roots[1] != "/b" {
+		t.Errorf("run roots = %v", m.run.roots)
+	}
+}
+
+func TestCorruptRunLog(t *testing.T) {
+	t.Setenv("ARC_HOME", t.TempDir())
+	os.MkdirAll(config.Dir("runs"), 0755)
+	content := parser.String("run", "batch", "b1", "time", "yesterday")
+	if err := os.WriteFile(walName("b1"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := readRun(walName("b1")); err == nil {
+		t.Errorf("read a run log with a bad time: %+v", r)
+	}
+}
+
+func TestRollbackSkipsUnavailableRoots(t *testing.T) {
+	m, fs := newTestModel(t, "/a", "/b", "/c")
+	m.startRun("b1", testSteps(), true)
+	m.run.file.Close()
+	m.run = nil
+	m.archives["/c"].state = archiveOffline
+
+	m.rollbackRun("b1")
+	for i := 0; i < 2; i++ {
+		if msg, err := fs.Receive(); err != nil || msg.Type != "undo" || msg.StringValue("root") == "/c" {
+			t.Fatalf("got %v, %v", msg, err)
+		}
+	}
+	m.batchUndone(&parser.Message{Type: "batch-undone", Params: map[string]string{"root": "/a", "batch": "b1"}})
+	if m.run == nil {
+		t.Fatal("rollback finished before /b was undone")
+	}
+	m.archiveOffline("/b")
+	if m.run != nil {
+		t.Error("rollback still waits for an offline root")
+	}
+	if _, err := os.Stat(walName("b1")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("run log left behind: %v", err)
+	}
+}
+
+func TestRunStopsWhenItsLogFails(t *testing.T) {
+	m, fs := newTestModel(t, "/a", "/b")
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+	for _, file := range []*meta{addFile(m, "/a", "", "x", "h1"), addFile(m, "/a", "", "y", "h2")} {
+		file.state = divergent
+	}
+	m.resolve([]string{"h1", "h2"}, false)
+	msg, err := fs.Receive()
+	if err != nil || msg.Type != "copy" {
+		t.Fatalf("got %v, %v", msg, err)
+	}
+	batch := m.run.batch
+
+	m.run.file.Close()
+	m.handleEvent(&parser.Message{Type: "file-copied", Params: map[string]string{
+		"root": "/b", "path": "", "name": msg.StringValue("name"), "hash": msg.StringValue("hash"),
+		"size": "1", "mod-time": "2024-01-02T03:04:05Z", "batch": batch, "step": msg.StringValue("step"), "id": msg.StringValue("id")}})
+	if m.run != nil {
+		t.Fatal("run goes on without its log")
+	}
+	if len(m.tasks) != 0 {
+		t.Errorf("%d tasks still queued", len(m.tasks))
+	}
+	if _, err := os.Stat(walName(batch)); err != nil {
+		t.Errorf("run log removed: %v", err)
+	}
+	for {
+		msg, err := ui.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "error" && strings.Contains(msg.StringValue("error"), "cannot write the run log") {
+			break
+		}
+	}
+}
+
+func TestResolveWaitsForHashing(t *testing.T) {
+	m, _ := newTestModel(t, "/a", "/b")
+	ui, engineSide := transport.Pipe()
+	m.client = m.addClient(engineSide)
+	addFile(m, "/a", "", "x", "h1").state = divergent
+	m.archives["/b"].state = archiveHashing
+
+	m.resolve([]string{"h1"}, false)
+	msg, err := ui.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "error" || m.run != nil {
+		t.Errorf("got %v, run %v", msg, m.run)
+	}
+}
@@ -0,0 +1,118 @@
+package exec
+
+import (
+	"arc/config"
+	"arc/transport"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func Listen() (net.Listener, error) {
+	socket := config.Socket()
+	if running() {
+		return nil, fmt.Errorf("engine is already running on %s", socket)
+	}
+	os.Remove(socket)
+	if err := os.MkdirAll(filepath.Dir(socket), 0o755); err != nil {
+		return nil, err
+	}
+	return net.Listen("unix", socket)
+}
+
+func Attach() (transport.Conn, error) {
+	conn, err := net.Dial("unix", config.Socket())
+	if err != nil {
+		return nil, err
+	}
+	return transport.Stream(conn, conn), nil
+}
+
+func Daemon(args []string) error {
+	if running() {
+		return checkRoots(args)
+	}
+	cmd := exec.Command(os.Args[0], append([]string{"daemon"}, args...)...)
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	cmd.Process.Release()
+
+	for i := 0; i < 100; i++ {
+		if running() {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return errors.New("engine daemon did not start")
+}
+
+// checkRoots refuses to attach to a daemon that serves other roots than
+// the ones asked for.
+func checkRoots(args []string) error {
+	roots, err := config.Roots(args)
+	if err != nil {
+		return err
+	}
+	want := []string{}
+	for _, root := range roots {
+		members, _ := root.Members()
+		want = append(want, members...)
+	}
+	conn, err := Attach()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	have, err := daemonRoots(conn)
+	if err != nil {
+		return err
+	}
+	slices.Sort(want)
+	slices.Sort(have)
+	if !slices.Equal(have, want) {
+		return fmt.Errorf("engine is already running on %s with roots %s; stop it with arc ctl stop or attach with arc attach",
+			config.Socket(), strings.Join(have, " "))
+	}
+	return nil
+}
+
+func daemonRoots(conn transport.Conn) ([]string, error) {
+	req := strconv.Itoa(os.Getpid())
+	conn.Send("query-totals", "req", req)
+	roots := []string{}
+	for {
+		msg, err := conn.Receive()
+		if err != nil {
+			return nil, err
+		}
+		if msg.StringValue("req") != req {
+			continue
+		}
+		switch msg.Type {
+		case "totals":
+			roots = append(roots, msg.StringValue("root"))
+		case "error":
+			return nil, errors.New(msg.StringValue("error"))
+		case "done":
+			return roots, nil
+		}
+	}
+}
+
+func running() bool {
+	conn, err := net.Dial("unix", config.Socket())
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
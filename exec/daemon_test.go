@@ -0,0 +1,70 @@
+package exec
+
+import (
+	"arc/config"
+	"arc/engine"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func serveDaemon(t *testing.T, args ...string) {
+	t.Helper()
+	t.Setenv("ARC_HOME", t.TempDir())
+	t.Setenv("ARC_FS", "")
+	roots, err := config.Roots(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		engine.Serve(listener, Backend, roots, config.LoadOptions(nil))
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		conn, err := Attach()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		s := &session{t: t, conn: conn}
+		s.stop()
+		<-stopped
+	})
+}
+
+func TestDaemonChecksRunningRoots(t *testing.T) {
+	a, b, c := t.TempDir(), t.TempDir(), t.TempDir()
+	serveDaemon(t, "origin:"+a, b+"+"+c)
+
+	if err := Daemon([]string{c + "+" + b, a}); err != nil {
+		t.Errorf("same roots in another order: %v", err)
+	}
+	err := Daemon([]string{a, b})
+	if err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("other roots: %v", err)
+	}
+	if err := Daemon([]string{a, b, c, t.TempDir()}); err == nil {
+		t.Error("more roots than the daemon serves accepted")
+	}
+}
+
+func TestDaemonChecksProfileRoots(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	serveDaemon(t, a, b)
+	profiles := filepath.Join(t.TempDir(), "profiles")
+	os.WriteFile(profiles, []byte("[same]\nroot = "+a+"\nroot = "+b+"\n[other]\nroot = "+a+"\n"), 0644)
+	t.Setenv("ARC_PROFILES", profiles)
+
+	if err := Daemon([]string{"same"}); err != nil {
+		t.Errorf("profile with the running roots: %v", err)
+	}
+	if err := Daemon([]string{"other"}); err == nil {
+		t.Error("profile with other roots accepted")
+	}
+}
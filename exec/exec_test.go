@@ -0,0 +1,204 @@
+package exec
+
+import (
+	"arc/config"
+	"arc/fs"
+	"arc/parser"
+	"arc/transport"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("ARC_TEST_FS") == "1" {
+		fs.Run(transport.Stdio())
+		return
+	}
+	os.Exit(m.Run())
+}
+
+type session struct {
+	t    *testing.T
+	conn transport.Conn
+	req  int
+}
+
+func (s *session) request(kind string, params ...any) []*parser.Message {
+	s.t.Helper()
+	s.req++
+	req := strconv.Itoa(s.req)
+	s.conn.Send(kind, append([]any{"req", req}, params...)...)
+	replies := []*parser.Message{}
+	for {
+		msg, err := s.conn.Receive()
+		if err != nil {
+			s.t.Fatalf("%s: %v", kind, err)
+		}
+		if msg.StringValue("req") != req {
+			continue
+		}
+		if msg.Type == "done" {
+			return replies
+		}
+		if msg.Type == "error" {
+			s.t.Fatalf("%s: %s", kind, msg.StringValue("error"))
+		}
+		replies = append(replies, msg)
+	}
+}
+
+func (s *session) waitFor(what string, done func(totals map[string]*parser.Message) bool) {
+	s.t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		totals := map[string]*parser.Message{}
+		for _, msg := range s.request("query-totals") {
+			totals[msg.StringValue("root")] = msg
+		}
+		if done(totals) {
+			return
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("timed out waiting for %s: %v", what, totals)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (s *session) stop() {
+	s.t.Helper()
+	s.conn.Send("stop")
+	for {
+		msg, err := s.conn.Receive()
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		if msg.Type == "stopped" {
+			return
+		}
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if content == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("%s still exists", name)
+			}
+			continue
+		}
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, content)
+		}
+	}
+}
+
+func syncRoots(t *testing.T, origin, copy, copyRoot string) {
+	writeFiles(t, origin, map[string]string{
+		"a.txt":     "alpha",
+		"sub/b.txt": "beta",
+	})
+	writeFiles(t, copy, map[string]string{
+		"old/b.txt": "beta",
+		"stale.txt": "stale",
+	})
+
+	s := &session{t: t, conn: Engine(config.LoadOptions(nil))}
+	s.request("scan", "root", origin, "role", "origin")
+	s.request("scan", "root", copyRoot)
+	s.waitFor("roots to be hashed", func(totals map[string]*parser.Message) bool {
+		return len(totals) == 2 &&
+			totals[origin].StringValue("state") == "archiveReady" &&
+			totals[copyRoot].StringValue("state") == "archiveReady"
+	})
+
+	s.request("resolve-all")
+	s.waitFor("roots to be resolved", func(totals map[string]*parser.Message) bool {
+		for _, root := range []string{origin, copyRoot} {
+			if totals[root].StringValue("divergent") != "0" || totals[root].StringValue("pending") != "0" {
+				return false
+			}
+		}
+		return totals[copyRoot].StringValue("last-synced") != ""
+	})
+	s.stop()
+
+	checkFiles(t, copy, map[string]string{
+		"a.txt":     "alpha",
+		"sub/b.txt": "beta",
+		"old/b.txt": "",
+		"stale.txt": "",
+	})
+	checkFiles(t, origin, map[string]string{
+		"a.txt":     "alpha",
+		"sub/b.txt": "beta",
+	})
+}
+
+func TestSyncInProcess(t *testing.T) {
+	t.Setenv("ARC_HOME", t.TempDir())
+	t.Setenv("ARC_FS", "")
+	t.Setenv("ARC_ENGINE", "")
+	copy := t.TempDir()
+	syncRoots(t, t.TempDir(), copy, copy)
+}
+
+func TestSyncWithSha512(t *testing.T) {
+	t.Setenv("ARC_HOME", t.TempDir())
+	t.Setenv("ARC_FS", "")
+	t.Setenv("ARC_ENGINE", "")
+	t.Setenv("ARC_HASH", "sha512")
+	copy := t.TempDir()
+	syncRoots(t, t.TempDir(), copy, copy)
+}
+
+func TestSyncWithSpawnedBackend(t *testing.T) {
+	t.Setenv("ARC_HOME", t.TempDir())
+	t.Setenv("ARC_FS", os.Args[0])
+	t.Setenv("ARC_ENGINE", "")
+	t.Setenv("ARC_TEST_FS", "1")
+	copy := t.TempDir()
+	syncRoots(t, t.TempDir(), copy, copy)
+}
+
+func TestSyncAcrossBackends(t *testing.T) {
+	t.Setenv("ARC_HOME", t.TempDir())
+	t.Setenv("ARC_FS", "")
+	t.Setenv("ARC_ENGINE", "")
+	t.Setenv("ARC_REMOTE_FS", os.Args[0])
+	t.Setenv("ARC_TEST_FS", "1")
+	copy := t.TempDir()
+	syncRoots(t, t.TempDir(), copy, "ssh://test"+copy)
+}
+
+func TestBackendThatFailsToStart(t *testing.T) {
+	t.Setenv("ARC_HOME", t.TempDir())
+	t.Setenv("ARC_FS", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("ARC_ENGINE", "")
+	root := t.TempDir()
+
+	s := &session{t: t, conn: Engine(config.LoadOptions(nil))}
+	s.request("scan", "root", root)
+	s.waitFor("the root to go offline", func(totals map[string]*parser.Message) bool {
+		return totals[root].StringValue("state") == "archiveOffline"
+	})
+	s.stop()
+}
@@ -1,21 +1,62 @@
 package exec
 
 import (
+	"arc/config"
+	"arc/engine"
+	"arc/fs"
 	"arc/log"
+	"arc/transport"
 	"io"
+	"os"
 	"os/exec"
 	"strings"
 )
 
-func Start(commandLine string) (in io.ReadCloser, out io.WriteCloser) {
+func Start(commandLine string) (in io.ReadCloser, out io.WriteCloser, err error) {
 	command := strings.Split(commandLine, " ")
 	cmd := exec.Command(command[0], command[1:]...)
-	in, _ = cmd.StdoutPipe()
-	out, _ = cmd.StdinPipe()
-	cmdErr := cmd.Start()
-	if cmdErr != nil {
-		log.Debug("failed to start", "command", commandLine, "error", cmdErr)
-		return
+	if in, err = cmd.StdoutPipe(); err != nil {
+		return nil, nil, err
 	}
-	return in, out
+	if out, err = cmd.StdinPipe(); err != nil {
+		return nil, nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		log.Debug("failed to start", "command", commandLine, "error", err)
+		return nil, nil, err
+	}
+	return in, out, nil
+}
+
+func Connect(commandLine string) transport.Conn {
+	in, out, err := Start(commandLine)
+	if err != nil {
+		return transport.Closed()
+	}
+	return transport.Stream(in, out)
+}
+
+func FS() transport.Conn {
+	if commandLine := os.Getenv("ARC_FS"); commandLine != "" {
+		return Connect(commandLine)
+	}
+	engineSide, fsSide := transport.Pipe()
+	go fs.Run(fsSide)
+	return engineSide
+}
+
+func Backend(host string) transport.Conn {
+	if host == "" {
+		return FS()
+	}
+	return Connect(config.RemoteFS(host))
+}
+
+func Engine(options config.Options) transport.Conn {
+	if commandLine := os.Getenv("ARC_ENGINE"); commandLine != "" {
+		return Connect(commandLine)
+	}
+	uiSide, engineSide := transport.Pipe()
+	go engine.Run(engineSide, Backend, options)
+	return uiSide
 }
@@ -0,0 +1,161 @@
+package fs
+
+import (
+	"arc/log"
+	"arc/parser"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+func atticEntries(store storage) ([]*parser.Message, error) {
+	entries, err := readJournal(store)
+	if err != nil {
+		return nil, err
+	}
+	result := []*parser.Message{}
+	for _, entry := range entries {
+		trash := entry.StringValue("trash")
+		if entry.Type != "delete" || !strings.HasPrefix(trash, atticDir+string(filepath.Separator)) {
+			continue
+		}
+		if exists(store, dir(trash), filepath.Base(trash)) {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+func (fs *fsys) listAttic(root string) error {
+	entries, err := atticEntries(fs.storage(root))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fs.send("attic-entry",
+			"root", root,
+			"batch", entry.StringValue("batch"),
+			"path", entry.StringValue("path"),
+			"name", entry.StringValue("name"),
+			"trash", entry.StringValue("trash"),
+			"size", entry.Int("size"),
+			"mod-time", entry.Time("mod-time"),
+			"time", entry.Time("time"))
+	}
+	fs.send("attic-listed", "root", root)
+	return nil
+}
+
+func (fs *fsys) restoreAttic(cmd *parser.Message) error {
+	root := cmd.StringValue("root")
+	trash := cmd.StringValue("trash")
+	batch := cmd.StringValue("batch")
+	store := fs.storage(root)
+
+	entries, err := atticEntries(store)
+	if err != nil {
+		return err
+	}
+	var entry *parser.Message
+	for _, candidate := range entries {
+		if candidate.StringValue("trash") == trash {
+			entry = candidate
+		}
+	}
+	if entry == nil {
+		return fmt.Errorf("%s is not in the attic", trash)
+	}
+	path := entry.StringValue("path")
+	name := entry.StringValue("name")
+
+	if _, err := fs.trashExisting(store, root, path, name, batch); err != nil {
+		return err
+	}
+	if err := fs.journal(store, "restore",
+		"batch", batch,
+		"path", path,
+		"name", name,
+		"trash", trash); err != nil {
+		return err
+	}
+	if err := store.rename(dir(trash), filepath.Base(trash), path, name); err != nil {
+		return err
+	}
+
+	fs.send("file-restored",
+		"root", root,
+		"path", path,
+		"name", name,
+		"size", entry.Int("size"),
+		"mod-time", entry.Time("mod-time"),
+		"hash", entry.StringValue("hash"),
+		"batch", batch)
+	return nil
+}
+
+func (fs *fsys) pruneAttic(cmd *parser.Message) error {
+	root := cmd.StringValue("root")
+	maxAge := time.Duration(cmd.Int("max-age")) * time.Second
+	maxSize := cmd.Int("max-size")
+	store := fs.storage(root)
+	if store.readOnly() || (maxAge <= 0 && maxSize <= 0) {
+		return nil
+	}
+
+	entries, err := atticEntries(store)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time("time").Before(entries[j].Time("time"))
+	})
+	total := 0
+	for _, entry := range entries {
+		total += entry.Int("size")
+	}
+
+	files, size := 0, 0
+	for _, entry := range entries {
+		expired := maxAge > 0 && time.Since(entry.Time("time")) > maxAge
+		if !expired && (maxSize <= 0 || total <= maxSize) {
+			continue
+		}
+		trash := entry.StringValue("trash")
+		if err := fs.journal(store, "pruned", "batch", entry.StringValue("batch"), "trash", trash); err != nil {
+			log.Debug("pruning attic failed", "root", root, "trash", trash, "error", err)
+			continue
+		}
+		if err := store.remove(dir(trash), filepath.Base(trash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Debug("pruning attic failed", "root", root, "trash", trash, "error", err)
+			continue
+		}
+		total -= entry.Int("size")
+		files++
+		size += entry.Int("size")
+	}
+	if local, ok := localDir(store); ok {
+		removeEmptyDirs(local.name(atticDir, ""))
+	}
+	if files > 0 {
+		fs.send("attic-pruned", "root", root, "files", files, "size", size)
+	}
+	return nil
+}
+
+func removeEmptyDirs(name string) bool {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return false
+	}
+	empty := true
+	for _, entry := range entries {
+		if !entry.IsDir() || !removeEmptyDirs(filepath.Join(name, entry.Name())) {
+			empty = false
+		}
+	}
+	return empty && os.Remove(name) == nil
+}
@@ -0,0 +1,40 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreFromAttic(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a"), []byte("one"), 0644)
+	engine := startFs(t, root)
+
+	engine.Send("delete", "root", root, "path", "", "name", "a", "hash", sum("one"), "batch", "b1", "id", "1")
+	awaitMsg(t, engine, "file-deleted")
+	os.WriteFile(filepath.Join(root, "a"), []byte("two"), 0644)
+
+	engine.Send("list-attic", "root", root)
+	entry := awaitMsg(t, engine, "attic-entry")
+	if entry["name"] != "a" || entry["batch"] != "b1" {
+		t.Fatalf("attic entry = %v", entry)
+	}
+	awaitMsg(t, engine, "attic-listed")
+
+	engine.Send("restore-attic", "root", root, "trash", entry["trash"], "batch", "b2")
+	if msg := awaitMsg(t, engine, "file-restored"); msg["hash"] != sum("one") {
+		t.Errorf("restored %v", msg)
+	}
+	if content := readFile(t, filepath.Join(root, "a")); content != "one" {
+		t.Errorf("restored file = %q", content)
+	}
+	if content := readFile(t, filepath.Join(root, atticDir, "b2", "a")); content != "two" {
+		t.Errorf("file replaced by the restore = %q in the attic", content)
+	}
+
+	engine.Send("list-attic", "root", root)
+	if entry := awaitMsg(t, engine, "attic-entry"); entry["batch"] != "b2" {
+		t.Errorf("attic after restoring = %v", entry)
+	}
+}
@@ -0,0 +1,385 @@
+package fs
+
+import (
+	"arc/parser"
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type checksums struct {
+	ready chan struct{}
+	files map[string][]checksum
+}
+
+type checksum struct {
+	kind     string
+	sum      string
+	size     int
+	modTime  time.Time
+	manifest string
+	written  time.Time
+}
+
+func checksumKind(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case lower == "sha256sums" || strings.HasSuffix(lower, ".sha256"):
+		return "sha256"
+	case lower == "md5sums" || strings.HasSuffix(lower, ".md5"):
+		return "md5"
+	case strings.HasSuffix(lower, ".sfv"):
+		return "sfv"
+	}
+	return ""
+}
+
+func checksumName(kind string) string {
+	switch kind {
+	case "md5":
+		return "checksums.md5"
+	case "sfv":
+		return "checksums.sfv"
+	}
+	return "SHA256SUMS"
+}
+
+func newHash(kind string) hash.Hash {
+	switch kind {
+	case "md5":
+		return md5.New()
+	case "sfv":
+		return crc32.NewIEEE()
+	}
+	return sha256.New()
+}
+
+func (fs *fsys) startChecksums(root string) *checksums {
+	sums := &checksums{ready: make(chan struct{}), files: map[string][]checksum{}}
+	fs.lock.Lock()
+	fs.checksums[root] = sums
+	fs.lock.Unlock()
+	return sums
+}
+
+func (sums *checksums) read(store storage, path, name string) error {
+	_, written, err := store.stat(path, name)
+	if err != nil {
+		return err
+	}
+	content, err := store.open(path, name)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	kind := checksumKind(name)
+	manifest := filepath.Join(path, name)
+	sizes := map[string]checksum{}
+	lines := bufio.NewScanner(content)
+	for lines.Scan() {
+		line := strings.TrimRight(lines.Text(), "\r")
+		rel, sum := "", ""
+		switch {
+		case line == "":
+			continue
+		case line[0] == '#' || line[0] == ';':
+			if rel, size, modTime, ok := parseSizeComment(line[1:]); ok {
+				sizes[rel] = checksum{size: size, modTime: modTime}
+			}
+			continue
+		case kind == "sfv":
+			idx := strings.LastIndexByte(line, ' ')
+			if idx < 0 {
+				continue
+			}
+			rel, sum = line[:idx], line[idx+1:]
+		case strings.HasPrefix(line, strings.ToUpper(kind)+" ("):
+			rest := strings.TrimPrefix(line, strings.ToUpper(kind)+" (")
+			idx := strings.LastIndex(rest, ") = ")
+			if idx < 0 {
+				continue
+			}
+			rel, sum = rest[:idx], rest[idx+4:]
+		default:
+			sum, rel, _ = strings.Cut(line, " ")
+			rel = strings.TrimPrefix(strings.TrimPrefix(rel, " "), "*")
+		}
+		if rel == "" {
+			continue
+		}
+		sums.add(filepath.Join(path, filepath.FromSlash(rel)), checksum{
+			kind:     kind,
+			sum:      strings.ToLower(strings.TrimSpace(sum)),
+			size:     -1,
+			manifest: manifest,
+			written:  written,
+		})
+	}
+	for rel, info := range sizes {
+		for i, sum := range sums.files[filepath.Join(path, filepath.FromSlash(rel))] {
+			if sum.manifest == manifest {
+				sum.size, sum.modTime = info.size, info.modTime
+				sums.files[filepath.Join(path, filepath.FromSlash(rel))][i] = sum
+			}
+		}
+	}
+	return lines.Err()
+}
+
+func parseSizeComment(comment string) (string, int, time.Time, bool) {
+	fields := strings.SplitN(strings.TrimSpace(comment), " ", 3)
+	if len(fields) != 3 {
+		return "", 0, time.Time{}, false
+	}
+	size, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return "", 0, time.Time{}, false
+	}
+	modTime, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		return "", 0, time.Time{}, false
+	}
+	return fields[2], size, modTime, true
+}
+
+func (sums *checksums) add(file string, sum checksum) {
+	sums.files[file] = append(sums.files[file], sum)
+}
+
+func (fs *fsys) checksumsFor(root, path, name string) []checksum {
+	fs.lock.Lock()
+	sums := fs.checksums[root]
+	fs.lock.Unlock()
+	if sums == nil {
+		return nil
+	}
+	<-sums.ready
+	return sums.files[filepath.Join(path, name)]
+}
+
+func (sum checksum) current(size int, modTime time.Time) bool {
+	if sum.size >= 0 {
+		return sum.size == size && sum.modTime.Equal(modTime)
+	}
+	return !modTime.After(sum.written)
+}
+
+// valid reports whether the sum is a hex digest of the length its kind
+// produces, so a damaged manifest line is never taken as a file's hash.
+func (sum checksum) valid() bool {
+	length := map[string]int{"sha256": 64, "sha512": 128, "md5": 32, "sfv": 8}[sum.kind]
+	if len(sum.sum) != length {
+		return false
+	}
+	_, err := hex.DecodeString(sum.sum)
+	return err == nil
+}
+
+func (fs *fsys) hashChecked(root, path, name string, canceled chan struct{}) (string, error) {
+	sums := fs.checksumsFor(root, path, name)
+	if len(sums) == 0 {
+		return fs.hashFile(root, path, name, canceled)
+	}
+	store := fs.storage(root)
+	algo := fs.algo(root)
+	size, modTime, err := store.stat(path, name)
+	if err != nil {
+		return "", err
+	}
+	checked := []checksum{}
+	for _, sum := range sums {
+		if !sum.current(size, modTime) || !sum.valid() {
+			continue
+		}
+		if sum.kind == algo && sum.size >= 0 {
+			return sum.sum, nil
+		}
+		checked = append(checked, sum)
+	}
+	if len(checked) == 0 {
+		return fs.hashFile(root, path, name, canceled)
+	}
+
+	content, err := store.open(path, name)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	hashes := map[string]hash.Hash{algo: newFileHash(algo)}
+	writers := []io.Writer{hashes[algo]}
+	for _, sum := range checked {
+		if hashes[sum.kind] == nil {
+			hashes[sum.kind] = newHash(sum.kind)
+			writers = append(writers, hashes[sum.kind])
+		}
+	}
+	reader := &progressReader{
+		reader:   content,
+		canceled: canceled,
+		report: func(progress int) {
+			fs.send("hashing-progress",
+				"root", root,
+				"path", path,
+				"name", name,
+				"progress", progress)
+		},
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), reader); err != nil {
+		return "", err
+	}
+	for _, sum := range checked {
+		if actual := hex.EncodeToString(hashes[sum.kind].Sum(nil)); actual != sum.sum {
+			fs.send("checksum-mismatch",
+				"root", root,
+				"path", path,
+				"name", name,
+				"manifest", sum.manifest,
+				"kind", sum.kind)
+		}
+	}
+	return hex.EncodeToString(hashes[algo].Sum(nil)), nil
+}
+
+func (fs *fsys) writeChecksums(cmd *parser.Message, canceled chan struct{}) error {
+	id := cmd.StringValue("id")
+	root := cmd.StringValue("root")
+	path := cmd.StringValue("path")
+	kind := cmd.StringValue("format")
+	target := cmd.StringValue("target")
+
+	fs.lock.Lock()
+	files := fs.exports[id]
+	delete(fs.exports, id)
+	fs.lock.Unlock()
+
+	if target == "" {
+		name := checksumName(kind)
+		files = slices.DeleteFunc(files, func(file exportFile) bool {
+			return file.path == filepath.Join(path, name)
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+	total := 0
+	for _, file := range files {
+		total += file.size
+	}
+
+	store := fs.storage(root)
+	algo := fs.algo(root)
+	buf := &strings.Builder{}
+	comment := "#"
+	if kind == "sfv" {
+		comment = ";"
+	}
+	fmt.Fprintf(buf, "%s generated by arc from %s\n", comment, root)
+	done := 0
+	for _, file := range files {
+		rel, err := filepath.Rel(path, file.path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		sum := file.hash
+		if kind != algo {
+			sum, err = fs.checksumFile(store, file, algo, kind, canceled, func(progress int) {
+				fs.send("checksums-progress",
+					"id", id,
+					"root", root,
+					"target", target,
+					"size", total,
+					"progress", done+progress)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		done += file.size
+		fmt.Fprintf(buf, "%s %d %s %s\n", comment, file.size, file.modTime.UTC().Format(time.RFC3339), rel)
+		if kind == "sfv" {
+			fmt.Fprintf(buf, "%s %s\n", rel, strings.ToUpper(sum))
+		} else {
+			fmt.Fprintf(buf, "%s  %s\n", sum, rel)
+		}
+	}
+
+	content := buf.String()
+	if target == "" {
+		name := checksumName(kind)
+		modTime := time.Now().UTC().Round(time.Second)
+		sha := newFileHash(algo)
+		sha.Write([]byte(content))
+		hash := hex.EncodeToString(sha.Sum(nil))
+		batch := cmd.StringValue("batch")
+		if cmd.StringValue("keep-existing") == "true" && exists(store, path, name) {
+			return fmt.Errorf("refusing to overwrite %s on %s", filepath.Join(path, name), root)
+		}
+		trash, err := fs.trashExisting(store, root, path, name, batch)
+		if err != nil {
+			return err
+		}
+		if err := fs.journal(store, "copy",
+			"batch", batch,
+			"path", path,
+			"name", name,
+			"hash", hash); err != nil {
+			return err
+		}
+		err = store.create(path, name, strings.NewReader(content), len(content), modTime, algo, hash)
+		if err != nil {
+			fs.revertCopy(store, root, path, name, trash, batch, false)
+			return err
+		}
+		target = filepath.Join(root, path, name)
+		fs.send("file-copied",
+			"root", root,
+			"path", path,
+			"name", name,
+			"size", len(content),
+			"mod-time", modTime,
+			"hash", hash,
+			"batch", batch)
+	} else if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+		return err
+	}
+
+	fs.send("checksums-written",
+		"id", id,
+		"root", root,
+		"target", target,
+		"files", len(files))
+	return nil
+}
+
+func (fs *fsys) checksumFile(store storage, file exportFile, algo, kind string, canceled chan struct{}, report func(progress int)) (string, error) {
+	content, err := store.open(dir(file.path), filepath.Base(file.path))
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	sha, sum := newFileHash(algo), newHash(kind)
+	reader := &progressReader{reader: content, canceled: canceled, report: report}
+	if _, err := io.Copy(io.MultiWriter(sha, sum), reader); err != nil {
+		return "", err
+	}
+	if file.hash != "" && hex.EncodeToString(sha.Sum(nil)) != file.hash {
+		return "", fmt.Errorf("%s changed since it was hashed", file.path)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
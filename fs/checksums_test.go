@@ -0,0 +1,45 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestSumsAreValidated(t *testing.T) {
+	dir := t.TempDir()
+	trusted := strings.Repeat("ab", 32)
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	lines := []string{}
+	for name, sum := range map[string]string{"good": trusted, "short": "abc123", "bad": strings.Repeat("zz", 32)} {
+		file := filepath.Join(dir, name)
+		os.WriteFile(file, []byte(name), 0644)
+		os.Chtimes(file, modTime, modTime)
+		lines = append(lines, fmt.Sprintf("# %d %s %s", len(name), modTime.Format(time.RFC3339), name), sum+"  "+name)
+	}
+	os.WriteFile(filepath.Join(dir, "SHA256SUMS"), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	engine := startFs(t, dir)
+
+	want := map[string]string{"good": trusted, "short": sum("short"), "bad": sum("bad")}
+	for name, hash := range want {
+		engine.Send("hash", "root", dir, "path", "", "name", name, "id", name)
+		for {
+			msg, err := engine.Receive()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type == "checksum-mismatch" {
+				t.Errorf("%s: malformed sum reported as a mismatch", name)
+			}
+			if msg.Type == "file-hashed" {
+				if msg.StringValue("hash") != hash {
+					t.Errorf("%s hashed as %s, want %s", name, msg.StringValue("hash"), hash)
+				}
+				break
+			}
+		}
+	}
+}
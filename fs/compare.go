@@ -0,0 +1,85 @@
+package fs
+
+import (
+	"arc/parser"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+var errMismatch = errors.New("files with the same hash differ")
+
+func (fs *fsys) compare(cmd *parser.Message, canceled chan struct{}) error {
+	if err := fs.confirmSame(cmd, canceled); err != nil {
+		return err
+	}
+	fs.send("files-compared",
+		"root", cmd.StringValue("root"),
+		"path", cmd.StringValue("path"),
+		"name", cmd.StringValue("name"),
+		"id", cmd.StringValue("id"))
+	return nil
+}
+
+func (fs *fsys) confirmSame(cmd *parser.Message, canceled chan struct{}) error {
+	if cmd.StringValue("from-root") == "" {
+		return nil
+	}
+	root := cmd.StringValue("root")
+	path := cmd.StringValue("path")
+	name := cmd.StringValue("name")
+
+	source, _, _, err := fs.openSource(cmd)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	file, err := fs.storage(root).open(path, name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	same, err := sameContent(&progressReader{reader: file, canceled: canceled, report: func(int) {}}, source)
+	if err != nil {
+		return err
+	}
+	if !same {
+		fs.send("hash-mismatch",
+			"root", root,
+			"path", path,
+			"name", name,
+			"from-root", cmd.StringValue("from-root"),
+			"from-path", cmd.StringValue("from-path"),
+			"from-name", cmd.StringValue("from-name"),
+			"hash", cmd.StringValue("hash"))
+		return fmt.Errorf("%w: %s and %s", errMismatch,
+			filepath.Join(root, path, name),
+			filepath.Join(cmd.StringValue("from-root"), cmd.StringValue("from-path"), cmd.StringValue("from-name")))
+	}
+	return nil
+}
+
+func sameContent(a, b io.Reader) (bool, error) {
+	bufA := make([]byte, chunkSize)
+	bufB := make([]byte, chunkSize)
+	for {
+		n, errA := io.ReadFull(a, bufA)
+		m, errB := io.ReadFull(b, bufB)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return false, errA
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, errB
+		}
+		if !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+		if errA != nil || errB != nil {
+			return errA != nil && errB != nil, nil
+		}
+	}
+}
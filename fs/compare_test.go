@@ -0,0 +1,56 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompareSameFiles(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(a, "x"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(b, "x"), []byte("same"), 0644)
+	engine := startFs(t, a, b)
+
+	engine.Send("compare", "root", b, "path", "", "name", "x",
+		"from-root", a, "from-path", "", "from-name", "x", "hash", sum("same"), "id", "1")
+	if msg := awaitMsg(t, engine, "files-compared"); msg["root"] != b || msg["id"] != "1" {
+		t.Errorf("files-compared = %v", msg)
+	}
+}
+
+func TestCompareDifferentFiles(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(a, "x"), []byte("one"), 0644)
+	os.WriteFile(filepath.Join(b, "x"), []byte("two"), 0644)
+	engine := startFs(t, a, b)
+
+	engine.Send("compare", "root", b, "path", "", "name", "x",
+		"from-root", a, "from-path", "", "from-name", "x", "hash", sum("one"), "id", "1")
+	mismatch, failed := false, false
+	for !mismatch || !failed {
+		msg, err := engine.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch msg.Type {
+		case "hash-mismatch":
+			if msg.StringValue("from-root") != a || msg.StringValue("root") != b {
+				t.Errorf("hash-mismatch = %v", msg)
+			}
+			mismatch = true
+		case "operation-failed":
+			failed = true
+		case "files-compared":
+			t.Fatal("different files compared as the same")
+		}
+	}
+
+	// A delete witnessed by a different file is refused.
+	engine.Send("delete", "root", b, "path", "", "name", "x",
+		"from-root", a, "from-path", "", "from-name", "x", "hash", sum("two"), "batch", "b1", "id", "2")
+	awaitMsg(t, engine, "hash-mismatch")
+	if content := readFile(t, filepath.Join(b, "x")); content != "two" {
+		t.Errorf("file = %q after a refused delete", content)
+	}
+}
@@ -0,0 +1,530 @@
+package fs
+
+import (
+	"arc/config"
+	"arc/crypt"
+	"arc/log"
+	"arc/parser"
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cryptPrefix = "crypt:"
+
+var errPassphrase = errors.New("wrong passphrase")
+
+type cryptStorage struct {
+	lock   sync.Mutex
+	dir    localStorage
+	key    []byte
+	files  map[string]*cryptFile
+	logged int
+	err    error
+}
+
+type cryptFile struct {
+	path    string
+	name    string
+	size    int
+	modTime time.Time
+	algo    string
+	hash    string
+	id      string
+}
+
+func isCrypt(root string) bool {
+	return strings.HasPrefix(root, cryptPrefix)
+}
+
+func (fs *fsys) cryptStorage(root string) *cryptStorage {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	store, ok := fs.crypts[root]
+	if !ok || store.err != nil {
+		store = openCrypt(localStorage(strings.TrimPrefix(root, cryptPrefix)))
+		fs.crypts[root] = store
+	}
+	return store
+}
+
+func openCrypt(dir localStorage) *cryptStorage {
+	store := &cryptStorage{dir: dir, files: map[string]*cryptFile{}}
+	passphrase := config.Passphrase()
+	if passphrase == "" {
+		store.err = errors.New("ARC_PASSPHRASE is not set")
+		return store
+	}
+	store.err = store.unlock(passphrase)
+	if store.err == nil {
+		store.err = store.readIndex()
+	}
+	return store
+}
+
+func (s *cryptStorage) unlock(passphrase string) error {
+	name := s.dir.name(metaDir, "crypt")
+	content, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		s.key = crypt.Key(passphrase, salt)
+		check, err := crypt.Seal(s.key, []byte("arc"))
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		line := parser.String("crypt",
+			"salt", hex.EncodeToString(salt),
+			"check", base64.StdEncoding.EncodeToString(check))
+		return os.WriteFile(name, []byte(line), 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	msg := parser.Parse(strings.TrimSpace(string(content)))
+	salt, err := hex.DecodeString(msg.StringValue("salt"))
+	if err != nil {
+		return err
+	}
+	check, err := base64.StdEncoding.DecodeString(msg.StringValue("check"))
+	if err != nil {
+		return err
+	}
+	s.key = crypt.Key(passphrase, salt)
+	if _, err := crypt.Open(s.key, check); err != nil {
+		return errPassphrase
+	}
+	return nil
+}
+
+const indexLogLimit = 1000
+
+func (s *cryptStorage) readIndex() error {
+	sealed, err := os.ReadFile(s.dir.name(metaDir, "index"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		content, err := crypt.Open(s.key, sealed)
+		if err != nil {
+			return err
+		}
+		s.applyIndex(string(content))
+	}
+
+	name := s.dir.name(metaDir, "index-log")
+	content, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	good := 0
+	for i, line := range lines {
+		entry, err := s.openLogEntry(line)
+		if err != nil && i == len(lines)-1 {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("index-log: %w", err)
+		}
+		s.applyIndex(string(entry))
+		s.logged++
+		good += len(line) + 1
+	}
+	switch {
+	case good < len(content):
+		log.Debug("truncating torn crypt index-log", "root", s.dir, "size", len(content), "good", good)
+		return os.Truncate(name, int64(good))
+	case good > len(content):
+		return s.dir.appendMeta("index-log", "\n")
+	}
+	return nil
+}
+
+func (s *cryptStorage) openLogEntry(line string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, err
+	}
+	return crypt.Open(s.key, sealed)
+}
+
+func (s *cryptStorage) applyIndex(content string) {
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" {
+			continue
+		}
+		msg := parser.Parse(line)
+		key := filepath.Join(msg.StringValue("path"), msg.StringValue("name"))
+		if msg.Type == "remove" {
+			delete(s.files, key)
+			continue
+		}
+		file := &cryptFile{
+			path:    msg.StringValue("path"),
+			name:    msg.StringValue("name"),
+			size:    msg.Int("size"),
+			modTime: msg.Time("mod-time"),
+			algo:    msg.StringValue("algo"),
+			hash:    msg.StringValue("hash"),
+			id:      msg.StringValue("id"),
+		}
+		if file.algo == "" {
+			file.algo = "sha256"
+		}
+		s.files[key] = file
+	}
+}
+
+func (file *cryptFile) String() string {
+	return parser.String("file",
+		"path", file.path,
+		"name", file.name,
+		"size", file.size,
+		"mod-time", file.modTime,
+		"algo", file.algo,
+		"hash", file.hash,
+		"id", file.id)
+}
+
+func (s *cryptStorage) logIndex(entry string) error {
+	sealed, err := crypt.Seal(s.key, []byte(entry))
+	if err != nil {
+		return err
+	}
+	if err := s.dir.appendMeta("index-log", base64.StdEncoding.EncodeToString(sealed)+"\n"); err != nil {
+		return err
+	}
+	s.logged++
+	if s.logged < max(indexLogLimit, len(s.files)) {
+		return nil
+	}
+	if err := s.writeIndex(); err != nil {
+		log.Debug("compacting crypt index failed", "root", s.dir, "error", err)
+		return nil
+	}
+	s.logged = 0
+	return os.Remove(s.dir.name(metaDir, "index-log"))
+}
+
+func (s *cryptStorage) writeIndex() error {
+	buf := &strings.Builder{}
+	for _, file := range s.files {
+		buf.WriteString(file.String())
+	}
+	sealed, err := crypt.Seal(s.key, []byte(buf.String()))
+	if err != nil {
+		return err
+	}
+	name := s.dir.name(metaDir, "index")
+	if err := writeFile(name+".tmp", bytes.NewReader(sealed)); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+func (s *cryptStorage) data(id string) string {
+	return s.dir.name(filepath.Join("data", id[:2]), id)
+}
+
+func (s *cryptStorage) file(path, name string) (*cryptFile, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	file, ok := s.files[filepath.Join(path, name)]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: filepath.Join(path, name), Err: os.ErrNotExist}
+	}
+	copy := *file
+	return &copy, nil
+}
+
+func (s *cryptStorage) walk(visit func(path, name string, size int, modTime time.Time) error) error {
+	s.lock.Lock()
+	if s.err != nil {
+		s.lock.Unlock()
+		return s.err
+	}
+	files := []cryptFile{}
+	for key, file := range s.files {
+		if !isReserved(key) {
+			files = append(files, *file)
+		}
+	}
+	s.lock.Unlock()
+
+	sort.Slice(files, func(i, j int) bool {
+		return filepath.Join(files[i].path, files[i].name) < filepath.Join(files[j].path, files[j].name)
+	})
+	for _, file := range files {
+		if err := visit(file.path, file.name, file.size, file.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *cryptStorage) open(path, name string) (io.ReadCloser, error) {
+	file, err := s.file(path, name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.Open(s.data(file.id))
+	if err != nil {
+		return nil, err
+	}
+	reader, err := crypt.NewReader(content, s.key)
+	if err != nil {
+		content.Close()
+		return nil, err
+	}
+	return readCloser{Reader: reader, Closer: content}, nil
+}
+
+func (s *cryptStorage) stat(path, name string) (int, time.Time, error) {
+	file, err := s.file(path, name)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return file.size, file.modTime, nil
+}
+
+func (s *cryptStorage) opened() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+func (s *cryptStorage) create(path, name string, content io.Reader, size int, modTime time.Time, algo, hash string) error {
+	if err := s.opened(); err != nil {
+		return err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	file := &cryptFile{path: path, name: name, modTime: modTime.UTC().Round(time.Second), algo: algo, id: hex.EncodeToString(id)}
+	target := s.data(file.id)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	sum := newFileHash(algo)
+	counter := &countingWriter{}
+	err := s.seal(target, io.TeeReader(content, io.MultiWriter(sum, counter)))
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+	file.size = counter.n
+	file.hash = hex.EncodeToString(sum.Sum(nil))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := filepath.Join(path, name)
+	old := s.files[key]
+	s.files[key] = file
+	if err := s.logIndex(file.String()); err != nil {
+		s.files[key] = old
+		if old == nil {
+			delete(s.files, key)
+		}
+		os.Remove(target)
+		return err
+	}
+	if old != nil {
+		os.Remove(s.data(old.id))
+	}
+	return nil
+}
+
+func (s *cryptStorage) seal(target string, content io.Reader) error {
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer, err := crypt.NewWriter(out, s.key)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, content); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(buf []byte) (int, error) {
+	w.n += len(buf)
+	return len(buf), nil
+}
+
+func (s *cryptStorage) rename(path, name, toPath, toName string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	from, to := filepath.Join(path, name), filepath.Join(toPath, toName)
+	file, ok := s.files[from]
+	if !ok {
+		return &os.PathError{Op: "rename", Path: from, Err: os.ErrNotExist}
+	}
+	old := s.files[to]
+	delete(s.files, from)
+	moved := *file
+	moved.path, moved.name = toPath, toName
+	s.files[to] = &moved
+	if err := s.logIndex(parser.String("remove", "path", path, "name", name) + moved.String()); err != nil {
+		s.files[from] = file
+		s.files[to] = old
+		if old == nil {
+			delete(s.files, to)
+		}
+		return err
+	}
+	if old != nil {
+		os.Remove(s.data(old.id))
+	}
+	return nil
+}
+
+func (s *cryptStorage) remove(path, name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	key := filepath.Join(path, name)
+	file, ok := s.files[key]
+	if !ok {
+		return &os.PathError{Op: "remove", Path: key, Err: os.ErrNotExist}
+	}
+	delete(s.files, key)
+	if err := s.logIndex(parser.String("remove", "path", path, "name", name)); err != nil {
+		s.files[key] = file
+		return err
+	}
+	return os.Remove(s.data(file.id))
+}
+
+func (s *cryptStorage) appendMeta(name, entry string) error {
+	if err := s.opened(); err != nil {
+		return err
+	}
+	sealed, err := crypt.Seal(s.key, []byte(entry))
+	if err != nil {
+		return err
+	}
+	return s.dir.appendMeta(name, base64.StdEncoding.EncodeToString(sealed)+"\n")
+}
+
+func (s *cryptStorage) createMeta(name, entry string) (bool, error) {
+	if err := s.opened(); err != nil {
+		return false, err
+	}
+	sealed, err := crypt.Seal(s.key, []byte(entry))
+	if err != nil {
+		return false, err
+	}
+	return s.dir.createMeta(name, base64.StdEncoding.EncodeToString(sealed)+"\n")
+}
+
+func (s *cryptStorage) readMeta(name string) (io.ReadCloser, error) {
+	if err := s.opened(); err != nil {
+		return nil, err
+	}
+	content, err := s.dir.readMeta(name)
+	if content == nil || err != nil {
+		return content, err
+	}
+	defer content.Close()
+
+	journal := &bytes.Buffer{}
+	lines := bufio.NewScanner(content)
+	for lines.Scan() {
+		sealed, err := base64.StdEncoding.DecodeString(lines.Text())
+		if err != nil {
+			return nil, err
+		}
+		entry, err := crypt.Open(s.key, sealed)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		journal.Write(entry)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(journal), nil
+}
+
+func (s *cryptStorage) createLock(entry string) (bool, error) {
+	return s.dir.createLock(entry)
+}
+
+func (s *cryptStorage) readLock() (string, error) {
+	return s.dir.readLock()
+}
+
+func (s *cryptStorage) removeLock() error {
+	return s.dir.removeLock()
+}
+
+func (s *cryptStorage) readOnly() bool {
+	return false
+}
+
+func (s *cryptStorage) hash(path, name, algo string, canceled chan struct{}, report func(progress int)) (string, error) {
+	file, err := s.file(path, name)
+	if err != nil {
+		return "", err
+	}
+	if file.hash != "" && file.algo == algo {
+		return file.hash, nil
+	}
+	content, err := s.open(path, name)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	return hashContent(content, algo, canceled, report)
+}
+
+func (s *cryptStorage) free() (int, error) {
+	return s.dir.free()
+}
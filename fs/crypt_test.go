@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"arc/transport"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestCrypt(t *testing.T, dir string) *cryptStorage {
+	t.Helper()
+	s := openCrypt(localStorage(dir))
+	if s.err != nil {
+		t.Fatalf("open crypt %s: %v", dir, s.err)
+	}
+	return s
+}
+
+func TestCryptRoundTrip(t *testing.T) {
+	t.Setenv("ARC_PASSPHRASE", "secret")
+	dir := t.TempDir()
+	s := openTestCrypt(t, dir)
+	modTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := s.create("photos", "a.jpg", strings.NewReader("plain content"), 13, modTime, "sha256", "hash-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestCrypt(t, dir)
+	size, statTime, err := s.stat("photos", "a.jpg")
+	if err != nil || size != 13 || !statTime.Equal(modTime) {
+		t.Errorf("stat = %d, %v, %v; want 13, %v", size, statTime, err, modTime)
+	}
+	file, err := s.open("photos", "a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil || string(content) != "plain content" {
+		t.Errorf("content = %q, %v", content, err)
+	}
+}
+
+func TestCryptTruncatesTornIndexLog(t *testing.T) {
+	t.Setenv("ARC_PASSPHRASE", "secret")
+	dir := t.TempDir()
+	s := openTestCrypt(t, dir)
+	if err := s.create("", "a", strings.NewReader("a"), 1, time.Now(), "sha256", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.dir.appendMeta("index-log", "dG9ybg"); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestCrypt(t, dir)
+	if err := s.create("", "b", strings.NewReader("b"), 1, time.Now(), "sha256", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestCrypt(t, dir)
+	for _, name := range []string{"a", "b"} {
+		if _, _, err := s.stat("", name); err != nil {
+			t.Errorf("%s after torn write: %v", name, err)
+		}
+	}
+}
+
+func TestCryptWrongPassphraseFailsScan(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ARC_PASSPHRASE", "secret")
+	s := openTestCrypt(t, dir)
+	if err := s.create("", "a", strings.NewReader("a"), 1, time.Now(), "sha256", ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ARC_PASSPHRASE", "wrong")
+
+	engine, fsSide := transport.Pipe()
+	go Run(fsSide)
+	engine.Send("scan", "root", cryptPrefix+dir)
+	for {
+		msg, err := engine.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "file-scanned" || msg.Type == "archive-scanned" {
+			t.Fatalf("scan with a wrong passphrase reported %v", msg)
+		}
+		if msg.Type == "scan-failed" {
+			if !strings.Contains(msg.StringValue("error"), errPassphrase.Error()) {
+				t.Errorf("scan-failed error = %q", msg.StringValue("error"))
+			}
+			break
+		}
+	}
+	engine.Close()
+}
@@ -0,0 +1,273 @@
+package fs
+
+import (
+	"arc/catalog"
+	"arc/parser"
+	"archive/tar"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const manifestName = metaDir + "/manifest"
+
+type exportFile struct {
+	path    string
+	size    int
+	modTime time.Time
+	hash    string
+}
+
+func (fs *fsys) addExportFile(cmd *parser.Message) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	id := cmd.StringValue("id")
+	fs.exports[id] = append(fs.exports[id], exportFile{
+		path:    filepath.Join(cmd.StringValue("path"), cmd.StringValue("name")),
+		size:    cmd.Int("size"),
+		modTime: cmd.Time("mod-time"),
+		hash:    cmd.StringValue("hash"),
+	})
+}
+
+func (fs *fsys) export(cmd *parser.Message, canceled chan struct{}) error {
+	id := cmd.StringValue("id")
+	root := cmd.StringValue("root")
+	target := cmd.StringValue("target")
+
+	fs.lock.Lock()
+	files := fs.exports[id]
+	delete(fs.exports, id)
+	fs.lock.Unlock()
+
+	// A relative target would land in the backend's working directory,
+	// which for ssh roots is on the remote host.
+	if !filepath.IsAbs(target) {
+		return fmt.Errorf("export target %s is not an absolute path", target)
+	}
+
+	volumes := splitVolumes(files, cmd.Int("volume-size"))
+	total := 0
+	for _, file := range files {
+		total += file.size
+	}
+
+	names := []string{}
+	defer func() {
+		for _, name := range names {
+			os.Remove(name + ".partial")
+		}
+	}()
+
+	done := 0
+	for i, volume := range volumes {
+		name := volumeName(target, i, len(volumes))
+		names = append(names, name)
+		err := fs.writeVolume(root, name+".partial", volume, canceled, func(progress int) {
+			fs.send("export-progress",
+				"id", id,
+				"root", root,
+				"target", target,
+				"size", total,
+				"progress", done+progress)
+		})
+		if err != nil {
+			return err
+		}
+		for _, file := range volume {
+			done += file.size
+		}
+	}
+
+	for _, name := range names {
+		if err := os.Rename(name+".partial", name); err != nil {
+			return err
+		}
+	}
+	names = nil
+
+	fs.send("exported",
+		"id", id,
+		"root", root,
+		"target", target,
+		"files", len(files),
+		"size", total,
+		"volumes", len(volumes))
+	return nil
+}
+
+func splitVolumes(files []exportFile, volumeSize int) [][]exportFile {
+	volumes := [][]exportFile{}
+	current := []exportFile{}
+	size := 0
+	for _, file := range files {
+		fileSize := 512 + (file.size+511)/512*512
+		if volumeSize > 0 && len(current) > 0 && size+fileSize > volumeSize {
+			volumes = append(volumes, current)
+			current, size = []exportFile{}, 0
+		}
+		current = append(current, file)
+		size += fileSize
+	}
+	return append(volumes, current)
+}
+
+func volumeName(target string, idx, count int) string {
+	if count == 1 {
+		return target
+	}
+	base, ext := target, ""
+	if strings.HasSuffix(strings.ToLower(target), ".tar") {
+		base, ext = target[:len(target)-4], target[len(target)-4:]
+	}
+	return fmt.Sprintf("%s.%03d%s", base, idx+1, ext)
+}
+
+func (fs *fsys) writeVolume(root, name string, files []exportFile, canceled chan struct{}, report func(progress int)) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	manifest := &catalog.Catalog{Root: root, Algo: fs.algo(root), Time: time.Now().UTC().Round(time.Second)}
+	for _, file := range files {
+		manifest.Entries = append(manifest.Entries, catalog.Entry{
+			Path:    file.path,
+			Size:    file.size,
+			ModTime: file.modTime,
+			Hash:    file.hash,
+		})
+	}
+	buf := &bytes.Buffer{}
+	if err := catalog.Encode(buf, manifest); err != nil {
+		return err
+	}
+
+	writer := tar.NewWriter(out)
+	if err := writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     manifestName,
+		Size:     int64(buf.Len()),
+		Mode:     0644,
+		ModTime:  manifest.Time,
+	}); err != nil {
+		return err
+	}
+	if _, err := writer.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	done := 0
+	for _, file := range files {
+		err := fs.writeMember(writer, root, file, canceled, func(progress int) {
+			report(done + progress)
+		})
+		if err != nil {
+			return err
+		}
+		done += file.size
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+func (fs *fsys) writeMember(writer *tar.Writer, root string, file exportFile, canceled chan struct{}, report func(progress int)) error {
+	content, err := fs.storage(root).open(dir(file.path), filepath.Base(file.path))
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	if err := writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     filepath.ToSlash(file.path),
+		Size:     int64(file.size),
+		Mode:     0644,
+		ModTime:  file.modTime,
+	}); err != nil {
+		return err
+	}
+
+	hash := newFileHash(fs.algo(root))
+	reader := &progressReader{reader: content, canceled: canceled, report: report}
+	if _, err := io.Copy(io.MultiWriter(writer, hash), reader); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != file.hash {
+		return fmt.Errorf("%s changed since it was hashed", file.path)
+	}
+	return nil
+}
+
+func Verify(name string, report func(path, problem string)) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := tar.NewReader(file)
+	var manifest map[string]string
+	algo := ""
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Name == manifestName {
+			cat, err := catalog.Decode(reader)
+			if err != nil {
+				return err
+			}
+			manifest = map[string]string{}
+			algo = cat.Algo
+			for _, entry := range cat.Entries {
+				manifest[entry.Path] = entry.Hash
+			}
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if manifest == nil {
+			return fmt.Errorf("%s has no manifest", name)
+		}
+		path := memberName(header.Name)
+		expected, ok := manifest[path]
+		if !ok {
+			report(path, "not in manifest")
+			continue
+		}
+		delete(manifest, path)
+		hash := newFileHash(algo)
+		if _, err := io.Copy(hash, reader); err != nil {
+			return err
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != expected {
+			report(path, "hash mismatch")
+		}
+	}
+	if manifest == nil {
+		return fmt.Errorf("%s has no manifest", name)
+	}
+	for path := range manifest {
+		report(path, "missing")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package fs
+
+import (
+	"arc/transport"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportFiles(t *testing.T, engine transport.Conn, root, id string, files map[string]string) {
+	t.Helper()
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine.Send("export-file", "id", id, "path", dir(name), "name", filepath.Base(name),
+			"size", len(files[name]), "mod-time", info.ModTime().UTC().Round(time.Second), "hash", sum(files[name]))
+	}
+}
+
+func verifyVolume(t *testing.T, name string) map[string]string {
+	t.Helper()
+	problems := map[string]string{}
+	err := Verify(name, func(path, problem string) {
+		problems[path] = problem
+	})
+	if err != nil {
+		t.Fatalf("verify %s: %v", name, err)
+	}
+	return problems
+}
+
+func TestExportSplitsVolumes(t *testing.T) {
+	root, out := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"a":     strings.Repeat("a", 1000),
+		"sub/b": strings.Repeat("b", 1000),
+		"sub/c": strings.Repeat("c", 1000),
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Join(root, dir(name)), 0755)
+		os.WriteFile(filepath.Join(root, name), []byte(content), 0644)
+	}
+	engine := startFs(t, root)
+
+	// Every member takes 1536 bytes in the tar, so two fit in a volume.
+	exportFiles(t, engine, root, "e1", files)
+	engine.Send("export", "id", "e1", "root", root, "target", filepath.Join(out, "backup.tar"), "volume-size", 3072)
+	if msg := awaitMsg(t, engine, "exported"); msg["files"] != "3" || msg["volumes"] != "2" {
+		t.Fatalf("exported = %v", msg)
+	}
+
+	volumes, _ := filepath.Glob(filepath.Join(out, "*"))
+	want := []string{filepath.Join(out, "backup.001.tar"), filepath.Join(out, "backup.002.tar")}
+	if !slices.Equal(volumes, want) {
+		t.Fatalf("volumes = %v, want %v", volumes, want)
+	}
+
+	found := map[string]string{}
+	for _, volume := range volumes {
+		if problems := verifyVolume(t, volume); len(problems) > 0 {
+			t.Errorf("%s: %v", volume, problems)
+		}
+
+		// Every volume opens as a read-only root whose members match the manifest.
+		for name := range scanPacked(t, engine, volume) {
+			found[name] = volume
+			engine.Send("hash", "root", volume, "path", dir(name), "name", filepath.Base(name), "id", name)
+			if hash := awaitMsg(t, engine, "file-hashed")["hash"]; hash != sum(files[name]) {
+				t.Errorf("%s in %s hashed as %s", name, volume, hash)
+			}
+		}
+		engine.Send("delete", "root", volume, "path", "", "name", "a", "batch", "b1", "id", "d")
+		awaitMsg(t, engine, "operation-failed")
+	}
+	if len(found) != len(files) {
+		t.Errorf("volumes hold %v", found)
+	}
+}
+
+func TestExportRejectsRelativeTarget(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a"), []byte("one"), 0644)
+	engine := startFs(t, root)
+
+	exportFiles(t, engine, root, "e1", map[string]string{"a": "one"})
+	engine.Send("export", "id", "e1", "root", root, "target", "backup.tar", "volume-size", 0)
+	awaitMsg(t, engine, "operation-failed")
+	if _, err := os.Stat("backup.tar"); !os.IsNotExist(err) {
+		t.Errorf("relative export written: %v", err)
+	}
+}
+
+func TestVerifyReportsProblems(t *testing.T) {
+	hashes := map[string]string{
+		"a":         sum(packedFiles["a"]),
+		"sub/b":     sum("something else"),
+		"sub/c.txt": sum(packedFiles["sub/c.txt"]),
+		"gone":      sum("gone"),
+	}
+	name := filepath.Join(t.TempDir(), "test.tar")
+	writeTar(t, name, packedManifest(t, hashes))
+
+	problems := verifyVolume(t, name)
+	want := map[string]string{"sub/b": "hash mismatch", "gone": "missing"}
+	if len(problems) != len(want) {
+		t.Errorf("problems = %v, want %v", problems, want)
+	}
+	for path, problem := range want {
+		if problems[path] != problem {
+			t.Errorf("%s: %q, want %q", path, problems[path], problem)
+		}
+	}
+
+	writeTar(t, name, nil)
+	if err := Verify(name, func(path, problem string) {}); err == nil {
+		t.Error("volume without a manifest verified")
+	}
+}
@@ -0,0 +1,248 @@
+package fs
+
+import (
+	"arc/log"
+	"arc/parser"
+	"arc/transport"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+type fsys struct {
+	wg     sync.WaitGroup
+	engine transport.Conn
+
+	lock      sync.Mutex
+	running   map[string]chan struct{}
+	streams   map[string]stream
+	acks      map[string]chan struct{}
+	packed    map[string]*packed
+	crypts    map[string]*cryptStorage
+	exports   map[string][]exportFile
+	checksums map[string]*checksums
+	readOnly  map[string]bool
+	unlocked  map[string]bool
+	locks     map[string]string
+	sessions  map[string]string
+	ids       map[string]string
+	algos     map[string]string
+	xattrs    map[string]bool
+	offline   map[string]bool
+
+	quit atomic.Bool
+}
+
+var errCanceled = errors.New("canceled")
+
+func Run(engine transport.Conn) {
+	fs := &fsys{
+		engine:    engine,
+		running:   map[string]chan struct{}{},
+		streams:   map[string]stream{},
+		acks:      map[string]chan struct{}{},
+		packed:    map[string]*packed{},
+		crypts:    map[string]*cryptStorage{},
+		exports:   map[string][]exportFile{},
+		checksums: map[string]*checksums{},
+		readOnly:  map[string]bool{},
+		unlocked:  map[string]bool{},
+		locks:     map[string]string{},
+		sessions:  map[string]string{},
+		ids:       map[string]string{},
+		algos:     map[string]string{},
+		xattrs:    map[string]bool{},
+		offline:   map[string]bool{},
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			log.Debug("ERROR", "err", err)
+			log.Debug("STACK", "stack", debug.Stack())
+		}
+		fs.unlockAll()
+		fs.send("stopped")
+	}()
+
+	for {
+		cmd, err := engine.Receive()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic(err)
+		}
+		switch cmd.Type {
+		case "scan":
+			fs.lock.Lock()
+			fs.algos[cmd.StringValue("root")] = cmd.StringValue("hash")
+			fs.xattrs[cmd.StringValue("root")] = cmd.StringValue("xattrs") == "true"
+			fs.lock.Unlock()
+			if cmd.StringValue("read-only") != "true" {
+				fs.lockOrReadOnly(cmd)
+			} else {
+				fs.lock.Lock()
+				fs.readOnly[cmd.StringValue("root")] = true
+				fs.lock.Unlock()
+			}
+			fs.wg.Add(1)
+			go fs.scanArchive(cmd.StringValue("root"))
+
+		case "hash", "copy", "move", "delete", "undo", "list-batches", "read", "export", "checksums", "compare",
+			"list-attic", "restore-attic", "prune-attic":
+			if cmd.StringValue("stream") == "true" {
+				fs.openStream(cmd.StringValue("id"))
+			}
+			fs.wg.Add(1)
+			go fs.runOperation(cmd)
+
+		case "export-file", "checksums-file":
+			fs.addExportFile(cmd)
+
+		case "chunk":
+			fs.chunk(cmd)
+
+		case "chunk-end":
+			fs.chunkEnd(cmd)
+
+		case "chunk-ack":
+			fs.chunkAck(cmd.StringValue("id"))
+
+		case "cancel":
+			fs.cancel(cmd.StringValue("id"))
+
+		case "unlock":
+			fs.breakLock(cmd)
+
+		case "record-history":
+			if err := fs.recordHistory(cmd); err != nil {
+				log.Debug("recording history failed", "cmd", cmd, "error", err)
+			}
+
+		case "stop":
+			fs.quit.Store(true)
+			fs.cancelAll()
+			fs.wg.Wait()
+			return
+
+		default:
+			log.Debug("unrecognized command", "cmd", cmd)
+			fs.send("operation-failed", append(commandParams(cmd), "error", fmt.Sprintf("unrecognized command %q", cmd.Type))...)
+		}
+	}
+}
+
+func (fs *fsys) runOperation(cmd *parser.Message) {
+	defer fs.wg.Done()
+
+	id := cmd.StringValue("id")
+	canceled := make(chan struct{})
+	if id != "" {
+		fs.lock.Lock()
+		fs.running[id] = canceled
+		fs.lock.Unlock()
+
+		defer func() {
+			fs.lock.Lock()
+			delete(fs.running, id)
+			fs.lock.Unlock()
+		}()
+	}
+	if cmd.StringValue("stream") == "true" {
+		defer fs.closeStream(id)
+	}
+
+	var err error
+	switch cmd.Type {
+	case "copy", "move", "delete", "undo", "restore-attic":
+		if fs.storage(cmd.StringValue("root")).readOnly() {
+			err = errReadOnly
+		} else {
+			err = fs.execute(cmd, canceled)
+		}
+	default:
+		err = fs.execute(cmd, canceled)
+	}
+
+	if err == errCanceled {
+		fs.send("operation-canceled", commandParams(cmd)...)
+	} else if err != nil {
+		log.Debug("operation failed", "cmd", cmd, "error", err)
+		params := append(commandParams(cmd), "error", err.Error())
+		if !fs.checkOnline(cmd.StringValue("root"), cmd.StringValue("from-root")) {
+			params = append(params, "offline", "true")
+		}
+		fs.send("operation-failed", params...)
+	}
+}
+
+func (fs *fsys) execute(cmd *parser.Message, canceled chan struct{}) (err error) {
+	switch cmd.Type {
+	case "hash":
+		err = fs.hash(cmd, canceled)
+	case "copy":
+		err = fs.copyFile(cmd, canceled)
+	case "move":
+		err = fs.moveFile(cmd)
+	case "delete":
+		err = fs.deleteFile(cmd)
+	case "undo":
+		if cmd.StringValue("plan") == "true" {
+			err = fs.planUndo(cmd.StringValue("root"), cmd.StringValue("batch"))
+		} else {
+			err = fs.undo(cmd.StringValue("root"), cmd.StringValue("batch"))
+		}
+	case "list-batches":
+		err = fs.listBatches(cmd.StringValue("root"))
+	case "read":
+		err = fs.readFile(cmd, canceled)
+	case "export":
+		err = fs.export(cmd, canceled)
+	case "checksums":
+		err = fs.writeChecksums(cmd, canceled)
+	case "compare":
+		err = fs.compare(cmd, canceled)
+	case "list-attic":
+		err = fs.listAttic(cmd.StringValue("root"))
+	case "restore-attic":
+		err = fs.restoreAttic(cmd)
+	case "prune-attic":
+		err = fs.pruneAttic(cmd)
+	}
+	return err
+}
+
+func (fs *fsys) cancel(id string) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if canceled, ok := fs.running[id]; ok {
+		close(canceled)
+		delete(fs.running, id)
+	}
+}
+
+func (fs *fsys) cancelAll() {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	for id, canceled := range fs.running {
+		close(canceled)
+		delete(fs.running, id)
+	}
+}
+
+func commandParams(cmd *parser.Message) []any {
+	params := []any{"operation", cmd.Type}
+	for name, value := range cmd.Params {
+		params = append(params, name, value)
+	}
+	return params
+}
+
+func (fs *fsys) send(kind string, params ...any) {
+	fs.engine.Send(kind, params...)
+}
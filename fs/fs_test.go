@@ -0,0 +1,19 @@
+package fs
+
+import "testing"
+
+func TestUnknownCommandFails(t *testing.T) {
+	engine := startFs(t)
+	engine.Send("frobnicate", "root", "/a", "id", "1")
+	msg, err := engine.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "operation-failed" || msg.StringValue("operation") != "frobnicate" || msg.StringValue("id") != "1" {
+		t.Errorf("got %v", msg)
+	}
+
+	// The backend keeps serving after an unknown command.
+	engine.Send("list-batches", "root", t.TempDir())
+	awaitMsg(t, engine, "batches-listed")
+}
@@ -0,0 +1,50 @@
+package fs
+
+import (
+	"arc/parser"
+	"bufio"
+	"sort"
+	"time"
+)
+
+func (fs *fsys) recordHistory(cmd *parser.Message) error {
+	store := fs.storage(cmd.StringValue("root"))
+	if store.readOnly() {
+		return nil
+	}
+	params := []any{"time", time.Now().UTC()}
+	names := []string{}
+	for name := range cmd.Params {
+		if name != "root" && name != "event" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params = append(params, name, cmd.Params[name])
+	}
+	return store.appendMeta("history", parser.String(cmd.StringValue("event"), params...))
+}
+
+func historyParams(store storage) []any {
+	file, err := store.readMeta("history")
+	if file == nil || err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	last := map[string]*parser.Message{}
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		if lines.Text() != "" {
+			entry := parser.Parse(lines.Text())
+			last[entry.Type] = entry
+		}
+	}
+
+	entry := last["synced"]
+	if entry == nil {
+		return nil
+	}
+	return []any{"last-synced", entry.StringValue("time"), "synced-from", entry.StringValue("origin")}
+}
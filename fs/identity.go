@@ -0,0 +1,54 @@
+package fs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+type volumer interface {
+	volume() (string, error)
+}
+
+func readID(store storage) (string, error) {
+	content, err := store.readMeta("id")
+	if content == nil || err != nil {
+		return "", err
+	}
+	defer content.Close()
+	id, err := io.ReadAll(content)
+	first, _, _ := strings.Cut(strings.TrimSpace(string(id)), "\n")
+	return strings.TrimSpace(first), err
+}
+
+func archiveID(store storage) (string, error) {
+	id, err := readID(store)
+	if id != "" || err != nil || store.readOnly() {
+		return id, err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id = hex.EncodeToString(buf)
+
+	// Two sessions scanning a new root at once must agree on its id: the
+	// one that loses the race reads the winner's.
+	creator, ok := store.(metaCreator)
+	if !ok {
+		if err := store.appendMeta("id", id+"\n"); err != nil {
+			return "", err
+		}
+		return readID(store)
+	}
+	created, err := creator.createMeta("id", id+"\n")
+	if err != nil {
+		return "", err
+	}
+	if created {
+		return id, nil
+	}
+	return readID(store)
+}
@@ -0,0 +1,66 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func concurrentIDs(t *testing.T, store storage) {
+	t.Helper()
+	ids := make([]string, 8)
+	wg := sync.WaitGroup{}
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id, err := archiveID(store)
+			if err != nil {
+				t.Error(err)
+			}
+			ids[i] = id
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range ids {
+		if id == "" || id != ids[0] {
+			t.Fatalf("concurrent scans got ids %v", ids)
+		}
+	}
+	if id, err := archiveID(store); err != nil || id != ids[0] {
+		t.Errorf("id changed to %s, %v", id, err)
+	}
+}
+
+func TestArchiveIDIsCreatedOnce(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		concurrentIDs(t, localStorage(t.TempDir()))
+	})
+	t.Run("crypt", func(t *testing.T) {
+		t.Setenv("ARC_PASSPHRASE", "secret")
+		concurrentIDs(t, openTestCrypt(t, t.TempDir()))
+	})
+	t.Run("s3", func(t *testing.T) {
+		concurrentIDs(t, newTestS3Storage(t))
+	})
+}
+
+func TestArchiveIDReadsFirstLine(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, metaDir), 0755)
+	os.WriteFile(filepath.Join(root, metaDir, "id"), []byte("first\nsecond\n"), 0644)
+	if id, err := archiveID(localStorage(root)); err != nil || id != "first" {
+		t.Errorf("id = %q, %v", id, err)
+	}
+}
+
+func TestReadOnlyRootGetsNoID(t *testing.T) {
+	root := t.TempDir()
+	if id, err := archiveID(readOnlyStorage{localStorage(root)}); err != nil || id != "" {
+		t.Errorf("id = %q, %v", id, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, metaDir, "id")); !os.IsNotExist(err) {
+		t.Errorf("read-only root got an id file: %v", err)
+	}
+}
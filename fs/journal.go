@@ -0,0 +1,276 @@
+package fs
+
+import (
+	"arc/log"
+	"arc/parser"
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+func (fs *fsys) journal(store storage, kind string, params ...any) error {
+	params = append(params, "time", time.Now())
+	return store.appendMeta("journal", parser.String(kind, params...))
+}
+
+func readJournal(store storage) ([]*parser.Message, error) {
+	file, err := store.readMeta("journal")
+	if file == nil || err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := []*parser.Message{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if scanner.Text() != "" {
+			result = append(result, parser.Parse(scanner.Text()))
+		}
+	}
+	return result, scanner.Err()
+}
+
+func undoOps(store storage, batch string) (ops []*parser.Message, pruned bool, err error) {
+	entries, err := readJournal(store)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, entry := range entries {
+		if entry.StringValue("batch") != batch {
+			continue
+		}
+		switch entry.Type {
+		case "undo":
+			ops, pruned = ops[:0], false
+		case "pruned":
+			pruned = true
+		case "reverted":
+			ops = dropReverted(ops, entry)
+		default:
+			ops = append(ops, entry)
+		}
+	}
+	slices.Reverse(ops)
+	return ops, pruned, nil
+}
+
+// dropReverted removes the copy that failed and the trashing of the file it
+// was to replace, which the fs backend has already put back.
+func dropReverted(ops []*parser.Message, reverted *parser.Message) []*parser.Message {
+	path, name := reverted.StringValue("path"), reverted.StringValue("name")
+	for _, kind := range []string{"copy", "delete"} {
+		for i := len(ops) - 1; i >= 0; i-- {
+			if ops[i].Type == kind && ops[i].StringValue("path") == path && ops[i].StringValue("name") == name {
+				ops = slices.Delete(ops, i, i+1)
+				break
+			}
+		}
+	}
+	return ops
+}
+
+func errPruned(batch string) error {
+	return fmt.Errorf("batch %s can no longer be undone: files it deleted were pruned from the attic", batch)
+}
+
+func (fs *fsys) planUndo(root, batch string) error {
+	store := fs.storage(root)
+	ops, pruned, err := undoOps(store, batch)
+	if err != nil {
+		return err
+	}
+	if pruned {
+		fs.send("undo-planned", "root", root, "batch", batch, "error", errPruned(batch).Error())
+		return nil
+	}
+	for _, op := range ops {
+		if undone(store, op) {
+			continue
+		}
+		fs.send("undo-step",
+			"root", root,
+			"batch", batch,
+			"op", op.Type,
+			"path", op.StringValue("path"),
+			"name", op.StringValue("name"),
+			"to-path", op.StringValue("to-path"),
+			"to-name", op.StringValue("to-name"),
+			"hash", op.StringValue("hash"))
+	}
+	fs.send("undo-planned", "root", root, "batch", batch)
+	return nil
+}
+
+func (fs *fsys) undo(root, batch string) error {
+	store := fs.storage(root)
+	ops, pruned, err := undoOps(store, batch)
+	if err != nil {
+		return err
+	}
+	if pruned {
+		return errPruned(batch)
+	}
+
+	failed := 0
+	for _, op := range ops {
+		path := op.StringValue("path")
+		name := op.StringValue("name")
+		if undone(store, op) {
+			continue
+		}
+
+		switch op.Type {
+		case "copy":
+			hash, err := fs.hashFile(root, path, name, nil)
+			if err == nil && op.StringValue("hash") != "" && hash != op.StringValue("hash") {
+				err = fmt.Errorf("%s changed since it was copied", filepath.Join(path, name))
+			}
+			if err == nil {
+				_, err = fs.trash(store, root, path, name, hash, undoBatch(batch), "", "")
+			}
+			if err != nil {
+				log.Debug("undo copy failed", "root", root, "op", op, "error", err)
+				failed++
+				continue
+			}
+
+		case "move":
+			toPath := op.StringValue("to-path")
+			toName := op.StringValue("to-name")
+			if err := store.rename(toPath, toName, path, name); err != nil {
+				log.Debug("undo move failed", "root", root, "op", op, "error", err)
+				failed++
+				continue
+			}
+			fs.send("file-moved",
+				"root", root,
+				"path", toPath,
+				"name", toName,
+				"to-path", path,
+				"to-name", name,
+				"batch", batch)
+
+		case "restore":
+			trash := op.StringValue("trash")
+			if err := store.rename(path, name, dir(trash), filepath.Base(trash)); err != nil {
+				log.Debug("undo restore failed", "root", root, "op", op, "error", err)
+				failed++
+				continue
+			}
+			fs.send("file-deleted",
+				"root", root,
+				"path", path,
+				"name", name,
+				"batch", batch)
+
+		case "delete":
+			trash := op.StringValue("trash")
+			if err := store.rename(dir(trash), filepath.Base(trash), path, name); err != nil {
+				log.Debug("undo delete failed", "root", root, "op", op, "error", err)
+				failed++
+				continue
+			}
+			fs.send("file-restored",
+				"root", root,
+				"path", path,
+				"name", name,
+				"size", op.Int("size"),
+				"mod-time", op.Time("mod-time"),
+				"hash", op.StringValue("hash"),
+				"batch", batch)
+		}
+	}
+
+	if len(ops) > 0 && failed == 0 {
+		if err := fs.journal(store, "undo", "batch", batch); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		fs.send("batch-undone", "root", root, "batch", batch, "failed", failed)
+		return nil
+	}
+	fs.send("batch-undone", "root", root, "batch", batch)
+	return nil
+}
+
+// Files that an undo removes go to the attic under a batch of their own, so
+// that undoing the undo brings them back.
+func undoBatch(batch string) string {
+	return batch + "-undo"
+}
+
+func undone(store storage, op *parser.Message) bool {
+	path, name := op.StringValue("path"), op.StringValue("name")
+	switch op.Type {
+	case "copy":
+		return !exists(store, path, name)
+	case "move":
+		return !exists(store, op.StringValue("to-path"), op.StringValue("to-name")) && exists(store, path, name)
+	case "restore":
+		trash := op.StringValue("trash")
+		return !exists(store, path, name) && exists(store, dir(trash), filepath.Base(trash))
+	case "delete":
+		trash := op.StringValue("trash")
+		return !exists(store, dir(trash), filepath.Base(trash)) && exists(store, path, name)
+	}
+	return false
+}
+
+func (fs *fsys) listBatches(root string) error {
+	entries, err := readJournal(fs.storage(root))
+	if err != nil {
+		return err
+	}
+
+	type batchInfo struct {
+		batch  string
+		time   time.Time
+		ops    int
+		undone bool
+		pruned bool
+	}
+	batches := []*batchInfo{}
+	byId := map[string]*batchInfo{}
+	for _, entry := range entries {
+		id := entry.StringValue("batch")
+		info := byId[id]
+		if info == nil {
+			info = &batchInfo{batch: id, time: entry.Time("time")}
+			byId[id] = info
+			batches = append(batches, info)
+		}
+		switch entry.Type {
+		case "undo":
+			info.undone, info.pruned = true, false
+		case "pruned":
+			info.pruned = true
+		case "reverted":
+		default:
+			info.ops++
+			info.undone = false
+		}
+	}
+
+	for _, info := range batches {
+		undone, pruned := "false", "false"
+		if info.undone {
+			undone = "true"
+		}
+		if info.pruned {
+			pruned = "true"
+		}
+		fs.send("batch",
+			"root", root,
+			"batch", info.batch,
+			"time", info.time,
+			"ops", info.ops,
+			"undone", undone,
+			"pruned", pruned)
+	}
+	fs.send("batches-listed", "root", root)
+	return nil
+}
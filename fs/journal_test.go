@@ -0,0 +1,117 @@
+package fs
+
+import (
+	"arc/transport"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func startFs(t *testing.T, roots ...string) transport.Conn {
+	t.Helper()
+	t.Setenv("ARC_HOME", t.TempDir())
+	engine, fsSide := transport.Pipe()
+	go Run(fsSide)
+	t.Cleanup(func() { engine.Close() })
+	for _, root := range roots {
+		engine.Send("scan", "root", root, "session", "test")
+		awaitMsg(t, engine, "archive-scanned")
+	}
+	return engine
+}
+
+func awaitMsg(t *testing.T, engine transport.Conn, kind string) map[string]string {
+	t.Helper()
+	for {
+		msg, err := engine.Receive()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", kind, err)
+		}
+		if msg.Type == kind {
+			return msg.Params
+		}
+		if msg.Type == "operation-failed" {
+			t.Fatalf("waiting for %s: %v", kind, msg)
+		}
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func sum(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestUndoCopyKeepsChangedFile(t *testing.T) {
+	from, to := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(from, "a"), []byte("one"), 0644)
+	engine := startFs(t, from, to)
+
+	engine.Send("copy", "from-root", from, "from-path", "", "from-name", "a",
+		"root", to, "path", "", "name", "a", "hash", sum("one"), "batch", "b1", "id", "1")
+	awaitMsg(t, engine, "file-copied")
+
+	os.WriteFile(filepath.Join(to, "a"), []byte("edited"), 0644)
+	engine.Send("undo", "root", to, "batch", "b1")
+	if msg := awaitMsg(t, engine, "batch-undone"); msg["failed"] != "1" {
+		t.Errorf("undo of a changed copy = %v, want one failed step", msg)
+	}
+	if content := readFile(t, filepath.Join(to, "a")); content != "edited" {
+		t.Errorf("changed copy = %q after undo", content)
+	}
+
+	os.WriteFile(filepath.Join(to, "a"), []byte("one"), 0644)
+	engine.Send("undo", "root", to, "batch", "b1")
+	if msg := awaitMsg(t, engine, "batch-undone"); msg["failed"] != "" {
+		t.Errorf("undo = %v", msg)
+	}
+	if _, err := os.Stat(filepath.Join(to, "a")); !os.IsNotExist(err) {
+		t.Errorf("copy still there after undo: %v", err)
+	}
+	if content := readFile(t, filepath.Join(to, atticDir, "b1-undo", "a")); content != "one" {
+		t.Errorf("undone copy in the attic = %q", content)
+	}
+}
+
+func TestFailedCopyRestoresOverwrittenFile(t *testing.T) {
+	from, to := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(from, "a"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(to, "a"), []byte("old"), 0644)
+	engine := startFs(t, from, to)
+
+	engine.Send("copy", "from-root", from, "from-path", "", "from-name", "a",
+		"root", to, "path", "", "name", "a", "hash", sum("other"), "batch", "b1", "id", "1")
+	for {
+		msg, err := engine.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "file-copied" {
+			t.Fatal("copy with a wrong hash succeeded")
+		}
+		if msg.Type == "operation-failed" {
+			break
+		}
+	}
+	if content := readFile(t, filepath.Join(to, "a")); content != "old" {
+		t.Errorf("overwritten file = %q after the copy failed", content)
+	}
+
+	engine.Send("undo", "root", to, "batch", "b1")
+	if msg := awaitMsg(t, engine, "batch-undone"); msg["failed"] != "" {
+		t.Errorf("undo = %v", msg)
+	}
+	if content := readFile(t, filepath.Join(to, "a")); content != "old" {
+		t.Errorf("file = %q after undoing the failed copy", content)
+	}
+}
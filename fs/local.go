@@ -0,0 +1,233 @@
+package fs
+
+import (
+	"arc/log"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type localStorage string
+
+func (root localStorage) name(path, name string) string {
+	return filepath.Join(string(root), path, name)
+}
+
+func (root localStorage) walk(visit func(path, name string, size int, modTime time.Time) error) error {
+	return filepath.WalkDir(string(root), func(name string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && name != string(root) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() && isReserved(entry.Name()) && filepath.Dir(name) == filepath.Clean(string(root)) {
+			return filepath.SkipDir
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(string(root), name)
+		return visit(dir(rel), filepath.Base(rel), int(info.Size()), info.ModTime().UTC().Round(time.Second))
+	})
+}
+
+func (root localStorage) open(path, name string) (io.ReadCloser, error) {
+	return os.Open(root.name(path, name))
+}
+
+func (root localStorage) stat(path, name string) (int, time.Time, error) {
+	info, err := os.Stat(root.name(path, name))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return int(info.Size()), info.ModTime().UTC().Round(time.Second), nil
+}
+
+func (root localStorage) create(path, name string, content io.Reader, size int, modTime time.Time, algo, hash string) error {
+	return root.createFile(path, name, content, modTime, algo, hash, false)
+}
+
+func (root localStorage) createFile(path, name string, content io.Reader, modTime time.Time, algo, hash string, xattrs bool) error {
+	target := root.name(path, name)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	temp := filepath.Join(filepath.Dir(target), ".arc-copy-"+name)
+	written := newFileHash(algo)
+	if err := writeFile(temp, io.TeeReader(content, written)); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if err := os.Chtimes(temp, modTime, modTime); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	// Only tag the copy with the expected hash once its content is known to match.
+	if hash != "" && xattrs && hex.EncodeToString(written.Sum(nil)) == hash {
+		if info, err := os.Stat(temp); err == nil {
+			writeHashXattrs(temp, algo, hash, int(info.Size()), info.ModTime().UnixNano())
+		}
+	}
+	if err := os.Rename(temp, target); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
+
+func writeFile(name string, content io.Reader) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, content); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func (root localStorage) rename(path, name, toPath, toName string) error {
+	if err := os.MkdirAll(filepath.Join(string(root), toPath), 0755); err != nil {
+		return err
+	}
+	return os.Rename(root.name(path, name), root.name(toPath, toName))
+}
+
+func (root localStorage) remove(path, name string) error {
+	return os.Remove(root.name(path, name))
+}
+
+func (root localStorage) appendMeta(meta, entry string) error {
+	name := root.name(metaDir, meta)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(entry); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func (root localStorage) createLock(entry string) (bool, error) {
+	return root.createMeta("lock", entry)
+}
+
+func (root localStorage) createMeta(meta, entry string) (bool, error) {
+	name := root.name(metaDir, meta)
+	if err := os.Mkdir(filepath.Dir(name), 0755); err != nil && !os.IsExist(err) {
+		return false, err
+	}
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(entry); err != nil {
+		return true, err
+	}
+	return true, file.Sync()
+}
+
+func (root localStorage) readLock() (string, error) {
+	content, err := os.ReadFile(root.name(metaDir, "lock"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(content), err
+}
+
+func (root localStorage) removeLock() error {
+	return os.Remove(root.name(metaDir, "lock"))
+}
+
+func (root localStorage) readMeta(name string) (io.ReadCloser, error) {
+	file, err := os.Open(root.name(metaDir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return file, err
+}
+
+func (root localStorage) readOnly() bool {
+	return false
+}
+
+func (root localStorage) hash(path, name, algo string, canceled chan struct{}, report func(progress int)) (string, error) {
+	return root.hashFile(path, name, algo, canceled, report, false, false)
+}
+
+func (root localStorage) hashFile(path, name, algo string, canceled chan struct{}, report func(progress int), readXattrs, storeXattrs bool) (string, error) {
+	file, err := os.Open(root.name(path, name))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	size, modTime := int(info.Size()), info.ModTime().UnixNano()
+	if readXattrs {
+		if hash, xsize, xmodTime, ok := readHashXattrs(file.Name(), algo); ok && xsize == size && xmodTime == modTime {
+			return hash, nil
+		}
+	}
+
+	hash, err := hashContent(file, algo, canceled, report)
+	if err != nil {
+		return "", err
+	}
+	if storeXattrs {
+		if err := writeHashXattrs(file.Name(), algo, hash, size, modTime); err != nil {
+			log.Debug("storing hash in xattrs failed", "file", file.Name(), "error", err)
+		}
+	}
+	return hash, nil
+}
+
+// xattrStorage is a local root whose hashes are kept in xattrs.
+type xattrStorage struct {
+	localStorage
+}
+
+func (root xattrStorage) create(path, name string, content io.Reader, size int, modTime time.Time, algo, hash string) error {
+	return root.createFile(path, name, content, modTime, algo, hash, true)
+}
+
+func (root xattrStorage) hash(path, name, algo string, canceled chan struct{}, report func(progress int)) (string, error) {
+	return root.hashFile(path, name, algo, canceled, report, true, true)
+}
+
+func localDir(store storage) (localStorage, bool) {
+	switch store := store.(type) {
+	case localStorage:
+		return store, true
+	case xattrStorage:
+		return store.localStorage, true
+	}
+	return "", false
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package fs
+
+import "errors"
+
+func (root localStorage) free() (int, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package fs
+
+import "syscall"
+
+func (root localStorage) free() (int, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(string(root), &stat); err != nil {
+		return 0, err
+	}
+	return int(stat.Bavail) * int(stat.Bsize), nil
+}
@@ -0,0 +1,169 @@
+package fs
+
+import (
+	"arc/log"
+	"arc/parser"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+type locker interface {
+	createLock(entry string) (bool, error)
+	readLock() (string, error)
+	removeLock() error
+}
+
+func (fs *fsys) lockRoot(root, session string) (*parser.Message, error) {
+	store := fs.openStorage(root)
+	l, ok := store.(locker)
+	if !ok || store.readOnly() {
+		return nil, nil
+	}
+
+	host, _ := os.Hostname()
+	entry := parser.String("lock",
+		"host", host,
+		"pid", os.Getpid(),
+		"session", session,
+		"time", time.Now().UTC())
+	for attempt := 0; attempt < 2; attempt++ {
+		created, err := l.createLock(entry)
+		if err != nil {
+			return nil, err
+		}
+		holder, err := readLock(l)
+		if err != nil {
+			return nil, err
+		}
+		if created || holder != nil && holder.StringValue("session") == session {
+			fs.lock.Lock()
+			fs.locks[root] = session
+			fs.lock.Unlock()
+			return nil, nil
+		}
+		if holder == nil {
+			continue
+		}
+		pid, err := holder.IntValue("pid")
+		if holder.StringValue("host") != host || err != nil || processAlive(pid) {
+			return holder, nil
+		}
+		log.Debug("removing stale lock", "root", root, "holder", holder)
+		if err := l.removeLock(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("lock changed while acquiring it")
+}
+
+func (fs *fsys) lockOrReadOnly(cmd *parser.Message) {
+	root := cmd.StringValue("root")
+	session := cmd.StringValue("session")
+	fs.lock.Lock()
+	fs.sessions[root] = session
+	fs.lock.Unlock()
+
+	holder, err := fs.lockRoot(root, session)
+	if err == nil && holder == nil {
+		fs.lock.Lock()
+		reported := fs.unlocked[root]
+		delete(fs.unlocked, root)
+		fs.lock.Unlock()
+		if reported {
+			fs.send("archive-unlocked", "root", root)
+		}
+		return
+	}
+	if err != nil {
+		// Without the lock another session could write the root at the
+		// same time, so it stays read-only until locking succeeds.
+		log.Debug("locking failed", "root", root, "error", err)
+		report := !errors.Is(err, os.ErrNotExist) && fs.online(root)
+		fs.lock.Lock()
+		fs.unlocked[root] = fs.unlocked[root] || report
+		fs.lock.Unlock()
+		if report {
+			fs.send("lock-failed", "root", root, "error", err.Error())
+		}
+		return
+	}
+	fs.lock.Lock()
+	fs.readOnly[root] = true
+	fs.lock.Unlock()
+	fs.send("archive-locked",
+		"root", root,
+		"host", holder.StringValue("host"),
+		"pid", holder.StringValue("pid"),
+		"session", holder.StringValue("session"),
+		"time", holder.StringValue("time"))
+}
+
+func (fs *fsys) breakLock(cmd *parser.Message) {
+	root := cmd.StringValue("root")
+	l, ok := fs.openStorage(root).(locker)
+	if !ok {
+		fs.send("archive-locked", "root", root, "error", "root cannot be locked")
+		return
+	}
+	if holder, err := readLock(l); err == nil && holder != nil {
+		log.Debug("breaking lock", "root", root, "holder", holder)
+	}
+	if err := l.removeLock(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fs.send("archive-locked", "root", root, "error", err.Error())
+		return
+	}
+	fs.lock.Lock()
+	delete(fs.readOnly, root)
+	delete(fs.unlocked, root)
+	fs.lock.Unlock()
+	fs.lockOrReadOnly(cmd)
+
+	fs.lock.Lock()
+	readOnly := fs.readOnly[root] || fs.unlocked[root]
+	fs.lock.Unlock()
+	if !readOnly {
+		fs.send("archive-unlocked", "root", root)
+	}
+}
+
+func (fs *fsys) relock(root string) {
+	fs.lock.Lock()
+	session, ok := fs.sessions[root]
+	_, locked := fs.locks[root]
+	readOnly := fs.readOnly[root]
+	fs.lock.Unlock()
+	if ok && !locked && !readOnly {
+		fs.lockOrReadOnly(&parser.Message{Type: "scan", Params: map[string]string{"root": root, "session": session}})
+	}
+}
+
+func readLock(l locker) (*parser.Message, error) {
+	entry, err := l.readLock()
+	if entry == "" || err != nil {
+		return nil, err
+	}
+	return parser.Parse(strings.TrimSpace(entry)), nil
+}
+
+func (fs *fsys) unlockAll() {
+	fs.lock.Lock()
+	locks := fs.locks
+	fs.locks = map[string]string{}
+	fs.lock.Unlock()
+
+	for root, session := range locks {
+		l, ok := fs.storage(root).(locker)
+		if !ok {
+			continue
+		}
+		holder, err := readLock(l)
+		if err != nil || holder == nil || holder.StringValue("session") != session {
+			continue
+		}
+		if err := l.removeLock(); err != nil {
+			log.Debug("removing lock failed", "root", root, "error", err)
+		}
+	}
+}
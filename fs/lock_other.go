@@ -0,0 +1,7 @@
+//go:build !unix
+
+package fs
+
+func processAlive(pid int) bool {
+	return true
+}
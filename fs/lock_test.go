@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"arc/transport"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockFailureOpensReadOnly(t *testing.T) {
+	t.Setenv("ARC_HOME", t.TempDir())
+	from, to := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(from, "a"), []byte("one"), 0644)
+	os.WriteFile(filepath.Join(to, metaDir), nil, 0644)
+	engine, fsSide := transport.Pipe()
+	go Run(fsSide)
+	t.Cleanup(func() { engine.Close() })
+
+	engine.Send("scan", "root", from, "session", "test")
+	awaitMsg(t, engine, "archive-scanned")
+	engine.Send("scan", "root", to, "session", "test")
+	if msg := awaitMsg(t, engine, "lock-failed"); msg["root"] != to {
+		t.Errorf("lock-failed for %v", msg)
+	}
+	if msg := awaitMsg(t, engine, "archive-scanned"); msg["read-only"] != "true" {
+		t.Errorf("unlocked root scanned as %v", msg)
+	}
+
+	copyA := func() {
+		engine.Send("copy", "from-root", from, "from-path", "", "from-name", "a",
+			"root", to, "path", "", "name", "a", "hash", sum("one"), "batch", "b1", "id", "1")
+	}
+	copyA()
+	for {
+		msg, err := engine.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "file-copied" {
+			t.Fatal("copied into a root without its lock")
+		}
+		if msg.Type == "operation-failed" {
+			break
+		}
+	}
+
+	os.Remove(filepath.Join(to, metaDir))
+	engine.Send("unlock", "root", to, "session", "test")
+	awaitMsg(t, engine, "archive-unlocked")
+	copyA()
+	awaitMsg(t, engine, "file-copied")
+}
@@ -0,0 +1,65 @@
+package fs
+
+import (
+	"os"
+	"time"
+)
+
+const probeInterval = 2 * time.Second
+
+func (fs *fsys) online(root string) bool {
+	fs.lock.Lock()
+	id := fs.ids[root]
+	fs.lock.Unlock()
+
+	store := fs.openStorage(root)
+	if id != "" {
+		current, err := readID(store)
+		return err == nil && current == id
+	}
+	if local, ok := localDir(store); ok {
+		_, err := os.Stat(string(local))
+		return err == nil
+	}
+	if packed, ok := store.(*packedStorage); ok {
+		_, err := os.Stat(packed.root)
+		return err == nil
+	}
+	return true
+}
+
+func (fs *fsys) checkOnline(roots ...string) bool {
+	online := true
+	for _, root := range roots {
+		if root != "" && !fs.online(root) {
+			fs.goOffline(root)
+			online = false
+		}
+	}
+	return online
+}
+
+func (fs *fsys) goOffline(root string) {
+	fs.lock.Lock()
+	offline := fs.offline[root]
+	fs.offline[root] = true
+	fs.lock.Unlock()
+	if offline {
+		return
+	}
+
+	fs.send("archive-offline", "root", root)
+	go func() {
+		for !fs.quit.Load() {
+			time.Sleep(probeInterval)
+			if fs.online(root) {
+				fs.lock.Lock()
+				delete(fs.offline, root)
+				fs.lock.Unlock()
+				fs.relock(root)
+				fs.send("archive-online", "root", root)
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,43 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRootGoesOfflineAndComesBack(t *testing.T) {
+	dir := t.TempDir()
+	root, away := filepath.Join(dir, "root"), filepath.Join(dir, "away")
+	os.Mkdir(root, 0755)
+	os.WriteFile(filepath.Join(root, "a"), []byte("one"), 0644)
+	engine := startFs(t, root)
+
+	os.Rename(root, away)
+	engine.Send("hash", "root", root, "path", "", "name", "a", "id", "1")
+	offline, failed := false, false
+	for !offline || !failed {
+		msg, err := engine.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch msg.Type {
+		case "archive-offline":
+			offline = true
+		case "operation-failed":
+			if msg.StringValue("offline") != "true" {
+				t.Errorf("failure of an offline root: %v", msg)
+			}
+			failed = true
+		case "file-hashed":
+			t.Fatal("hashed a file on a missing root")
+		}
+	}
+
+	os.Rename(away, root)
+	awaitMsg(t, engine, "archive-online")
+	engine.Send("hash", "root", root, "path", "", "name", "a", "id", "2")
+	if msg := awaitMsg(t, engine, "file-hashed"); msg["hash"] != sum("one") {
+		t.Errorf("hashed %v after coming back", msg)
+	}
+}
@@ -0,0 +1,247 @@
+package fs
+
+import (
+	"arc/log"
+	"arc/parser"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func (fs *fsys) copyFile(cmd *parser.Message, canceled chan struct{}) error {
+	fromRoot := cmd.StringValue("from-root")
+	fromPath := cmd.StringValue("from-path")
+	fromName := cmd.StringValue("from-name")
+	root := cmd.StringValue("root")
+	path := cmd.StringValue("path")
+	name := cmd.StringValue("name")
+	batch := cmd.StringValue("batch")
+	expected := cmd.StringValue("hash")
+	store := fs.storage(root)
+
+	source, size, modTime, err := fs.openSource(cmd)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	trash, err := fs.trashExisting(store, root, path, name, batch)
+	if err != nil {
+		return err
+	}
+	if err := fs.journal(store, "copy",
+		"batch", batch,
+		"path", path,
+		"name", name,
+		"hash", expected,
+		"from-root", fromRoot,
+		"from-path", fromPath,
+		"from-name", fromName); err != nil {
+		return err
+	}
+
+	hash := newFileHash(fs.algo(root))
+	reader := &progressReader{
+		reader:   io.TeeReader(source, hash),
+		canceled: canceled,
+		report: func(progress int) {
+			fs.send("copying-progress",
+				"root", root,
+				"path", path,
+				"name", name,
+				"size", size,
+				"progress", progress)
+		},
+	}
+	if err := store.create(path, name, reader, size, modTime, fs.algo(root), expected); err != nil {
+		fs.revertCopy(store, root, path, name, trash, batch, false)
+		return err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if expected != "" && sum != expected {
+		fs.revertCopy(store, root, path, name, trash, batch, true)
+		return fmt.Errorf("%s changed while it was copied", filepath.Join(fromRoot, fromPath, fromName))
+	}
+
+	fs.send("file-copied",
+		"root", root,
+		"path", path,
+		"name", name,
+		"size", size,
+		"mod-time", modTime,
+		"hash", sum,
+		"batch", batch,
+		"step", cmd.StringValue("step"),
+		"id", cmd.StringValue("id"))
+	return nil
+}
+
+func (fs *fsys) openSource(cmd *parser.Message) (io.ReadCloser, int, time.Time, error) {
+	if cmd.StringValue("stream") == "true" {
+		id := cmd.StringValue("id")
+		s, ok := fs.stream(id)
+		if !ok {
+			return nil, 0, time.Time{}, fmt.Errorf("no stream for copy %s", id)
+		}
+		return &streamReader{fs: fs, id: id, reader: s.reader}, cmd.Int("size"), cmd.Time("mod-time"), nil
+	}
+
+	store := fs.storage(cmd.StringValue("from-root"))
+	path, name := cmd.StringValue("from-path"), cmd.StringValue("from-name")
+	size, modTime, err := store.stat(path, name)
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+	source, err := store.open(path, name)
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+	return source, size, modTime, nil
+}
+
+type streamReader struct {
+	fs     *fsys
+	id     string
+	reader *io.PipeReader
+}
+
+func (r *streamReader) Read(buf []byte) (int, error) {
+	return r.reader.Read(buf)
+}
+
+func (r *streamReader) Close() error {
+	r.fs.closeStream(r.id)
+	return nil
+}
+
+func (fs *fsys) moveFile(cmd *parser.Message) error {
+	root := cmd.StringValue("root")
+	path := cmd.StringValue("path")
+	name := cmd.StringValue("name")
+	toPath := cmd.StringValue("to-path")
+	toName := cmd.StringValue("to-name")
+	batch := cmd.StringValue("batch")
+	store := fs.storage(root)
+
+	if err := fs.confirmSame(cmd, nil); err != nil {
+		return err
+	}
+	if _, err := fs.trashExisting(store, root, toPath, toName, batch); err != nil {
+		return err
+	}
+
+	if err := fs.journal(store, "move",
+		"batch", batch,
+		"path", path,
+		"name", name,
+		"to-path", toPath,
+		"to-name", toName); err != nil {
+		return err
+	}
+
+	if err := store.rename(path, name, toPath, toName); err != nil {
+		return err
+	}
+
+	fs.send("file-moved",
+		"root", root,
+		"path", path,
+		"name", name,
+		"to-path", toPath,
+		"to-name", toName,
+		"batch", batch,
+		"step", cmd.StringValue("step"),
+		"id", cmd.StringValue("id"))
+	return nil
+}
+
+func (fs *fsys) deleteFile(cmd *parser.Message) error {
+	root := cmd.StringValue("root")
+	if err := fs.confirmSame(cmd, nil); err != nil {
+		return err
+	}
+	_, err := fs.trash(fs.storage(root), root, cmd.StringValue("path"), cmd.StringValue("name"),
+		cmd.StringValue("hash"), cmd.StringValue("batch"), cmd.StringValue("step"), cmd.StringValue("id"))
+	return err
+}
+
+// revertCopy puts back the file a failed copy replaced and records in the
+// journal that the copy and its trashing of that file need no undo.
+func (fs *fsys) revertCopy(store storage, root, path, name, trash, batch string, created bool) {
+	if created {
+		if err := store.remove(path, name); err != nil {
+			log.Debug("removing failed copy failed", "root", root, "path", path, "name", name, "error", err)
+			return
+		}
+	}
+	if trash != "" {
+		if err := store.rename(dir(trash), filepath.Base(trash), path, name); err != nil {
+			log.Debug("restoring overwritten file failed", "root", root, "trash", trash, "error", err)
+			return
+		}
+	}
+	if err := fs.journal(store, "reverted", "batch", batch, "path", path, "name", name); err != nil {
+		log.Debug("journaling reverted copy failed", "root", root, "path", path, "name", name, "error", err)
+	}
+}
+
+func (fs *fsys) trashExisting(store storage, root, path, name, batch string) (string, error) {
+	_, _, err := store.stat(path, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	hash, err := fs.hashFile(root, path, name, nil)
+	if err != nil {
+		return "", err
+	}
+	return fs.trash(store, root, path, name, hash, batch, "", "")
+}
+
+func (fs *fsys) trash(store storage, root, path, name, hash, batch, step, id string) (string, error) {
+	size, modTime, err := store.stat(path, name)
+	if err != nil {
+		return "", err
+	}
+
+	trashPath := filepath.Join(atticDir, batch, path)
+	trashName := name
+	for i := 1; exists(store, trashPath, trashName); i++ {
+		trashName = fmt.Sprintf("%s.%d", name, i)
+	}
+
+	if err := fs.journal(store, "delete",
+		"batch", batch,
+		"path", path,
+		"name", name,
+		"trash", filepath.Join(trashPath, trashName),
+		"size", size,
+		"mod-time", modTime,
+		"hash", hash); err != nil {
+		return "", err
+	}
+
+	if err := store.rename(path, name, trashPath, trashName); err != nil {
+		return "", err
+	}
+
+	fs.send("file-deleted",
+		"root", root,
+		"path", path,
+		"name", name,
+		"batch", batch,
+		"step", step,
+		"id", id)
+	return filepath.Join(trashPath, trashName), nil
+}
+
+func exists(store storage, path, name string) bool {
+	_, _, err := store.stat(path, name)
+	return err == nil
+}
@@ -0,0 +1,405 @@
+package fs
+
+import (
+	"arc/catalog"
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type packedKind int
+
+const (
+	packedTar packedKind = iota
+	packedTarGz
+	packedZip
+)
+
+type packed struct {
+	kind     packedKind
+	members  map[string]*member
+	manifest map[string]string
+	algo     string
+}
+
+type member struct {
+	offset  int64
+	size    int
+	modTime time.Time
+	hash    string
+}
+
+func packedKindOf(root string) (packedKind, bool) {
+	lower := strings.ToLower(root)
+	switch {
+	case strings.HasSuffix(lower, ".tar"):
+		return packedTar, true
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return packedTarGz, true
+	case strings.HasSuffix(lower, ".zip"):
+		return packedZip, true
+	}
+	return 0, false
+}
+
+func isPacked(root string) bool {
+	if _, ok := packedKindOf(root); !ok {
+		return false
+	}
+	info, err := os.Stat(root)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func memberName(name string) string {
+	return strings.TrimPrefix(filepath.Clean("/"+filepath.FromSlash(name)), string(filepath.Separator))
+}
+
+type packedStorage struct {
+	fs   *fsys
+	root string
+}
+
+func (p *packedStorage) walk(visit func(path, name string, size int, modTime time.Time) error) error {
+	kind, _ := packedKindOf(p.root)
+	index := &packed{kind: kind, members: map[string]*member{}}
+	defer func() {
+		p.fs.lock.Lock()
+		p.fs.packed[p.root] = index
+		p.fs.lock.Unlock()
+	}()
+
+	add := func(name string, offset int64, size int64, modTime time.Time) error {
+		rel := memberName(name)
+		if isReserved(rel) {
+			return nil
+		}
+		file := &member{
+			offset:  offset,
+			size:    int(size),
+			modTime: modTime.UTC().Round(time.Second),
+		}
+		index.members[rel] = file
+		return visit(dir(rel), filepath.Base(rel), file.size, file.modTime)
+	}
+
+	if kind == packedZip {
+		return scanZip(p.root, index, add)
+	}
+	return scanTar(p.root, index, add)
+}
+
+func (p *packedStorage) open(path, name string) (io.ReadCloser, error) {
+	content, _, err := p.fs.openMember(p.root, path, name)
+	return content, err
+}
+
+func (p *packedStorage) stat(path, name string) (int, time.Time, error) {
+	_, file, err := p.fs.packedMember(p.root, path, name)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return file.size, file.modTime, nil
+}
+
+func (p *packedStorage) create(path, name string, content io.Reader, size int, modTime time.Time, algo, hash string) error {
+	return errReadOnly
+}
+
+func (p *packedStorage) rename(path, name, toPath, toName string) error {
+	return errReadOnly
+}
+
+func (p *packedStorage) remove(path, name string) error {
+	return errReadOnly
+}
+
+func (p *packedStorage) appendMeta(name, entry string) error {
+	return errReadOnly
+}
+
+func (p *packedStorage) readMeta(name string) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func (p *packedStorage) readOnly() bool {
+	return true
+}
+
+func (p *packedStorage) hash(path, name, algo string, canceled chan struct{}, report func(progress int)) (string, error) {
+	return p.fs.hashPacked(p.root, path, name, algo, canceled, report)
+}
+
+func scanZip(root string, index *packed, add func(name string, offset, size int64, modTime time.Time) error) error {
+	reader, err := zip.OpenReader(root)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.Name == manifestName {
+			content, err := file.Open()
+			if err != nil {
+				return err
+			}
+			err = index.readManifest(content)
+			content.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		if err := add(file.Name, 0, int64(file.UncompressedSize64), file.Modified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanTar(root string, index *packed, add func(name string, offset, size int64, modTime time.Time) error) error {
+	file, err := os.Open(root)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counter := &countingReader{reader: file}
+	reader, err := tarReader(counter, index.kind)
+	if err != nil {
+		return err
+	}
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Name == manifestName {
+			if err := index.readManifest(reader); err != nil {
+				return err
+			}
+		} else if header.Typeflag == tar.TypeReg {
+			if err := add(header.Name, counter.read, header.Size, header.ModTime); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (index *packed) readManifest(reader io.Reader) error {
+	manifest, err := catalog.Decode(reader)
+	if err != nil {
+		return err
+	}
+	index.manifest = map[string]string{}
+	index.algo = manifest.Algo
+	for _, entry := range manifest.Entries {
+		index.manifest[entry.Path] = entry.Hash
+	}
+	return nil
+}
+
+func tarReader(reader io.Reader, kind packedKind) (*tar.Reader, error) {
+	if kind == packedTarGz {
+		unzipped, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		reader = unzipped
+	}
+	return tar.NewReader(reader), nil
+}
+
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (r *countingReader) Read(buf []byte) (int, error) {
+	n, err := r.reader.Read(buf)
+	r.read += int64(n)
+	return n, err
+}
+
+func (fs *fsys) packedIndex(root string) (*packed, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	index, ok := fs.packed[root]
+	if !ok {
+		return nil, fmt.Errorf("archive file %s is not scanned", root)
+	}
+	return index, nil
+}
+
+func (fs *fsys) packedMember(root, path, name string) (*packed, *member, error) {
+	index, err := fs.packedIndex(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, ok := index.members[filepath.Join(path, name)]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not in %s", filepath.Join(path, name), root)
+	}
+	return index, file, nil
+}
+
+func (fs *fsys) openMember(root, path, name string) (io.ReadCloser, *member, error) {
+	index, file, err := fs.packedMember(root, path, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch index.kind {
+	case packedTar:
+		archive, err := os.Open(root)
+		if err != nil {
+			return nil, nil, err
+		}
+		return readCloser{io.NewSectionReader(archive, file.offset, int64(file.size)), archive}, file, nil
+
+	case packedZip:
+		archive, err := zip.OpenReader(root)
+		if err != nil {
+			return nil, nil, err
+		}
+		content, err := archive.Open(filepath.ToSlash(filepath.Join(path, name)))
+		if err != nil {
+			archive.Close()
+			return nil, nil, err
+		}
+		return readCloser{content, multiCloser{content, archive}}, file, nil
+
+	default:
+		archive, err := os.Open(root)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader, err := tarReader(archive, index.kind)
+		if err != nil {
+			archive.Close()
+			return nil, nil, err
+		}
+		for {
+			header, err := reader.Next()
+			if err != nil {
+				archive.Close()
+				if err == io.EOF {
+					err = fmt.Errorf("%s is not in %s", filepath.Join(path, name), root)
+				}
+				return nil, nil, err
+			}
+			if header.Typeflag == tar.TypeReg && memberName(header.Name) == filepath.Join(path, name) {
+				return readCloser{reader, archive}, file, nil
+			}
+		}
+	}
+}
+
+func (fs *fsys) hashPacked(root, path, name, algo string, canceled chan struct{}, report func(progress int)) (string, error) {
+	index, file, err := fs.packedMember(root, path, name)
+	if err != nil {
+		return "", err
+	}
+	if index.kind != packedTarGz {
+		hash, err := fs.hashMember(root, path, name, algo, canceled, report)
+		if err != nil {
+			return "", err
+		}
+		return hash, index.verify(path, name, algo, hash)
+	}
+
+	fs.lock.Lock()
+	hash := file.hash
+	fs.lock.Unlock()
+	if hash != "" {
+		return hash, index.verify(path, name, algo, hash)
+	}
+
+	// Compressed tars cannot be read at random: hash every member in one pass.
+	archive, err := os.Open(root)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+	reader, err := tarReader(archive, index.kind)
+	if err != nil {
+		return "", err
+	}
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		other, ok := index.members[memberName(header.Name)]
+		if header.Typeflag != tar.TypeReg || !ok {
+			continue
+		}
+		// Progress is per file: only the requested member reports it.
+		progress := func(int) {}
+		if other == file {
+			progress = report
+		}
+		sum := newFileHash(algo)
+		if _, err := io.Copy(sum, &progressReader{reader: reader, canceled: canceled, report: progress}); err != nil {
+			return "", err
+		}
+		fs.lock.Lock()
+		other.hash = hex.EncodeToString(sum.Sum(nil))
+		fs.lock.Unlock()
+	}
+
+	fs.lock.Lock()
+	hash = file.hash
+	fs.lock.Unlock()
+	return hash, index.verify(path, name, algo, hash)
+}
+
+func (index *packed) verify(path, name, algo, hash string) error {
+	expected, ok := index.manifest[filepath.Join(path, name)]
+	if ok && index.algo == algo && expected != hash {
+		return fmt.Errorf("%s does not match the manifest", filepath.Join(path, name))
+	}
+	return nil
+}
+
+func (fs *fsys) hashMember(root, path, name, algo string, canceled chan struct{}, report func(progress int)) (string, error) {
+	content, _, err := fs.openMember(root, path, name)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	return hashContent(content, algo, canceled, report)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type multiCloser []io.Closer
+
+func (closers multiCloser) Close() error {
+	var result error
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
@@ -0,0 +1,191 @@
+package fs
+
+import (
+	"arc/catalog"
+	"arc/transport"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var packedFiles = map[string]string{
+	"a":         "first member",
+	"sub/b":     strings.Repeat("b", 3000),
+	"sub/c.txt": "third",
+}
+
+var packedTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func packedManifest(t *testing.T, hashes map[string]string) []byte {
+	t.Helper()
+	manifest := &catalog.Catalog{Root: "test", Algo: "sha256", Time: packedTime}
+	for name, hash := range hashes {
+		manifest.Entries = append(manifest.Entries, catalog.Entry{
+			Path: name, Size: len(packedFiles[name]), ModTime: packedTime, Hash: hash,
+		})
+	}
+	buf := &bytes.Buffer{}
+	if err := catalog.Encode(buf, manifest); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeTar(t *testing.T, name string, manifest []byte) {
+	t.Helper()
+	out, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	var dest io.Writer = out
+	var unzipped *gzip.Writer
+	if !strings.HasSuffix(name, ".tar") {
+		unzipped = gzip.NewWriter(out)
+		dest = unzipped
+	}
+	writer := tar.NewWriter(dest)
+	add := func(name string, content []byte) {
+		writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: int64(len(content)), Mode: 0644, ModTime: packedTime})
+		writer.Write(content)
+	}
+	if manifest != nil {
+		add(manifestName, manifest)
+	}
+	writer.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "sub/", Mode: 0755, ModTime: packedTime})
+	for _, name := range []string{"a", "sub/b", "sub/c.txt"} {
+		add(name, []byte(packedFiles[name]))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if unzipped != nil {
+		unzipped.Close()
+	}
+}
+
+func writeZip(t *testing.T, name string, manifest []byte) {
+	t.Helper()
+	out, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	writer := zip.NewWriter(out)
+	add := func(name string, content []byte) {
+		member, _ := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: packedTime})
+		member.Write(content)
+	}
+	if manifest != nil {
+		add(manifestName, manifest)
+	}
+	for _, name := range []string{"a", "sub/b", "sub/c.txt"} {
+		add(name, []byte(packedFiles[name]))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func packedFixtures(t *testing.T, manifest []byte) []string {
+	dir := t.TempDir()
+	names := []string{filepath.Join(dir, "test.tar"), filepath.Join(dir, "test.tar.gz"), filepath.Join(dir, "test.zip")}
+	writeTar(t, names[0], manifest)
+	writeTar(t, names[1], manifest)
+	writeZip(t, names[2], manifest)
+	return names
+}
+
+func scanPacked(t *testing.T, engine transport.Conn, root string) map[string]string {
+	t.Helper()
+	engine.Send("scan", "root", root, "session", "test")
+	scanned := map[string]string{}
+	for {
+		msg, err := engine.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch msg.Type {
+		case "file-scanned":
+			scanned[filepath.Join(msg.StringValue("path"), msg.StringValue("name"))] = msg.StringValue("size")
+		case "scan-failed":
+			t.Fatalf("scan of %s failed: %v", root, msg)
+		case "archive-scanned":
+			return scanned
+		}
+	}
+}
+
+func TestPackedScanHashAndCopy(t *testing.T) {
+	for _, root := range packedFixtures(t, nil) {
+		t.Run(filepath.Base(root), func(t *testing.T) {
+			to := t.TempDir()
+			engine := startFs(t, to)
+			scanned := scanPacked(t, engine, root)
+			if len(scanned) != len(packedFiles) {
+				t.Errorf("scanned %v", scanned)
+			}
+			for name, content := range packedFiles {
+				if size := scanned[name]; size != strconv.Itoa(len(content)) {
+					t.Errorf("%s scanned with size %s, want %d", name, size, len(content))
+				}
+				engine.Send("hash", "root", root, "path", dir(name), "name", filepath.Base(name), "id", name)
+				if hash := awaitMsg(t, engine, "file-hashed")["hash"]; hash != sum(content) {
+					t.Errorf("%s hashed as %s", name, hash)
+				}
+			}
+
+			// Copy in reverse member order, so that the tar offsets are not read in sequence.
+			for _, name := range []string{"sub/c.txt", "sub/b", "a"} {
+				engine.Send("copy", "from-root", root, "from-path", dir(name), "from-name", filepath.Base(name),
+					"root", to, "path", dir(name), "name", filepath.Base(name), "hash", sum(packedFiles[name]), "batch", "b1", "id", name)
+				awaitMsg(t, engine, "file-copied")
+				if content := readFile(t, filepath.Join(to, name)); content != packedFiles[name] {
+					t.Errorf("%s copied as %q", name, content)
+				}
+			}
+		})
+	}
+}
+
+func TestPackedManifestIsVerified(t *testing.T) {
+	hashes := map[string]string{}
+	for name, content := range packedFiles {
+		hashes[name] = sum(content)
+	}
+	hashes["sub/b"] = sum("something else")
+	for _, root := range packedFixtures(t, packedManifest(t, hashes)) {
+		t.Run(filepath.Base(root), func(t *testing.T) {
+			engine := startFs(t)
+			if scanned := scanPacked(t, engine, root); len(scanned) != len(packedFiles) {
+				t.Errorf("scanned %v, want the manifest skipped", scanned)
+			}
+
+			engine.Send("hash", "root", root, "path", "", "name", "a", "id", "a")
+			if hash := awaitMsg(t, engine, "file-hashed")["hash"]; hash != sum(packedFiles["a"]) {
+				t.Errorf("a hashed as %s", hash)
+			}
+			engine.Send("hash", "root", root, "path", "sub", "name", "b", "id", "b")
+			for {
+				msg, err := engine.Receive()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if msg.Type == "file-hashed" {
+					t.Fatal("member that does not match the manifest hashed")
+				}
+				if msg.Type == "operation-failed" {
+					break
+				}
+			}
+		})
+	}
+}
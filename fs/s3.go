@@ -0,0 +1,280 @@
+package fs
+
+import (
+	"arc/config"
+	"arc/log"
+	"arc/parser"
+	"arc/s3"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type s3Storage struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func newS3Storage(root string) *s3Storage {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(root, "s3://"), "/")
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+	accessKey, secretKey := config.S3Credentials()
+	return &s3Storage{
+		client: &s3.Client{
+			Endpoint:  config.S3Endpoint(),
+			Region:    config.S3Region(),
+			AccessKey: accessKey,
+			SecretKey: secretKey,
+		},
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+func (s *s3Storage) key(path, name string) string {
+	return s.prefix + filepath.ToSlash(filepath.Join(path, name))
+}
+
+type s3Mtime struct {
+	size  int
+	etag  string
+	mtime time.Time
+}
+
+func (s *s3Storage) walk(visit func(path, name string, size int, modTime time.Time) error) error {
+	known, err := s.readMtimes()
+	if err != nil {
+		return err
+	}
+	seen := map[string]s3Mtime{}
+	headed := 0
+	err = s.client.List(s.bucket, s.prefix, func(object s3.Object) error {
+		rel := strings.TrimPrefix(object.Key, s.prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") || isReserved(filepath.FromSlash(rel)) {
+			return nil
+		}
+		rel = filepath.FromSlash(rel)
+		path, name := dir(rel), filepath.Base(rel)
+		entry, ok := known[rel]
+		if !ok || entry.size != object.Size || entry.etag != object.ETag || object.ETag == "" {
+			size, modTime, err := s.stat(path, name)
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			entry = s3Mtime{size: size, etag: object.ETag, mtime: modTime}
+			headed++
+		}
+		seen[rel] = entry
+		return visit(path, name, entry.size, entry.mtime)
+	})
+	if err != nil {
+		return err
+	}
+	if headed > 0 || len(seen) != len(known) {
+		if err := s.writeMtimes(seen); err != nil {
+			log.Debug("writing s3 mtimes failed", "bucket", s.bucket, "prefix", s.prefix, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *s3Storage) readMtimes() (map[string]s3Mtime, error) {
+	mtimes := map[string]s3Mtime{}
+	content, err := s.readMeta("mtimes")
+	if content == nil || err != nil {
+		return mtimes, err
+	}
+	defer content.Close()
+
+	scanner := bufio.NewScanner(content)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		msg := parser.Parse(scanner.Text())
+		size, err1 := msg.IntValue("size")
+		mtime, err2 := msg.TimeValue("mtime")
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		mtimes[msg.StringValue("path")] = s3Mtime{size: size, etag: msg.StringValue("etag"), mtime: mtime}
+	}
+	return mtimes, scanner.Err()
+}
+
+func (s *s3Storage) writeMtimes(mtimes map[string]s3Mtime) error {
+	buf := &bytes.Buffer{}
+	for path, entry := range mtimes {
+		buf.WriteString(parser.String("object",
+			"path", path,
+			"size", entry.size,
+			"etag", entry.etag,
+			"mtime", entry.mtime))
+	}
+	return s.client.Put(s.bucket, s.key(metaDir, "mtimes"), buf, buf.Len(), nil)
+}
+
+func (s *s3Storage) open(path, name string) (io.ReadCloser, error) {
+	return s.client.Get(s.bucket, s.key(path, name))
+}
+
+func (s *s3Storage) stat(path, name string) (int, time.Time, error) {
+	object, err := s.client.Head(s.bucket, s.key(path, name))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	modTime := object.LastModified
+	if mtime, err := time.Parse(time.RFC3339, object.Metadata["mtime"]); err == nil {
+		modTime = mtime
+	}
+	return object.Size, modTime.UTC().Round(time.Second), nil
+}
+
+func (s *s3Storage) create(path, name string, content io.Reader, size int, modTime time.Time, algo, hash string) error {
+	metadata := map[string]string{"mtime": modTime.UTC().Format(time.RFC3339)}
+	if hash != "" {
+		metadata[algo] = hash
+	}
+	return s.client.Put(s.bucket, s.key(path, name), content, size, metadata)
+}
+
+func (s *s3Storage) rename(path, name, toPath, toName string) error {
+	from, to := s.key(path, name), s.key(toPath, toName)
+	source, err := s.client.Head(s.bucket, from)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Copy(s.bucket, from, to); err != nil {
+		return err
+	}
+	copied, err := s.client.Head(s.bucket, to)
+	if err != nil {
+		return err
+	}
+	if copied.Size != source.Size || !maps.Equal(copied.Metadata, source.Metadata) {
+		return fmt.Errorf("s3://%s/%s: copy does not match %s", s.bucket, to, from)
+	}
+	return s.client.Delete(s.bucket, from)
+}
+
+func (s *s3Storage) remove(path, name string) error {
+	return s.client.Delete(s.bucket, s.key(path, name))
+}
+
+var s3MetaSeq atomic.Int64
+
+// appendMeta stores every entry as its own object under <name>.d/, so
+// appending never rewrites what is already there. readMeta joins them
+// in key order after the single object older versions wrote.
+func (s *s3Storage) appendMeta(name, entry string) error {
+	segment := fmt.Sprintf("%020d-%08d", time.Now().UnixNano(), s3MetaSeq.Add(1))
+	return s.client.Put(s.bucket, s.key(metaDir, name+".d/"+segment), strings.NewReader(entry), len(entry), nil)
+}
+
+func (s *s3Storage) readMeta(name string) (io.ReadCloser, error) {
+	segments := []string{}
+	err := s.client.List(s.bucket, s.key(metaDir, name+".d")+"/", func(object s3.Object) error {
+		segments = append(segments, object.Key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.client.Get(s.bucket, s.key(metaDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		content = nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return content, nil
+	}
+	sort.Strings(segments)
+	buf := &bytes.Buffer{}
+	if content != nil {
+		_, err := io.Copy(buf, content)
+		content.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range segments {
+		content, err := s.client.Get(s.bucket, key)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(buf, content)
+		content.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(buf), nil
+}
+
+func (s *s3Storage) createLock(entry string) (bool, error) {
+	return s.createMeta("lock", entry)
+}
+
+func (s *s3Storage) createMeta(name, entry string) (bool, error) {
+	err := s.client.Create(s.bucket, s.key(metaDir, name), strings.NewReader(entry), len(entry))
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *s3Storage) readLock() (string, error) {
+	content, err := s.client.Get(s.bucket, s.key(metaDir, "lock"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	entry, err := io.ReadAll(content)
+	return string(entry), err
+}
+
+func (s *s3Storage) removeLock() error {
+	return s.client.Delete(s.bucket, s.key(metaDir, "lock"))
+}
+
+func (s *s3Storage) readOnly() bool {
+	return false
+}
+
+func (s *s3Storage) hash(path, name, algo string, canceled chan struct{}, report func(progress int)) (string, error) {
+	object, err := s.client.Head(s.bucket, s.key(path, name))
+	if err != nil {
+		return "", err
+	}
+	if hash := object.Metadata[algo]; hash != "" {
+		return hash, nil
+	}
+	content, err := s.open(path, name)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	return hashContent(content, algo, canceled, report)
+}
@@ -0,0 +1,351 @@
+package fs
+
+import (
+	"arc/s3test"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestS3Storage(t *testing.T) *s3Storage {
+	return newTestS3StorageWith(t, s3test.NewServer("us-east-1", "arc", "arc-secret"))
+}
+
+func newTestS3StorageWith(t *testing.T, handler http.Handler) *s3Storage {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	t.Setenv("ARC_S3_ENDPOINT", server.URL)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "arc")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "arc-secret")
+	return newS3Storage("s3://bucket/prefix")
+}
+
+func putFile(t *testing.T, s *s3Storage, path, name, content string, modTime time.Time, hash string) {
+	t.Helper()
+	if err := s.create(path, name, strings.NewReader(content), len(content), modTime, "sha256", hash); err != nil {
+		t.Fatalf("create %s/%s: %v", path, name, err)
+	}
+}
+
+func TestS3WalkReportsStoredModTime(t *testing.T) {
+	s := newTestS3Storage(t)
+	modTime := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	putFile(t, s, "photos", "a.jpg", "aaaa", modTime, "")
+	putFile(t, s, "", "b.txt", "bb", modTime.Add(time.Hour), "")
+
+	type scanned struct {
+		size    int
+		modTime time.Time
+	}
+	files := map[string]scanned{}
+	err := s.walk(func(path, name string, size int, modTime time.Time) error {
+		files[path+"|"+name] = scanned{size, modTime}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]scanned{
+		"photos|a.jpg": {4, modTime},
+		"|b.txt":       {2, modTime.Add(time.Hour)},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("walk reported %v, want %v", files, want)
+	}
+	for key, file := range want {
+		if got := files[key]; got.size != file.size || !got.modTime.Equal(file.modTime) {
+			t.Errorf("%s: got %v, want %v", key, got, file)
+		}
+	}
+
+	size, statTime, err := s.stat("photos", "a.jpg")
+	if err != nil || size != 4 || !statTime.Equal(modTime) {
+		t.Errorf("stat = %d, %v, %v; want 4, %v", size, statTime, err, modTime)
+	}
+}
+
+func TestS3WalkHeadsOnlyChangedObjects(t *testing.T) {
+	fake := s3test.NewServer("us-east-1", "arc", "arc-secret")
+	heads := atomic.Int32{}
+	s := newTestS3StorageWith(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "HEAD" {
+			heads.Add(1)
+		}
+		fake.ServeHTTP(w, req)
+	}))
+	modTime := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	putFile(t, s, "", "a", "aaaa", modTime, "")
+	putFile(t, s, "", "b", "bb", modTime, "")
+
+	walk := func() map[string]time.Time {
+		t.Helper()
+		heads.Store(0)
+		files := map[string]time.Time{}
+		err := s.walk(func(path, name string, size int, modTime time.Time) error {
+			files[name] = modTime
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files
+	}
+
+	if files := walk(); heads.Load() != 2 || !files["a"].Equal(modTime) || !files["b"].Equal(modTime) {
+		t.Errorf("first walk: %v with %d HEADs", files, heads.Load())
+	}
+	if files := walk(); heads.Load() != 0 || !files["a"].Equal(modTime) || !files["b"].Equal(modTime) {
+		t.Errorf("second walk: %v with %d HEADs, want none", files, heads.Load())
+	}
+	putFile(t, s, "", "b", "changed", modTime.Add(time.Hour), "")
+	if files := walk(); heads.Load() != 1 || !files["b"].Equal(modTime.Add(time.Hour)) {
+		t.Errorf("walk after a change: %v with %d HEADs, want 1", files, heads.Load())
+	}
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	s := newTestS3Storage(t)
+	s.client.PartSize = 4
+	modTime := time.Date(2022, 2, 2, 2, 2, 2, 0, time.UTC)
+	putFile(t, s, "big", "file", "0123456789", modTime, "hash")
+
+	content, err := s.open("big", "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(content)
+	content.Close()
+	if string(data) != "0123456789" {
+		t.Errorf("multipart content = %q", data)
+	}
+	size, statTime, err := s.stat("big", "file")
+	if err != nil || size != 10 || !statTime.Equal(modTime) {
+		t.Errorf("stat = %d, %v, %v; want 10, %v", size, statTime, err, modTime)
+	}
+	if hash, err := s.hash("big", "file", "sha256", make(chan struct{}), func(int) {}); hash != "hash" || err != nil {
+		t.Errorf("hash = %q, %v", hash, err)
+	}
+}
+
+func TestS3HashUsesMetadataOrContent(t *testing.T) {
+	s := newTestS3Storage(t)
+	putFile(t, s, "", "stored", "content", time.Now(), "stored-hash")
+	putFile(t, s, "", "plain", "content", time.Now(), "")
+
+	hash, err := s.hash("", "stored", "sha256", make(chan struct{}), func(int) {})
+	if err != nil || hash != "stored-hash" {
+		t.Errorf("hash with metadata = %q, %v", hash, err)
+	}
+	sum := sha256.Sum256([]byte("content"))
+	hash, err = s.hash("", "plain", "sha256", make(chan struct{}), func(int) {})
+	if err != nil || hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("hash without metadata = %q, %v", hash, err)
+	}
+	long := sha512.Sum512([]byte("content"))
+	hash, err = s.hash("", "stored", "sha512", make(chan struct{}), func(int) {})
+	if err != nil || hash != hex.EncodeToString(long[:]) {
+		t.Errorf("sha512 with sha256 metadata = %q, %v", hash, err)
+	}
+}
+
+func TestS3RenameAndRemove(t *testing.T) {
+	s := newTestS3Storage(t)
+	modTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	putFile(t, s, "a", "file", "data", modTime, "h")
+
+	if err := s.rename("a", "file", "b", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.stat("a", "file"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("source still exists after rename: %v", err)
+	}
+	content, err := s.open("b", "moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(content)
+	content.Close()
+	if string(data) != "data" {
+		t.Errorf("renamed content = %q", data)
+	}
+	if _, statTime, _ := s.stat("b", "moved"); !statTime.Equal(modTime) {
+		t.Errorf("renamed mod time = %v, want %v", statTime, modTime)
+	}
+
+	if err := s.remove("b", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.stat("b", "moved"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file still exists after remove: %v", err)
+	}
+}
+
+func TestS3RenameCopiesLargeObjectsInParts(t *testing.T) {
+	server := s3test.NewServer("us-east-1", "arc", "arc-secret")
+	server.CopySize = 8
+	s := newTestS3StorageWith(t, server)
+	s.client.PartSize = 4
+	s.client.CopySize = 8
+	modTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	putFile(t, s, "", "big", "0123456789", modTime, "h")
+
+	if err := s.rename("", "big", "b", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	content, err := s.open("b", "moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(content)
+	content.Close()
+	if string(data) != "0123456789" {
+		t.Errorf("copied content = %q", data)
+	}
+	if _, statTime, _ := s.stat("b", "moved"); !statTime.Equal(modTime) {
+		t.Errorf("copied mod time = %v, want %v", statTime, modTime)
+	}
+}
+
+func TestS3RenameKeepsSourceWhenCopyFails(t *testing.T) {
+	server := s3test.NewServer("us-east-1", "arc", "arc-secret")
+	s := newTestS3StorageWith(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Amz-Copy-Source") != "" {
+			fmt.Fprint(w, "<Error><Code>InternalError</Code><Message>copy failed</Message></Error>")
+			return
+		}
+		server.ServeHTTP(w, req)
+	}))
+	putFile(t, s, "", "file", "data", time.Now(), "h")
+
+	if err := s.rename("", "file", "", "moved"); err == nil || !strings.Contains(err.Error(), "InternalError") {
+		t.Errorf("rename with a failed copy = %v", err)
+	}
+	if _, _, err := s.stat("", "file"); err != nil {
+		t.Errorf("source lost after a failed copy: %v", err)
+	}
+}
+
+func TestS3WalkSkipsMeta(t *testing.T) {
+	s := newTestS3Storage(t)
+	putFile(t, s, "", "file", "x", time.Now(), "")
+	if err := s.appendMeta("journal", "entry\n"); err != nil {
+		t.Fatal(err)
+	}
+	err := s.walk(func(path, name string, size int, modTime time.Time) error {
+		if name != "file" {
+			t.Errorf("walk reported %s/%s", path, name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestS3AppendMetaConcurrently(t *testing.T) {
+	s := newTestS3Storage(t)
+	if content, err := s.readMeta("journal"); content != nil || err != nil {
+		t.Fatalf("readMeta of a missing journal = %v, %v", content, err)
+	}
+
+	const entries = 20
+	wg := sync.WaitGroup{}
+	for i := 0; i < entries; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.appendMeta("journal", fmt.Sprintf("entry %d\n", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	content, err := s.readMeta("journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	data, _ := io.ReadAll(content)
+	for i := 0; i < entries; i++ {
+		if !bytes.Contains(data, []byte(fmt.Sprintf("entry %d\n", i))) {
+			t.Errorf("journal lost entry %d:\n%s", i, data)
+		}
+	}
+}
+
+func TestS3AppendMetaWritesOnlyTheEntry(t *testing.T) {
+	server := s3test.NewServer("us-east-1", "arc", "arc-secret")
+	written := atomic.Int64{}
+	s := newTestS3StorageWith(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "PUT" {
+			written.Add(req.ContentLength)
+		}
+		server.ServeHTTP(w, req)
+	}))
+	legacy := "old entry\n"
+	if err := s.client.Put(s.bucket, s.key(metaDir, "journal"), strings.NewReader(legacy), len(legacy), nil); err != nil {
+		t.Fatal(err)
+	}
+	written.Store(0)
+
+	for i := 0; i < 10; i++ {
+		if err := s.appendMeta("journal", fmt.Sprintf("entry %d\n", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if written.Load() != 80 {
+		t.Errorf("appending 80 bytes uploaded %d", written.Load())
+	}
+
+	content, err := s.readMeta("journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	data, _ := io.ReadAll(content)
+	want := legacy
+	for i := 0; i < 10; i++ {
+		want += fmt.Sprintf("entry %d\n", i)
+	}
+	if string(data) != want {
+		t.Errorf("journal = %q, want %q", data, want)
+	}
+}
+
+func TestS3Lock(t *testing.T) {
+	s := newTestS3Storage(t)
+	if entry, err := s.readLock(); entry != "" || err != nil {
+		t.Fatalf("readLock without a lock = %q, %v", entry, err)
+	}
+	created, err := s.createLock("first\n")
+	if !created || err != nil {
+		t.Fatalf("first createLock = %v, %v", created, err)
+	}
+	created, err = s.createLock("second\n")
+	if created || err != nil {
+		t.Fatalf("second createLock = %v, %v", created, err)
+	}
+	if entry, err := s.readLock(); entry != "first\n" || err != nil {
+		t.Errorf("readLock = %q, %v", entry, err)
+	}
+	if err := s.removeLock(); err != nil {
+		t.Fatal(err)
+	}
+	if created, err := s.createLock("third\n"); !created || err != nil {
+		t.Errorf("createLock after removeLock = %v, %v", created, err)
+	}
+}
@@ -0,0 +1,190 @@
+package fs
+
+import (
+	"arc/log"
+	"arc/parser"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	metaDir  = ".arc"
+	atticDir = ".arc-attic"
+)
+
+func isReserved(rel string) bool {
+	for _, reserved := range []string{metaDir, atticDir} {
+		if rel == reserved || strings.HasPrefix(rel, reserved+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fs *fsys) scanArchive(root string) {
+	defer fs.wg.Done()
+
+	store := fs.storage(root)
+	sums := fs.startChecksums(root)
+	defer close(sums.ready)
+	manifests := [][2]string{}
+	err := store.walk(func(path, name string, size int, modTime time.Time) error {
+		if fs.quit.Load() {
+			return errCanceled
+		}
+		if checksumKind(name) != "" {
+			manifests = append(manifests, [2]string{path, name})
+		}
+		fs.send("file-scanned",
+			"root", root,
+			"path", path,
+			"name", name,
+			"size", size,
+			"mod-time", modTime)
+		return nil
+	})
+	if err != nil {
+		log.Debug("scan failed", "root", root, "error", err)
+		if fs.checkOnline(root) && err != errCanceled {
+			fs.send("scan-failed", "root", root, "error", err.Error())
+		}
+		return
+	}
+	for _, manifest := range manifests {
+		if err := sums.read(store, manifest[0], manifest[1]); err != nil {
+			log.Debug("reading checksums failed", "root", root, "path", manifest[0], "name", manifest[1], "error", err)
+		}
+	}
+
+	params := []any{"root", root}
+	if store.readOnly() {
+		params = append(params, "read-only", "true")
+	}
+	id, err := archiveID(store)
+	if err != nil {
+		log.Debug("archive id failed", "root", root, "error", err)
+	}
+	fs.lock.Lock()
+	fs.ids[root] = id
+	fs.lock.Unlock()
+	params = append(params, "id", id)
+	if volumer, ok := store.(volumer); ok {
+		if volume, err := volumer.volume(); err == nil && volume != "" {
+			params = append(params, "volume", volume)
+		}
+	}
+	params = append(params, historyParams(store)...)
+	if spacer, ok := store.(freeSpacer); ok {
+		if free, err := spacer.free(); err == nil {
+			params = append(params, "free", free)
+		}
+	}
+	fs.send("archive-scanned", params...)
+}
+
+func (fs *fsys) hash(cmd *parser.Message, canceled chan struct{}) error {
+	root := cmd.StringValue("root")
+	path := cmd.StringValue("path")
+	name := cmd.StringValue("name")
+	hash, err := fs.hashChecked(root, path, name, canceled)
+	if err != nil {
+		return err
+	}
+	fs.send("file-hashed",
+		"root", root,
+		"path", path,
+		"name", name,
+		"hash", hash,
+		"id", cmd.StringValue("id"))
+	return nil
+}
+
+func (fs *fsys) hashFile(root, path, name string, canceled chan struct{}) (string, error) {
+	report := func(progress int) {
+		fs.send("hashing-progress",
+			"root", root,
+			"path", path,
+			"name", name,
+			"progress", progress)
+	}
+
+	store := fs.storage(root)
+	algo := fs.algo(root)
+	if h, ok := store.(hasher); ok {
+		return h.hash(path, name, algo, canceled, report)
+	}
+	file, err := store.open(path, name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return hashContent(file, algo, canceled, report)
+}
+
+func (fs *fsys) algo(root string) string {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if algo := fs.algos[root]; algo != "" {
+		return algo
+	}
+	return "sha256"
+}
+
+func newFileHash(algo string) hash.Hash {
+	if algo == "sha512" {
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+func hashContent(content io.Reader, algo string, canceled chan struct{}, report func(progress int)) (string, error) {
+	hash := newFileHash(algo)
+	reader := &progressReader{
+		reader:   content,
+		canceled: canceled,
+		report:   report,
+	}
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+type progressReader struct {
+	reader     io.Reader
+	canceled   chan struct{}
+	progress   int
+	lastReport time.Time
+	report     func(progress int)
+}
+
+func (r *progressReader) Read(buf []byte) (int, error) {
+	select {
+	case <-r.canceled:
+		return 0, errCanceled
+	default:
+	}
+	n, err := r.reader.Read(buf)
+	r.progress += n
+	if time.Since(r.lastReport) >= 200*time.Millisecond {
+		if !r.lastReport.IsZero() {
+			r.report(r.progress)
+		}
+		r.lastReport = time.Now()
+	}
+	return n, err
+}
+
+func dir(rel string) string {
+	path := filepath.Dir(rel)
+	if path == "." {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,104 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+type storage interface {
+	walk(visit func(path, name string, size int, modTime time.Time) error) error
+	open(path, name string) (io.ReadCloser, error)
+	stat(path, name string) (size int, modTime time.Time, err error)
+	create(path, name string, content io.Reader, size int, modTime time.Time, algo, hash string) error
+	rename(path, name, toPath, toName string) error
+	remove(path, name string) error
+	appendMeta(name, entry string) error
+	readMeta(name string) (io.ReadCloser, error)
+	readOnly() bool
+}
+
+type hasher interface {
+	hash(path, name, algo string, canceled chan struct{}, report func(progress int)) (string, error)
+}
+
+// metaCreator creates a metadata file only if it does not exist yet.
+type metaCreator interface {
+	createMeta(name, entry string) (created bool, err error)
+}
+
+type freeSpacer interface {
+	free() (int, error)
+}
+
+var errReadOnly = errors.New("archive is read-only")
+
+func (fs *fsys) storage(root string) storage {
+	fs.lock.Lock()
+	readOnly := fs.readOnly[root] || fs.unlocked[root]
+	fs.lock.Unlock()
+	if readOnly {
+		return readOnlyStorage{fs.openStorage(root)}
+	}
+	return fs.openStorage(root)
+}
+
+func (fs *fsys) openStorage(root string) storage {
+	switch {
+	case strings.HasPrefix(root, "s3://"):
+		return newS3Storage(root)
+	case isCrypt(root):
+		return fs.cryptStorage(root)
+	case isPacked(root):
+		return &packedStorage{fs: fs, root: root}
+	}
+	fs.lock.Lock()
+	xattrs := fs.xattrs[root]
+	fs.lock.Unlock()
+	if xattrs {
+		return xattrStorage{localStorage(root)}
+	}
+	return localStorage(root)
+}
+
+type readOnlyStorage struct {
+	storage
+}
+
+func (s readOnlyStorage) create(path, name string, content io.Reader, size int, modTime time.Time, algo, hash string) error {
+	return errReadOnly
+}
+
+func (s readOnlyStorage) rename(path, name, toPath, toName string) error {
+	return errReadOnly
+}
+
+func (s readOnlyStorage) remove(path, name string) error {
+	return errReadOnly
+}
+
+func (s readOnlyStorage) appendMeta(name, entry string) error {
+	return errReadOnly
+}
+
+func (s readOnlyStorage) readOnly() bool {
+	return true
+}
+
+func (s readOnlyStorage) hash(path, name, algo string, canceled chan struct{}, report func(progress int)) (string, error) {
+	switch store := s.storage.(type) {
+	case localStorage:
+		return store.hashFile(path, name, algo, canceled, report, false, false)
+	case xattrStorage:
+		return store.hashFile(path, name, algo, canceled, report, true, false)
+	case hasher:
+		return store.hash(path, name, algo, canceled, report)
+	}
+	content, err := s.open(path, name)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	return hashContent(content, algo, canceled, report)
+}
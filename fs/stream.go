@@ -0,0 +1,168 @@
+package fs
+
+import (
+	"arc/parser"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+const (
+	chunkSize   = 64 * 1024
+	chunkWindow = 16
+)
+
+func (fs *fsys) readFile(cmd *parser.Message, canceled chan struct{}) error {
+	id := cmd.StringValue("id")
+	acks := make(chan struct{}, chunkWindow)
+	fs.lock.Lock()
+	fs.acks[id] = acks
+	fs.lock.Unlock()
+	defer func() {
+		fs.lock.Lock()
+		delete(fs.acks, id)
+		fs.lock.Unlock()
+	}()
+
+	err := fs.sendChunks(id, cmd.StringValue("root"), cmd.StringValue("path"), cmd.StringValue("name"), acks, canceled)
+	if err == errCanceled {
+		return nil
+	}
+	if err != nil {
+		fs.send("chunk-end", "id", id, "error", err.Error())
+		return nil
+	}
+	fs.send("chunk-end", "id", id)
+	return nil
+}
+
+func (fs *fsys) sendChunks(id, root, path, name string, acks, canceled chan struct{}) error {
+	file, err := fs.storage(root).open(path, name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := make([]byte, chunkSize)
+	inFlight := 0
+	for {
+		if inFlight == chunkWindow {
+			select {
+			case <-canceled:
+				return errCanceled
+			case <-acks:
+				inFlight--
+			}
+		}
+		select {
+		case <-canceled:
+			return errCanceled
+		default:
+		}
+		n, err := file.Read(buf)
+		if n > 0 {
+			fs.send("chunk", "id", id, "data", base64.StdEncoding.EncodeToString(buf[:n]))
+			inFlight++
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (fs *fsys) chunkAck(id string) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	select {
+	case fs.acks[id] <- struct{}{}:
+	default:
+	}
+}
+
+func (fs *fsys) openStream(id string) {
+	reader, writer := io.Pipe()
+	s := stream{reader, writer, make(chan chunk, chunkWindow+1)}
+	fs.lock.Lock()
+	fs.streams[id] = s
+	fs.lock.Unlock()
+	go fs.writeStream(id, s)
+}
+
+func (fs *fsys) writeStream(id string, s stream) {
+	for c := range s.chunks {
+		switch {
+		case c.end && c.err != nil:
+			s.writer.CloseWithError(c.err)
+		case c.end:
+			s.writer.Close()
+		default:
+			if _, err := s.writer.Write(c.data); err != nil {
+				continue
+			}
+			fs.send("chunk-ack", "id", id)
+		}
+	}
+}
+
+func (fs *fsys) stream(id string) (stream, bool) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	s, ok := fs.streams[id]
+	return s, ok
+}
+
+func (fs *fsys) closeStream(id string) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if s, ok := fs.streams[id]; ok {
+		s.reader.Close()
+		close(s.chunks)
+		delete(fs.streams, id)
+	}
+}
+
+func (fs *fsys) pushChunk(id string, c chunk) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	s, ok := fs.streams[id]
+	if !ok {
+		return
+	}
+	select {
+	case s.chunks <- c:
+	default:
+		s.reader.CloseWithError(errors.New("stream window exceeded"))
+	}
+}
+
+func (fs *fsys) chunk(cmd *parser.Message) {
+	data, err := base64.StdEncoding.DecodeString(cmd.StringValue("data"))
+	if err != nil {
+		fs.pushChunk(cmd.StringValue("id"), chunk{end: true, err: err})
+		return
+	}
+	fs.pushChunk(cmd.StringValue("id"), chunk{data: data})
+}
+
+func (fs *fsys) chunkEnd(cmd *parser.Message) {
+	c := chunk{end: true}
+	if msg := cmd.StringValue("error"); msg != "" {
+		c.err = errors.New(msg)
+	}
+	fs.pushChunk(cmd.StringValue("id"), c)
+}
+
+type stream struct {
+	reader *io.PipeReader
+	writer *io.PipeWriter
+	chunks chan chunk
+}
+
+type chunk struct {
+	data []byte
+	end  bool
+	err  error
+}
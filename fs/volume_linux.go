@@ -0,0 +1,92 @@
+package fs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func (root localStorage) volume() (string, error) {
+	path, err := filepath.Abs(string(root))
+	if err == nil {
+		path, err = filepath.EvalSymlinks(path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	mountPoint, device, source := "", uint64(0), ""
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		point := unescapeMount(fields[4])
+		if !within(path, point) || len(point) < len(mountPoint) {
+			continue
+		}
+		major, minor, _ := strings.Cut(fields[2], ":")
+		maj, _ := strconv.ParseUint(major, 10, 32)
+		min, _ := strconv.ParseUint(minor, 10, 32)
+		mountPoint, device, source = point, unix.Mkdev(uint32(maj), uint32(min)), unescapeMount(fields[sep+2])
+	}
+	if err := lines.Err(); err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir("/dev/disk/by-uuid")
+	if err != nil {
+		return "", nil
+	}
+	for _, entry := range entries {
+		name := filepath.Join("/dev/disk/by-uuid", entry.Name())
+		var stat unix.Stat_t
+		if unix.Stat(name, &stat) == nil && stat.Rdev == device {
+			return entry.Name(), nil
+		}
+		if target, err := filepath.EvalSymlinks(name); err == nil && target == source {
+			return entry.Name(), nil
+		}
+	}
+	return "", nil
+}
+
+func within(path, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+func unescapeMount(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	result := strings.Builder{}
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if code, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				result.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		result.WriteByte(field[i])
+	}
+	return result.String()
+}
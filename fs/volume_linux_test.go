@@ -0,0 +1,42 @@
+package fs
+
+import "testing"
+
+func TestUnescapeMount(t *testing.T) {
+	for field, want := range map[string]string{
+		`/mnt/plain`:         "/mnt/plain",
+		`/mnt/with\040space`: "/mnt/with space",
+		`/mnt/tab\011and\\`:  "/mnt/tab\tand\\\\",
+		`/mnt/short\04`:      `/mnt/short\04`,
+	} {
+		if got := unescapeMount(field); got != want {
+			t.Errorf("unescapeMount(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestWithin(t *testing.T) {
+	for _, c := range []struct {
+		path, dir string
+		want      bool
+	}{
+		{"/mnt/disk/photos", "/", true},
+		{"/mnt/disk/photos", "/mnt/disk", true},
+		{"/mnt/disk", "/mnt/disk", true},
+		{"/mnt/disk2/photos", "/mnt/disk", false},
+		{"/mnt", "/mnt/disk", false},
+	} {
+		if got := within(c.path, c.dir); got != c.want {
+			t.Errorf("within(%q, %q) = %v", c.path, c.dir, got)
+		}
+	}
+}
+
+func TestVolumeOfTempDir(t *testing.T) {
+	if _, err := localStorage(t.TempDir()).volume(); err != nil {
+		t.Errorf("volume: %v", err)
+	}
+	if _, err := localStorage("/does/not/exist").volume(); err == nil {
+		t.Error("volume of a missing root")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package fs
+
+import "errors"
+
+func (root localStorage) volume() (string, error) {
+	return "", errors.ErrUnsupported
+}
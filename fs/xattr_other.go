@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd)
+
+package fs
+
+import "errors"
+
+func readHashXattrs(name, algo string) (hash string, size int, modTime int64, ok bool) {
+	return "", 0, 0, false
+}
+
+func writeHashXattrs(name, algo, hash string, size int, modTime int64) error {
+	return errors.ErrUnsupported
+}
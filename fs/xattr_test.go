@@ -0,0 +1,103 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func xattrFile(t *testing.T, content string) (localStorage, string) {
+	t.Helper()
+	root := t.TempDir()
+	name := filepath.Join(root, "a")
+	os.WriteFile(name, []byte(content), 0644)
+	if err := writeHashXattrs(name, "sha256", sum(content), len(content), 0); err != nil {
+		t.Skipf("no user xattrs here: %v", err)
+	}
+	return localStorage(root), name
+}
+
+func TestHashXattrsRoundTrip(t *testing.T) {
+	_, name := xattrFile(t, "one")
+	if err := writeHashXattrs(name, "sha256", sum("one"), 3, 42); err != nil {
+		t.Fatal(err)
+	}
+	hash, size, modTime, ok := readHashXattrs(name, "sha256")
+	if !ok || hash != sum("one") || size != 3 || modTime != 42 {
+		t.Errorf("read %s %d %d %v", hash, size, modTime, ok)
+	}
+	if _, _, _, ok := readHashXattrs(name, "sha512"); ok {
+		t.Error("hash stored for sha256 read back for sha512")
+	}
+}
+
+func TestHashFileTrustsXattrsOnlyWhenEnabled(t *testing.T) {
+	store, name := xattrFile(t, "one")
+	info, _ := os.Stat(name)
+	stale := strings.Repeat("ab", 32)
+	writeHashXattrs(name, "sha256", stale, 3, info.ModTime().UnixNano())
+
+	if hash, _ := store.hash("", "a", "sha256", nil, func(int) {}); hash != sum("one") {
+		t.Errorf("with xattrs off hashed as %s", hash)
+	}
+
+	if hash, _ := store.hashFile("", "a", "sha256", nil, func(int) {}, true, false); hash != stale {
+		t.Errorf("with xattrs on hashed as %s, want the stored hash", hash)
+	}
+
+	modTime := info.ModTime().Add(time.Second)
+	os.Chtimes(name, modTime, modTime)
+	if hash, _ := (xattrStorage{store}).hash("", "a", "sha256", nil, func(int) {}); hash != sum("one") {
+		t.Errorf("after a change hashed as %s", hash)
+	}
+	if hash, _, _, _ := readHashXattrs(name, "sha256"); hash != sum("one") {
+		t.Errorf("stored hash = %s after rehashing", hash)
+	}
+}
+
+func TestCreateTagsOnlyVerifiedCopies(t *testing.T) {
+	local, _ := xattrFile(t, "probe")
+	store := xattrStorage{local}
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := store.create("", "good", strings.NewReader("one"), 3, modTime, "sha256", sum("one")); err != nil {
+		t.Fatal(err)
+	}
+	if hash, _, _, ok := readHashXattrs(store.name("", "good"), "sha256"); !ok || hash != sum("one") {
+		t.Errorf("verified copy tagged with %s %v", hash, ok)
+	}
+
+	if err := store.create("", "bad", strings.NewReader("two"), 3, modTime, "sha256", sum("one")); err != nil {
+		t.Fatal(err)
+	}
+	if hash, _, _, ok := readHashXattrs(store.name("", "bad"), "sha256"); ok {
+		t.Errorf("copy that does not match tagged with %s", hash)
+	}
+}
+
+func TestScanEnablesXattrsPerRoot(t *testing.T) {
+	store, _ := xattrFile(t, "probe")
+	root, other := string(store), t.TempDir()
+	os.WriteFile(filepath.Join(other, "a"), []byte("one"), 0644)
+	engine := startFs(t, other)
+	engine.Send("scan", "root", root, "session", "test", "xattrs", "true")
+	awaitMsg(t, engine, "archive-scanned")
+
+	engine.Send("copy", "from-root", other, "from-path", "", "from-name", "a",
+		"root", root, "path", "", "name", "a", "hash", sum("one"), "batch", "b1", "id", "1")
+	awaitMsg(t, engine, "file-copied")
+	if hash, _, _, ok := readHashXattrs(filepath.Join(root, "a"), "sha256"); !ok || hash != sum("one") {
+		t.Errorf("copy into a root scanned with xattrs tagged with %s %v", hash, ok)
+	}
+
+	engine.Send("copy", "from-root", root, "from-path", "", "from-name", "a",
+		"root", other, "path", "", "name", "b", "hash", sum("one"), "batch", "b1", "id", "2")
+	awaitMsg(t, engine, "file-copied")
+	if hash, _, _, ok := readHashXattrs(filepath.Join(other, "b"), "sha256"); ok {
+		t.Errorf("copy into a root scanned without xattrs tagged with %s", hash)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package fs
+
+import (
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const xattrPrefix = "user.arc."
+
+func getXattr(name, attr string) (string, bool) {
+	buf := make([]byte, 128)
+	n, err := unix.Getxattr(name, xattrPrefix+attr, buf)
+	if err != nil {
+		return "", false
+	}
+	return string(buf[:n]), true
+}
+
+func readHashXattrs(name, algo string) (hash string, size int, modTime int64, ok bool) {
+	if stored, ok := getXattr(name, "algo"); !ok || stored != algo {
+		return "", 0, 0, false
+	}
+	hash, ok1 := getXattr(name, "hash")
+	sizeValue, ok2 := getXattr(name, "size")
+	mtimeValue, ok3 := getXattr(name, "mtime")
+	if !ok1 || !ok2 || !ok3 {
+		return "", 0, 0, false
+	}
+	size, err1 := strconv.Atoi(sizeValue)
+	modTime, err2 := strconv.ParseInt(mtimeValue, 10, 64)
+	if err1 != nil || err2 != nil {
+		return "", 0, 0, false
+	}
+	return hash, size, modTime, true
+}
+
+func writeHashXattrs(name, algo, hash string, size int, modTime int64) error {
+	attrs := [][2]string{
+		{"algo", algo},
+		{"hash", hash},
+		{"size", strconv.Itoa(size)},
+		{"mtime", strconv.FormatInt(modTime, 10)},
+	}
+	for _, attr := range attrs {
+		if err := unix.Setxattr(name, xattrPrefix+attr[0], []byte(attr[1]), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -46,7 +46,10 @@ func Debug(msg string, params ...any) {
 	lState := <-state
 	defer storeState(lState)
 
-	if lState.loggerName != "" && lState.writer == nil {
+	if lState.loggerName == "" {
+		return
+	}
+	if lState.writer == nil {
 		var err any
 		lState.writer, err = os.Create(lState.loggerName)
 		if err != nil {
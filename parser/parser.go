@@ -28,21 +28,30 @@ func (msg *Message) StringValue(param string) string {
 }
 
 func (msg *Message) Int(param string) int {
-	res, err := strconv.ParseInt(msg.Params[param], 10, 64)
+	res, err := msg.IntValue(param)
 	if err != nil {
 		panic(err)
 	}
-	return int(res)
+	return res
+}
+
+func (msg *Message) IntValue(param string) (int, error) {
+	res, err := strconv.ParseInt(msg.Params[param], 10, 64)
+	return int(res), err
 }
 
 func (msg *Message) Time(param string) time.Time {
-	res, err := time.Parse(time.RFC3339, msg.Params[param])
+	res, err := msg.TimeValue(param)
 	if err != nil {
 		panic(err)
 	}
 	return res
 }
 
+func (msg *Message) TimeValue(param string) (time.Time, error) {
+	return time.Parse(time.RFC3339, msg.Params[param])
+}
+
 func Parse(cmd string) *Message {
 	res := &Message{
 		Params: map[string]string{},
@@ -0,0 +1,369 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	PartSize  int
+	CopySize  int
+	HTTP      *http.Client
+}
+
+type Object struct {
+	Key          string
+	Size         int
+	LastModified time.Time
+	ETag         string
+	Metadata     map[string]string
+}
+
+type listResult struct {
+	Contents []struct {
+		Key          string
+		LastModified time.Time
+		ETag         string
+		Size         int
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+const (
+	defaultPartSize = 64 << 20
+	maxCopySize     = 5 << 30
+	maxParts        = 10000
+)
+
+func (c *Client) List(bucket, prefix string, visit func(Object) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.do("GET", bucket, "", query, nil, -1, nil)
+		if err != nil {
+			return err
+		}
+		result := listResult{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, object := range result.Contents {
+			if err := visit(Object{Key: object.Key, Size: object.Size, LastModified: object.LastModified, ETag: object.ETag}); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (c *Client) Get(bucket, key string) (io.ReadCloser, error) {
+	resp, err := c.do("GET", bucket, key, nil, nil, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) Head(bucket, key string) (Object, error) {
+	resp, err := c.do("HEAD", bucket, key, nil, nil, -1, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	resp.Body.Close()
+
+	object := Object{Key: key, Metadata: map[string]string{}}
+	object.Size, _ = strconv.Atoi(resp.Header.Get("Content-Length"))
+	object.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	object.ETag = resp.Header.Get("ETag")
+	for name := range resp.Header {
+		if meta, ok := strings.CutPrefix(strings.ToLower(name), "x-amz-meta-"); ok {
+			object.Metadata[meta] = resp.Header.Get(name)
+		}
+	}
+	return object, nil
+}
+
+func (c *Client) Put(bucket, key string, body io.Reader, size int, metadata map[string]string) error {
+	headers := map[string]string{}
+	for name, value := range metadata {
+		headers["X-Amz-Meta-"+name] = value
+	}
+	if partSize := c.partSize(size); size > partSize {
+		return c.putMultipart(bucket, key, body, size, partSize, headers)
+	}
+	resp, err := c.do("PUT", bucket, key, nil, body, size, headers)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *Client) partSize(size int) int {
+	partSize := c.PartSize
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+	for size > partSize*maxParts {
+		partSize *= 2
+	}
+	return partSize
+}
+
+type completeUpload struct {
+	XMLName xml.Name     `xml:"CompleteMultipartUpload"`
+	Parts   []uploadPart `xml:"Part"`
+}
+
+type uploadPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (c *Client) putMultipart(bucket, key string, body io.Reader, size, partSize int, headers map[string]string) error {
+	resp, err := c.do("POST", bucket, key, url.Values{"uploads": {""}}, nil, 0, headers)
+	if err != nil {
+		return err
+	}
+	initiated := struct{ UploadId string }{}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	upload := url.Values{"uploadId": {initiated.UploadId}}
+	complete := completeUpload{}
+	for offset := 0; offset < size; offset += partSize {
+		number := len(complete.Parts) + 1
+		part := min(partSize, size-offset)
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiated.UploadId}}
+		resp, err := c.do("PUT", bucket, key, query, io.LimitReader(body, int64(part)), part, nil)
+		if err != nil {
+			c.abortMultipart(bucket, key, upload)
+			return err
+		}
+		resp.Body.Close()
+		complete.Parts = append(complete.Parts, uploadPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	}
+
+	content, err := xml.Marshal(complete)
+	if err != nil {
+		c.abortMultipart(bucket, key, upload)
+		return err
+	}
+	resp, err = c.do("POST", bucket, key, upload, bytes.NewReader(content), len(content), nil)
+	if err != nil {
+		c.abortMultipart(bucket, key, upload)
+		return err
+	}
+	if _, err := decodeResult(resp, "complete", bucket, key); err != nil {
+		c.abortMultipart(bucket, key, upload)
+		return err
+	}
+	return nil
+}
+
+// decodeResult reads the body of a successful response. S3 may report
+// a failed copy or upload completion with status 200 and an error body.
+func decodeResult(resp *http.Response, action, bucket, key string) (etag string, err error) {
+	defer resp.Body.Close()
+	result := struct{ Code, Message, ETag string }{}
+	if xml.NewDecoder(resp.Body).Decode(&result); result.Code != "" {
+		return "", errors.New("s3: " + action + " " + bucket + "/" + key + ": " + strings.TrimSpace(result.Code+" "+result.Message))
+	}
+	return result.ETag, nil
+}
+
+func (c *Client) abortMultipart(bucket, key string, upload url.Values) {
+	if resp, err := c.do("DELETE", bucket, key, upload, nil, -1, nil); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (c *Client) Create(bucket, key string, body io.Reader, size int) error {
+	resp, err := c.do("PUT", bucket, key, nil, body, size, map[string]string{"If-None-Match": "*"})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *Client) Copy(bucket, from, to string) error {
+	source := "/" + bucket + "/" + escapePath(from)
+	object, err := c.Head(bucket, from)
+	if err != nil {
+		return err
+	}
+	copySize := c.CopySize
+	if copySize <= 0 {
+		copySize = maxCopySize
+	}
+	if object.Size > copySize {
+		return c.copyMultipart(bucket, source, to, object)
+	}
+	headers := map[string]string{
+		"X-Amz-Copy-Source":        source,
+		"X-Amz-Metadata-Directive": "COPY",
+	}
+	resp, err := c.do("PUT", bucket, to, nil, nil, 0, headers)
+	if err != nil {
+		return err
+	}
+	_, err = decodeResult(resp, "copy", bucket, to)
+	return err
+}
+
+// copyMultipart copies objects above the size limit of a single copy
+// request part by part with UploadPartCopy.
+func (c *Client) copyMultipart(bucket, source, key string, object Object) error {
+	headers := map[string]string{}
+	for name, value := range object.Metadata {
+		headers["X-Amz-Meta-"+name] = value
+	}
+	resp, err := c.do("POST", bucket, key, url.Values{"uploads": {""}}, nil, 0, headers)
+	if err != nil {
+		return err
+	}
+	initiated := struct{ UploadId string }{}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	upload := url.Values{"uploadId": {initiated.UploadId}}
+	complete := completeUpload{}
+	partSize := c.partSize(object.Size)
+	for offset := 0; offset < object.Size; offset += partSize {
+		number := len(complete.Parts) + 1
+		last := min(offset+partSize, object.Size) - 1
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiated.UploadId}}
+		headers := map[string]string{
+			"X-Amz-Copy-Source":       source,
+			"X-Amz-Copy-Source-Range": fmt.Sprintf("bytes=%d-%d", offset, last),
+		}
+		resp, err := c.do("PUT", bucket, key, query, nil, 0, headers)
+		if err != nil {
+			c.abortMultipart(bucket, key, upload)
+			return err
+		}
+		etag, err := decodeResult(resp, "copy part", bucket, key)
+		if err != nil {
+			c.abortMultipart(bucket, key, upload)
+			return err
+		}
+		complete.Parts = append(complete.Parts, uploadPart{PartNumber: number, ETag: etag})
+	}
+
+	content, err := xml.Marshal(complete)
+	if err != nil {
+		c.abortMultipart(bucket, key, upload)
+		return err
+	}
+	resp, err = c.do("POST", bucket, key, upload, bytes.NewReader(content), len(content), nil)
+	if err != nil {
+		c.abortMultipart(bucket, key, upload)
+		return err
+	}
+	if _, err := decodeResult(resp, "complete", bucket, key); err != nil {
+		c.abortMultipart(bucket, key, upload)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) Delete(bucket, key string) error {
+	resp, err := c.do("DELETE", bucket, key, nil, nil, -1, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *Client) do(method, bucket, key string, query url.Values, body io.Reader, size int, headers map[string]string) (*http.Response, error) {
+	target := strings.TrimSuffix(c.Endpoint, "/") + "/" + bucket
+	if key != "" {
+		target += "/" + escapePath(key)
+	}
+	if len(query) > 0 {
+		target += "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = int64(size)
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if body == nil {
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayload)
+	}
+	Sign(req, c.Region, c.AccessKey, c.SecretKey, time.Now())
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("s3://%s/%s: %w", bucket, key, os.ErrNotExist)
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return nil, fmt.Errorf("s3://%s/%s: %w", bucket, key, os.ErrExist)
+	}
+	detail := struct {
+		Code    string
+		Message string
+	}{}
+	xml.NewDecoder(resp.Body).Decode(&detail)
+	if detail.Code == "" {
+		detail.Code = resp.Status
+	}
+	return nil, errors.New("s3: " + method + " " + bucket + "/" + key + ": " + strings.TrimSpace(detail.Code+" "+detail.Message))
+}
+
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,160 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	amzDate         = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	emptyPayload    = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func Sign(req *http.Request, region, accessKey, secretKey string, now time.Time) {
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	}
+	req.Header.Set("X-Amz-Date", now.UTC().Format(amzDate))
+	signedHeaders, signature := Signature(req, region, secretKey)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope(req, region)+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func Signature(req *http.Request, region, secretKey string) (signedHeaders, signature string) {
+	names := []string{"host"}
+	for name := range req.Header {
+		if name = strings.ToLower(name); name != "authorization" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";"), sign(req, region, secretKey, names)
+}
+
+func Verify(req *http.Request, region, accessKey, secretKey string) error {
+	auth := req.Header.Get("Authorization")
+	if credential := between(auth, "Credential=", "/"); credential != accessKey {
+		return fmt.Errorf("unknown access key %q", credential)
+	}
+	names := strings.Split(between(auth, "SignedHeaders=", ","), ";")
+	if expected := sign(req, region, secretKey, names); between(auth, "Signature=", ",") != expected {
+		return fmt.Errorf("signature does not match, expected %s", expected)
+	}
+	return nil
+}
+
+func between(s, start, end string) string {
+	_, rest, ok := strings.Cut(s, start)
+	if !ok {
+		return ""
+	}
+	value, _, _ := strings.Cut(rest, end)
+	return value
+}
+
+func sign(req *http.Request, region, secretKey string, names []string) string {
+	headers := map[string]string{}
+	for _, name := range names {
+		if name == "host" {
+			headers[name] = host(req)
+		} else {
+			headers[name] = strings.Join(strings.Fields(strings.Join(req.Header.Values(name), ",")), " ")
+		}
+	}
+	sort.Strings(names)
+
+	canonical := &strings.Builder{}
+	canonical.WriteString(req.Method + "\n")
+	canonical.WriteString(canonicalPath(req.URL) + "\n")
+	canonical.WriteString(canonicalQuery(req.URL) + "\n")
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	canonical.WriteString("\n" + strings.Join(names, ";") + "\n")
+	canonical.WriteString(req.Header.Get("X-Amz-Content-Sha256"))
+
+	date := req.Header.Get("X-Amz-Date")
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope(req, region) + "\n" + hexHash(canonical.String())
+
+	key := hmacSum([]byte("AWS4"+secretKey), date[:8])
+	key = hmacSum(key, region)
+	key = hmacSum(key, "s3")
+	key = hmacSum(key, "aws4_request")
+	return hex.EncodeToString(hmacSum(key, toSign))
+}
+
+func scope(req *http.Request, region string) string {
+	return req.Header.Get("X-Amz-Date")[:8] + "/" + region + "/s3/aws4_request"
+}
+
+func host(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func canonicalPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments[i] = escape(unescaped)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, escape(key)+"="+escape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func escape(s string) string {
+	buf := &strings.Builder{}
+	for _, b := range []byte(s) {
+		if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || b == '-' || b == '_' || b == '.' || b == '~' {
+			buf.WriteByte(b)
+		} else {
+			buf.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{b})))
+		}
+	}
+	return buf.String()
+}
+
+func hexHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
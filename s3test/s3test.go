@@ -0,0 +1,292 @@
+package s3test
+
+import (
+	"arc/s3"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Server struct {
+	Region    string
+	AccessKey string
+	SecretKey string
+	CopySize  int
+
+	lock    sync.Mutex
+	buckets map[string]map[string]*object
+	uploads map[string]*upload
+	lastId  int
+}
+
+type object struct {
+	data     []byte
+	modified time.Time
+	metadata http.Header
+}
+
+type upload struct {
+	key      string
+	metadata http.Header
+	parts    map[int][]byte
+}
+
+func newObject(data []byte, metadata http.Header) *object {
+	return &object{data: data, modified: time.Now().UTC(), metadata: metadata}
+}
+
+func (obj *object) etag() string {
+	return fmt.Sprintf("%q", fmt.Sprintf("%x", md5.Sum(obj.data)))
+}
+
+func NewServer(region, accessKey, secretKey string) *Server {
+	return &Server{
+		Region:    region,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		buckets:   map[string]map[string]*object{},
+		uploads:   map[string]*upload{},
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if code, message := s.authorize(req); code != "" {
+		writeError(w, http.StatusForbidden, code, message)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if bucket == "" {
+		writeError(w, http.StatusBadRequest, "InvalidBucketName", "missing bucket")
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	objects := s.buckets[bucket]
+	if objects == nil {
+		objects = map[string]*object{}
+		s.buckets[bucket] = objects
+	}
+
+	query := req.URL.Query()
+	switch {
+	case req.Method == "GET" && key == "":
+		s.list(w, req, objects)
+
+	case req.Method == "GET" || req.Method == "HEAD":
+		obj := objects[key]
+		if obj == nil {
+			writeError(w, http.StatusNotFound, "NoSuchKey", key)
+			return
+		}
+		for name, values := range obj.metadata {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", obj.modified.Format(http.TimeFormat))
+		w.Header().Set("ETag", obj.etag())
+		if req.Method == "GET" {
+			w.Write(obj.data)
+		}
+
+	case query.Has("uploadId"):
+		s.multipart(w, req, objects, key)
+
+	case req.Method == "PUT" && req.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(req.Header.Get("X-Amz-Copy-Source"))
+		_, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+		obj := objects[sourceKey]
+		if obj == nil {
+			writeError(w, http.StatusNotFound, "NoSuchKey", sourceKey)
+			return
+		}
+		if s.CopySize > 0 && len(obj.data) > s.CopySize {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", "source too large for a single copy")
+			return
+		}
+		objects[key] = newObject(obj.data, obj.metadata.Clone())
+		fmt.Fprintf(w, "<CopyObjectResult><ETag>%s</ETag></CopyObjectResult>", objects[key].etag())
+
+	case req.Method == "POST" && query.Has("uploads"):
+		s.lastId++
+		id := strconv.Itoa(s.lastId)
+		s.uploads[id] = &upload{key: key, metadata: amzMetadata(req), parts: map[int][]byte{}}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", bucket, key, id)
+
+	case req.Method == "PUT" && req.Header.Get("If-None-Match") == "*" && objects[key] != nil:
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", key)
+
+	case req.Method == "PUT":
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		objects[key] = newObject(data, amzMetadata(req))
+
+	case req.Method == "DELETE":
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", req.Method)
+	}
+}
+
+func amzMetadata(req *http.Request) http.Header {
+	metadata := http.Header{}
+	for name, values := range req.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+			metadata[name] = values
+		}
+	}
+	return metadata
+}
+
+func (s *Server) multipart(w http.ResponseWriter, req *http.Request, objects map[string]*object, key string) {
+	id := req.URL.Query().Get("uploadId")
+	up := s.uploads[id]
+	if up == nil || up.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", id)
+		return
+	}
+
+	switch req.Method {
+	case "PUT":
+		number, err := strconv.Atoi(req.URL.Query().Get("partNumber"))
+		if err != nil || number < 1 {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "bad part number")
+			return
+		}
+		if req.Header.Get("X-Amz-Copy-Source") != "" {
+			s.copyPart(w, req, objects, up, number)
+			return
+		}
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		up.parts[number] = data
+		w.Header().Set("ETag", (&object{data: data}).etag())
+
+	case "POST":
+		complete := struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}{}
+		if err := xml.NewDecoder(req.Body).Decode(&complete); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+			return
+		}
+		data := []byte{}
+		for i, part := range complete.Parts {
+			content, ok := up.parts[part.PartNumber]
+			if !ok || part.PartNumber != i+1 || (&object{data: content}).etag() != part.ETag {
+				writeError(w, http.StatusBadRequest, "InvalidPart", strconv.Itoa(part.PartNumber))
+				return
+			}
+			data = append(data, content...)
+		}
+		delete(s.uploads, id)
+		objects[key] = newObject(data, up.metadata)
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key><ETag>%s</ETag></CompleteMultipartUploadResult>", key, objects[key].etag())
+
+	case "DELETE":
+		delete(s.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", req.Method)
+	}
+}
+
+func (s *Server) copyPart(w http.ResponseWriter, req *http.Request, objects map[string]*object, up *upload, number int) {
+	source, _ := url.PathUnescape(req.Header.Get("X-Amz-Copy-Source"))
+	_, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	obj := objects[sourceKey]
+	if obj == nil {
+		writeError(w, http.StatusNotFound, "NoSuchKey", sourceKey)
+		return
+	}
+	first, last := 0, len(obj.data)-1
+	if byteRange := req.Header.Get("X-Amz-Copy-Source-Range"); byteRange != "" {
+		if _, err := fmt.Sscanf(byteRange, "bytes=%d-%d", &first, &last); err != nil || first > last || last >= len(obj.data) {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "bad copy source range")
+			return
+		}
+	}
+	data := append([]byte{}, obj.data[first:last+1]...)
+	up.parts[number] = data
+	fmt.Fprintf(w, "<CopyPartResult><ETag>%s</ETag></CopyPartResult>", (&object{data: data}).etag())
+}
+
+func (s *Server) authorize(req *http.Request) (code, message string) {
+	if err := s3.Verify(req, s.Region, s.AccessKey, s.SecretKey); err != nil {
+		return "SignatureDoesNotMatch", err.Error()
+	}
+	return "", ""
+}
+
+type listResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Contents              []listEntry
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+}
+
+type listEntry struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+}
+
+const pageSize = 1000
+
+func (s *Server) list(w http.ResponseWriter, req *http.Request, objects map[string]*object) {
+	prefix := req.URL.Query().Get("prefix")
+	after := req.URL.Query().Get("continuation-token")
+	keys := []string{}
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := listResult{}
+	if len(keys) > pageSize {
+		keys = keys[:pageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		result.Contents = append(result.Contents, listEntry{
+			Key:          key,
+			LastModified: objects[key].modified.Format(time.RFC3339),
+			ETag:         objects[key].etag(),
+			Size:         len(objects[key].data),
+		})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"arc/parser"
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+type Conn interface {
+	Send(kind string, params ...any)
+	Receive() (*parser.Message, error)
+	Close()
+}
+
+type stream struct {
+	reader *bufio.Reader
+	writer io.Writer
+	lock   sync.Mutex
+}
+
+func Stream(in io.Reader, out io.Writer) Conn {
+	return &stream{
+		reader: bufio.NewReader(in),
+		writer: out,
+	}
+}
+
+func Stdio() Conn {
+	return Stream(os.Stdin, os.Stdout)
+}
+
+func (s *stream) Send(kind string, params ...any) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.writer.Write([]byte(parser.String(kind, params...)))
+}
+
+func (s *stream) Receive() (*parser.Message, error) {
+	for {
+		text, err := s.reader.ReadString('\n')
+		if strings.TrimSpace(text) != "" {
+			return parser.Parse(text), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *stream) Close() {
+	if closer, ok := s.writer.(io.Closer); ok && s.writer != os.Stdout {
+		closer.Close()
+	}
+}
+
+type pipe struct {
+	in  *queue
+	out *queue
+}
+
+func Pipe() (Conn, Conn) {
+	a, b := newQueue(), newQueue()
+	return &pipe{in: a, out: b}, &pipe{in: b, out: a}
+}
+
+func Closed() Conn {
+	a, b := Pipe()
+	a.Close()
+	b.Close()
+	return a
+}
+
+func (p *pipe) Send(kind string, params ...any) {
+	p.out.put(parser.String(kind, params...))
+}
+
+func (p *pipe) Receive() (*parser.Message, error) {
+	text, err := p.in.get()
+	if err != nil {
+		return nil, err
+	}
+	return parser.Parse(text), nil
+}
+
+func (p *pipe) Close() {
+	p.out.close()
+}
+
+type queue struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	items  []string
+	closed bool
+}
+
+func newQueue() *queue {
+	q := &queue{}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+func (q *queue) put(item string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.items = append(q.items, item)
+	q.cond.Signal()
+}
+
+func (q *queue) get() (string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.items) == 0 {
+		if q.closed {
+			return "", io.EOF
+		}
+		q.cond.Wait()
+	}
+	item := q.items[0]
+	q.items = q.items[1:]
+	return item, nil
+}
+
+func (q *queue) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
@@ -0,0 +1,85 @@
+package ui
+
+import (
+	"arc/parser"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+type atticEntry struct {
+	batch   string
+	path    string
+	name    string
+	trash   string
+	size    int
+	modTime time.Time
+	time    time.Time
+}
+
+func parseAtticEntry(msg *parser.Message) atticEntry {
+	return atticEntry{
+		batch:   msg.StringValue("batch"),
+		path:    msg.StringValue("path"),
+		name:    msg.StringValue("name"),
+		trash:   msg.StringValue("trash"),
+		size:    msg.Int("size"),
+		modTime: msg.Time("mod-time"),
+		time:    msg.Time("time"),
+	}
+}
+
+func (app *app) handleAtticKeyEvent(event *tcell.EventKey) {
+	switch event.Name() {
+	case "Up":
+		app.atticIdx--
+
+	case "Down":
+		app.atticIdx++
+
+	case "Enter":
+		if app.atticIdx < len(app.attic) {
+			entry := app.attic[app.atticIdx]
+			app.send("restore-attic", "root", app.atticRoot, "trash", entry.trash, "path", entry.path, "name", entry.name)
+		}
+		app.showAttic = false
+
+	case "Esc", "F7":
+		app.showAttic = false
+
+	case "Ctrl+C":
+		app.send("stop")
+	}
+	app.atticIdx = max(0, min(app.atticIdx, len(app.attic)-1))
+}
+
+func (app *app) atticView(b *builder) {
+	b.newLine()
+	b.layout(c{size: 1}, c{size: 22}, c{size: 20, flex: 1}, c{size: 22}, c{size: 19})
+	b.text(" ", styleFolderHeader)
+	b.text("Removed", styleFolderHeader)
+	b.text("Path", styleFolderHeader)
+	b.text("  Modified", styleFolderHeader)
+	b.text("               Size", styleFolderHeader)
+	lines := app.screenSize.height - 4
+
+	offset := max(0, app.atticIdx+1-lines)
+	for i, entry := range app.attic[offset:] {
+		if i >= lines {
+			break
+		}
+		style := styleDefault.Reverse(offset+i == app.atticIdx)
+		b.newLine()
+		b.text(" ", style)
+		b.text(entry.time.Local().Format("2006-01-02 15:04:05"), style)
+		b.text(filepath.Join(entry.path, entry.name), style)
+		b.text(entry.modTime.Local().Format("  2006-01-02 15:04:05"), style)
+		b.text(fmt.Sprintf("%19s", formatSize(entry.size)), style)
+	}
+	if shown := len(app.attic) - offset; shown < lines {
+		b.newLine()
+		b.space(app.screenSize.width, lines-shown, styleDefault)
+	}
+}
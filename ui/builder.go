@@ -112,6 +112,11 @@ func (b *builder) text(text string, style tcell.Style) {
 const modTimeFormat = "  " + time.RFC3339
 
 func (b *builder) state(file *entry, style tcell.Style) {
+	if file.change != "" {
+		b.text(file.change, style)
+		return
+	}
+
 	switch file.state {
 	case resolved:
 		b.text("", style)
@@ -17,6 +17,7 @@ type entry struct {
 	state    state
 	progress int
 	counts   string
+	change   string
 }
 
 type kind int
@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"arc/parser"
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+type batch struct {
+	batch  string
+	time   time.Time
+	ops    int
+	roots  string
+	undone bool
+	pruned bool
+}
+
+func parseBatch(msg *parser.Message) batch {
+	return batch{
+		batch:  msg.StringValue("batch"),
+		time:   msg.Time("time"),
+		ops:    msg.Int("ops"),
+		roots:  msg.StringValue("roots"),
+		undone: msg.StringValue("undone") == "true",
+		pruned: msg.StringValue("pruned") == "true",
+	}
+}
+
+func (app *app) handleHistoryKeyEvent(event *tcell.EventKey) {
+	switch event.Name() {
+	case "Up":
+		app.historyIdx--
+
+	case "Down":
+		app.historyIdx++
+
+	case "Enter":
+		if app.historyIdx < len(app.batches) {
+			app.send("undo", "batch", app.batches[app.historyIdx].batch)
+		}
+		app.showHistory = false
+
+	case "Esc", "F9":
+		app.showHistory = false
+
+	case "Ctrl+C":
+		app.send("stop")
+	}
+	app.historyIdx = max(0, min(app.historyIdx, len(app.batches)-1))
+}
+
+func (app *app) historyView(b *builder) {
+	b.newLine()
+	b.layout(c{size: 1}, c{size: 24}, c{size: 22}, c{size: 8}, c{size: 20, flex: 1}, c{size: 8})
+	b.text(" ", styleFolderHeader)
+	b.text("Batch", styleFolderHeader)
+	b.text("  Time", styleFolderHeader)
+	b.text("     Ops", styleFolderHeader)
+	b.text("  Archives", styleFolderHeader)
+	b.text("", styleFolderHeader)
+	lines := app.screenSize.height - 4
+
+	offset := max(0, app.historyIdx+1-lines)
+	for i, info := range app.batches[offset:] {
+		if i >= lines {
+			break
+		}
+		style := styleDefault.Reverse(offset+i == app.historyIdx)
+		b.newLine()
+		b.text(" ", style)
+		b.text(info.batch, style)
+		b.text(info.time.Local().Format("  2006-01-02 15:04:05"), style)
+		b.text(fmt.Sprintf("%8d", info.ops), style)
+		b.text("  "+info.roots, style)
+		if info.undone {
+			b.text(" undone", style)
+		} else if info.pruned {
+			b.text(" pruned", style)
+		} else {
+			b.text("", style)
+		}
+	}
+	if shown := len(app.batches) - offset; shown < lines {
+		b.newLine()
+		b.space(app.screenSize.width, lines-shown, styleDefault)
+	}
+}
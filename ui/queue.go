@@ -0,0 +1,116 @@
+package ui
+
+import (
+	"arc/parser"
+	"fmt"
+	"path/filepath"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+type queueItem struct {
+	id      string
+	kind    string
+	root    string
+	path    string
+	name    string
+	running bool
+}
+
+func parseQueueItem(msg *parser.Message) queueItem {
+	return queueItem{
+		id:      msg.StringValue("id"),
+		kind:    msg.StringValue("kind"),
+		root:    msg.StringValue("root"),
+		path:    msg.StringValue("path"),
+		name:    msg.StringValue("name"),
+		running: msg.StringValue("running") == "true",
+	}
+}
+
+func (app *app) queueStatus() string {
+	if app.queued == 0 && app.running == 0 {
+		return ""
+	}
+	status := fmt.Sprintf(" Queue: %d running, %d pending", app.running, app.queued)
+	if app.paused {
+		status += " (paused)"
+	}
+	return status
+}
+
+func (app *app) togglePause() {
+	if app.paused {
+		app.send("resume")
+	} else {
+		app.send("pause")
+	}
+}
+
+func (app *app) handleQueueKeyEvent(event *tcell.EventKey) {
+	switch event.Name() {
+	case "Up":
+		app.queueIdx--
+
+	case "Down":
+		app.queueIdx++
+
+	case "Rune[c]", "Delete":
+		if app.queueIdx < len(app.queue) {
+			app.send("cancel", "id", app.queue[app.queueIdx].id)
+		}
+
+	case "Rune[u]":
+		if app.queueIdx < len(app.queue) {
+			app.send("move-up", "id", app.queue[app.queueIdx].id)
+			app.queueIdx--
+		}
+
+	case "Rune[p]", "Ctrl+P":
+		app.togglePause()
+
+	case "Esc", "F8":
+		app.showQueue = false
+		app.send("watch-queue", "watch", "false")
+
+	case "Ctrl+C":
+		app.send("stop")
+	}
+	app.queueIdx = max(0, min(app.queueIdx, len(app.queue)-1))
+}
+
+func (app *app) queueView(b *builder) {
+	b.newLine()
+	b.layout(c{size: 1}, c{size: 8}, c{size: 8}, c{size: 20, flex: 1}, c{size: 20, flex: 2}, c{size: 1})
+	b.text(" ", styleFolderHeader)
+	b.text("Id", styleFolderHeader)
+	b.text("Kind", styleFolderHeader)
+	b.text("Archive", styleFolderHeader)
+	b.text("Document", styleFolderHeader)
+	b.text("", styleFolderHeader)
+	lines := app.screenSize.height - 4
+
+	offset := max(0, app.queueIdx+1-lines)
+	for i, item := range app.queue[offset:] {
+		if i >= lines {
+			break
+		}
+		style := styleDefault
+		if item.running {
+			style = style.Foreground(tcell.PaletteColor(195))
+		}
+		style = style.Reverse(offset+i == app.queueIdx)
+		b.newLine()
+		b.text(" ", style)
+		b.text(item.id, style)
+		b.text(item.kind, style)
+		b.text(item.root, style)
+		b.text(filepath.Join(item.path, item.name), style)
+		b.text(" ", style)
+	}
+	rows := len(app.queue) - offset
+	if rows < lines {
+		b.newLine()
+		b.space(app.screenSize.width, lines-rows, styleDefault)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 )
@@ -16,10 +17,11 @@ var (
 	styleBreadcrumbs    = tcell.StyleDefault.Foreground(tcell.Color250).Background(tcell.Color17).Bold(true).Italic(true)
 	styleFolderHeader   = tcell.StyleDefault.Foreground(tcell.Color231).Background(tcell.ColorGray).Bold(true)
 	styleProgressBar    = tcell.StyleDefault.Foreground(tcell.Color231).Background(tcell.ColorLightGray)
+	styleOffline        = tcell.StyleDefault.Foreground(tcell.Color242).Background(tcell.Color17)
 )
 
 func (app *app) render() {
-	if app.folderUpdateInProgress {
+	if app.folderUpdateInProgress || app.curArchive() == nil {
 		return
 	}
 
@@ -62,15 +64,86 @@ func (app *app) render() {
 
 	app.showTitle(b)
 	app.breadcrumbs(b)
-	app.folderView(b)
+	if app.showHistory {
+		app.historyView(b)
+	} else if app.showQueue {
+		app.queueView(b)
+	} else if app.showAttic {
+		app.atticView(b)
+	} else {
+		app.folderView(b)
+	}
 	app.statusLine(b)
 	b.show()
 }
 
 func (app *app) showTitle(b *builder) {
-	b.layout(c{size: 9}, c{flex: 1})
+	synced, title := "", app.root
+	if archive := app.curArchive(); archive != nil {
+		if archive.label != "" {
+			title = archive.label
+		}
+		synced = "never synced "
+		if !archive.lastSynced.IsZero() {
+			synced = "last synced " + ago(archive.lastSynced) + " "
+		}
+		if archive.role != "" {
+			synced = archive.role + ", " + synced
+		}
+		if archive.lockedBy != "" {
+			synced = "read-only, locked by " + archive.lockedBy + ", " + synced
+		}
+		if archive.state == archiveOffline {
+			synced = "OFFLINE, " + synced
+		}
+	}
+	others := []string{}
+	for idx, root := range app.roots {
+		archive := app.archives[root]
+		if root == app.root || archive == nil || archive.role == "origin" {
+			continue
+		}
+		label := root
+		if archive.label != "" {
+			label = archive.label
+		}
+		age := "never"
+		if !archive.lastSynced.IsZero() {
+			age = ago(archive.lastSynced)
+		}
+		others = append(others, fmt.Sprintf("%d:%s %s ", idx+1, label, age))
+	}
+	constraints := []c{{size: 9}, {flex: 1}, {size: len(synced)}}
+	for _, other := range others {
+		constraints = append(constraints, c{size: len(other)})
+	}
+	b.layout(constraints...)
 	b.text(" Archive ", styleAppName)
-	b.text(app.root, styleArchive)
+	b.text(title, styleArchive)
+	b.text(synced, styleArchive)
+	for _, other := range others {
+		b.text(other, styleBreadcrumbs)
+	}
+}
+
+func ago(t time.Time) string {
+	elapsed := time.Since(t)
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return plural(int(elapsed/time.Minute), "minute") + " ago"
+	case elapsed < 24*time.Hour:
+		return plural(int(elapsed/time.Hour), "hour") + " ago"
+	}
+	return plural(int(elapsed/(24*time.Hour)), "day") + " ago"
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
 }
 
 func (app *app) breadcrumbs(b *builder) {
@@ -136,6 +209,7 @@ func (app *app) folderView(b *builder) {
 	b.text(fmt.Sprintf("%19s", "Size"+folder.sortIndicator(sortBySize)), styleFolderHeader)
 	b.text(" ", styleFolderHeader)
 	lines := app.screenSize.height - 4
+	offline := app.curArchive().state == archiveOffline
 
 	for i := range app.entries[folder.offsetIdx:] {
 		file := &app.entries[folder.offsetIdx+i]
@@ -143,7 +217,11 @@ func (app *app) folderView(b *builder) {
 			break
 		}
 
-		style := fileStyle(file).Reverse(folder.selectedIdx == folder.offsetIdx+i)
+		style := fileStyle(file)
+		if offline {
+			style = styleOffline
+		}
+		style = style.Reverse(folder.selectedIdx == folder.offsetIdx+i)
 		b.newLine()
 		b.text(" ", style)
 		b.state(file, style)
@@ -167,6 +245,9 @@ func (app *app) folderView(b *builder) {
 
 func fileStyle(file *entry) tcell.Style {
 	fg := 231
+	if file.change != "" {
+		fg = 214
+	}
 	switch file.state {
 	case scanned:
 		fg = 248
@@ -183,6 +264,14 @@ func fileStyle(file *entry) tcell.Style {
 func (app *app) statusLine(b *builder) {
 	b.newLine()
 	b.layout(c{flex: 1})
+	if app.status != "" {
+		b.text(" "+app.status, styleArchive)
+		return
+	}
+	if status := app.queueStatus(); status != "" {
+		b.text(status, styleArchive)
+		return
+	}
 	b.text(" Status line will be here...", styleArchive)
 }
 
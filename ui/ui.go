@@ -1,16 +1,18 @@
 package ui
 
 import (
-	"arc/exec"
+	"arc/config"
 	"arc/log"
 	"arc/parser"
-	"bufio"
+	"arc/transport"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	osexec "os/exec"
 	"path/filepath"
 	"runtime/debug"
+	"slices"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
@@ -25,11 +27,25 @@ type app struct {
 	screenSize    size
 	folderTargets []folderTarget
 	sortTargets   []sortTarget
-	events        io.WriteCloser
-	commands      io.ReadCloser
+	engine        transport.Conn
 	incoming      chan any
-	outgoing      chan string
 	lastClickTime time.Time
+	status        string
+	batches       []batch
+	historyIdx    int
+	showHistory   bool
+	interrupted   []string
+	queue         []queueItem
+	queueIdx      int
+	showQueue     bool
+	attic         []atticEntry
+	atticIdx      int
+	atticRoot     string
+	showAttic     bool
+	incomingQueue []queueItem
+	queued        int
+	running       int
+	paused        bool
 
 	folderUpdateInProgress bool
 	makeSelectedVisible    bool
@@ -79,6 +95,11 @@ type archive struct {
 	folders    folders
 	state      archiveState
 	rootFolder *folder
+	lastSynced time.Time
+	syncedFrom string
+	role       string
+	label      string
+	lockedBy   string
 }
 
 type archiveState int
@@ -88,6 +109,7 @@ const (
 	archiveHashing
 	archiveReady
 	archiveCopying
+	archiveOffline
 )
 
 func (s archiveState) String() string {
@@ -100,48 +122,83 @@ func (s archiveState) String() string {
 		return "archiveReady"
 	case archiveCopying:
 		return "archiveCopying"
+	case archiveOffline:
+		return "archiveOffline"
 	}
 	panic("Invalid archiveState")
 }
 
-func Run(screen tcell.Screen) {
-	engine := os.Getenv("ARC_ENGINE")
-	if engine == "" {
-		executable, _ := os.Executable()
-		dir := filepath.Dir(executable)
-		engine = filepath.Join(dir, "engine")
+func parseArchiveState(name string) archiveState {
+	for s := archiveScanning; s <= archiveOffline; s++ {
+		if s.String() == name {
+			return s
+		}
 	}
-	commands, events := exec.Start(engine)
+	return archiveScanning
+}
 
+func Run(screen tcell.Screen, engine transport.Conn) error {
 	app := &app{
 		screen:   screen,
 		archives: map[string]*archive{},
-		commands: commands,
-		events:   events,
+		engine:   engine,
 		incoming: make(chan any),
-		outgoing: make(chan string),
 	}
 
 	screen.EnableMouse()
-	go app.sendEvents()
 	go app.handleCommands()
 	go app.handleTcellEvents()
 
-	for _, root := range os.Args[1:] {
-		if root == "--" {
-			break
-		}
-		app.roots = append(app.roots, root)
-		app.archives[root] = &archive{
-			folders: folders{},
+	if len(os.Args) > 1 && (os.Args[1] == "attach" || os.Args[1] == "-d") {
+		app.send("attach")
+		app.handleMessages()
+		return nil
+	}
+
+	if len(os.Args) == 4 && os.Args[1] == "diff" {
+		app.send("diff", "from", os.Args[2], "to", os.Args[3])
+		app.handleMessages()
+		return nil
+	}
+
+	args := os.Args[1:]
+	if idx := slices.Index(args, "--"); idx >= 0 {
+		args = args[:idx]
+	}
+	roots, err := config.Roots(args)
+	if err != nil {
+		log.Debug("loading roots failed", "error", err)
+		app.send("stop")
+		return err
+	}
+	origin := ""
+	for _, arg := range roots {
+		members, group := arg.Members()
+		for _, root := range members {
+			app.roots = append(app.roots, root)
+			app.archives[root] = &archive{
+				folders: folders{},
+				label:   arg.Label,
+			}
+			app.send("scan", "root", root, "group", group, "role", arg.Role, "label", arg.Label)
+			if arg.Role == "origin" && origin == "" {
+				origin = root
+			}
 		}
-		app.send("scan", "root", root)
 	}
 
-	app.root = os.Args[1]
+	if len(app.roots) == 0 {
+		app.send("stop")
+		return errors.New("no roots to show")
+	}
+	app.root = app.roots[0]
+	if origin != "" {
+		app.root = origin
+	}
 	app.send("set-current-folder", "root", app.root, "path", "")
 
 	app.handleMessages()
+	return nil
 }
 
 func (app *app) reset() {
@@ -176,12 +233,6 @@ func (app *app) curEntry() *entry {
 	return &app.entries[app.curFolder().selectedIdx]
 }
 
-func (r *app) sendEvents() {
-	for event := range r.outgoing {
-		r.events.Write([]byte(event))
-	}
-}
-
 func (r *app) handleCommands() {
 	defer func() {
 		if err := recover(); err != nil {
@@ -191,9 +242,8 @@ func (r *app) handleCommands() {
 		}
 	}()
 
-	reader := bufio.NewReader(r.commands)
 	for !r.quit {
-		text, err := reader.ReadString('\n')
+		msg, err := r.engine.Receive()
 		if err == io.EOF {
 			r.quit = true
 			break
@@ -201,7 +251,7 @@ func (r *app) handleCommands() {
 		if err != nil {
 			panic(err)
 		}
-		r.incoming <- parser.Parse(text)
+		r.incoming <- msg
 	}
 }
 
@@ -258,8 +308,35 @@ func (app *app) handleMessages() {
 
 func (app *app) handleCommand(command *parser.Message) {
 	switch command.Type {
+	case "archive":
+		root := command.StringValue("root")
+		if app.archives[root] == nil {
+			app.roots = append(app.roots, root)
+			app.archives[root] = &archive{
+				folders: folders{},
+			}
+		}
+
+	case "archive-info":
+		if archive := app.archives[command.StringValue("root")]; archive != nil {
+			archive.lastSynced = time.Time{}
+			if command.StringValue("last-synced") != "" {
+				archive.lastSynced = command.Time("last-synced")
+			}
+			archive.syncedFrom = command.StringValue("synced-from")
+			archive.role = command.StringValue("role")
+			archive.label = command.StringValue("label")
+			archive.lockedBy = command.StringValue("locked-by")
+			archive.state = parseArchiveState(command.StringValue("state"))
+		}
+
 	case "current-folder":
 		app.root = command.StringValue("root")
+		if app.archives[app.root] == nil {
+			app.archives[app.root] = &archive{
+				folders: folders{},
+			}
+		}
 		app.archives[app.root].path = command.StringValue("path")
 		app.reset()
 		app.folderUpdateInProgress = true
@@ -278,6 +355,59 @@ func (app *app) handleCommand(command *parser.Message) {
 		app.sort()
 		app.folderUpdateInProgress = false
 
+	case "remove-entry":
+		name := command.StringValue("name")
+		for i, entry := range app.entries {
+			if entry.name == name {
+				app.entries = append(app.entries[:i], app.entries[i+1:]...)
+				if folder := app.curFolder(); folder.selectedIdx >= len(app.entries) {
+					folder.selectedIdx = max(len(app.entries)-1, 0)
+				}
+				return
+			}
+		}
+
+	case "batch":
+		app.batches = append(app.batches, parseBatch(command))
+
+	case "show-batches":
+		app.historyIdx = 0
+		app.showHistory = true
+
+	case "attic-entry":
+		app.attic = append(app.attic, parseAtticEntry(command))
+
+	case "show-attic":
+		slices.SortStableFunc(app.attic, func(a, b atticEntry) int {
+			return b.time.Compare(a.time)
+		})
+		app.atticRoot = command.StringValue("root")
+		app.atticIdx = 0
+		app.showAttic = true
+
+	case "queue-status":
+		app.queued = command.Int("queued")
+		app.running = command.Int("running")
+		app.paused = command.StringValue("paused") == "true"
+
+	case "queue-item":
+		app.incomingQueue = append(app.incomingQueue, parseQueueItem(command))
+
+	case "queue-listed":
+		app.queue, app.incomingQueue = app.incomingQueue, app.queue[:0]
+
+	case "interrupted-run":
+		batch := command.StringValue("batch")
+		app.interrupted = append(app.interrupted, batch)
+		app.status = fmt.Sprintf("Run %s was interrupted after %d of %d steps: R - resume, B - roll back, Esc - ignore",
+			batch, command.Int("done"), command.Int("steps"))
+
+	case "status":
+		app.status = command.StringValue("status")
+
+	case "error":
+		app.status = command.StringValue("error")
+
 	case "stopped":
 		app.quit = true
 	}
@@ -292,11 +422,38 @@ func parseEntry(msg *parser.Message) entry {
 		state:    uiState(msg.StringValue("state")),
 		progress: msg.Int("progress"),
 		counts:   msg.StringValue("counts"),
+		change:   msg.StringValue("change"),
 	}
 }
 
 func (app *app) handleKeyEvent(event *tcell.EventKey) {
 	log.Debug("handleKeyEvent", "key", event.Name())
+	if app.showHistory {
+		app.handleHistoryKeyEvent(event)
+		return
+	}
+	if app.showQueue {
+		app.handleQueueKeyEvent(event)
+		return
+	}
+	if app.showAttic {
+		app.handleAtticKeyEvent(event)
+		return
+	}
+	if len(app.interrupted) > 0 && app.handleInterruptedKeyEvent(event) {
+		return
+	}
+	if app.curArchive() == nil {
+		switch event.Name() {
+		case "Ctrl+C":
+			app.send("stop")
+		case "Ctrl+D":
+			app.engine.Close()
+			app.quit = true
+		}
+		return
+	}
+
 	switch event.Name() {
 	case "Up":
 		app.curFolder().selectedIdx--
@@ -348,14 +505,48 @@ func (app *app) handleKeyEvent(event *tcell.EventKey) {
 	case "Ctrl+C":
 		app.send("stop")
 
+	case "Ctrl+D":
+		app.engine.Close()
+		app.quit = true
+
 	case "Ctrl+R":
-		// TODO Resole
+		if len(app.entries) > 0 {
+			app.send("resolve", "root", app.root, "path", app.curPath(), "name", app.curEntry().name)
+		}
 
 	case "Ctrl+A":
-		// TODO Resole All
+		app.send("resolve-all")
+
+	case "Ctrl+Z":
+		app.send("undo")
+
+	case "F8":
+		app.showQueue = true
+		app.queueIdx = 0
+		app.send("watch-queue", "watch", "true")
+
+	case "F7":
+		app.attic = app.attic[:0]
+		app.send("list-attic", "root", app.root)
+
+	case "F9":
+		app.batches = app.batches[:0]
+		app.send("list-batches")
+
+	case "Ctrl+P":
+		app.togglePause()
+
+	case "Ctrl+X":
+		if len(app.entries) > 0 {
+			app.send("cancel", "root", app.root, "path", app.curPath(), "name", app.curEntry().name)
+		}
 
 	case "Tab":
-		// TODO Tab
+		if len(app.roots) > 0 {
+			idx := (slices.Index(app.roots, app.root) + 1) % len(app.roots)
+			root := app.roots[idx]
+			app.send("set-current-folder", "root", root, "path", app.archives[root].path)
+		}
 
 	case "Backspace2": // Ctrl+Delete
 		// TODO Delete
@@ -378,7 +569,26 @@ func (app *app) handleKeyEvent(event *tcell.EventKey) {
 	}
 }
 
+func (app *app) handleInterruptedKeyEvent(event *tcell.EventKey) bool {
+	batch := app.interrupted[0]
+	switch event.Name() {
+	case "Rune[r]", "Rune[R]":
+		app.send("resume-run", "batch", batch)
+	case "Rune[b]", "Rune[B]":
+		app.send("rollback-run", "batch", batch)
+	case "Esc":
+	default:
+		return false
+	}
+	app.interrupted = app.interrupted[1:]
+	app.status = ""
+	return true
+}
+
 func (app *app) handleMouseEvent(event *tcell.EventMouse) {
+	if app.curArchive() == nil {
+		return
+	}
 	x, y := event.Position()
 	if event.Buttons() == 256 || event.Buttons() == 512 {
 		if y >= 3 && y < app.screenSize.height-1 {
@@ -430,8 +640,7 @@ func (app *app) handleMouseEvent(event *tcell.EventMouse) {
 }
 
 func (r *app) send(kind string, params ...any) {
-	msg := parser.String(kind, params...)
-	r.outgoing <- msg
+	r.engine.Send(kind, params...)
 }
 
 func (app *app) sort() {